@@ -3,11 +3,15 @@ package experiment
 import (
 	"github.com/juju/errors"
 	"github.com/sneakylocke/experiment/constraint"
+	"github.com/sneakylocke/experiment/validation"
+	"sort"
 )
 
 type Audience struct {
 	Name        string                  `json:"name"`
 	Constraints []constraint.Constraint `json:"constraints"`
+	Segments    []string                `json:"segments,omitempty"`   // References to segments that must also match
+	Expression  string                  `json:"expression,omitempty"` // Constraints in expression syntax that must also match
 	ValueGroups map[string]*ValueGroup  `json:"valueGroups"`
 	Exposure    float64                 `json:"exposure"`
 	Enabled     bool                    `json:"enabled"`
@@ -18,6 +22,7 @@ func NewAudience() *Audience {
 
 	audience.Name = ""
 	audience.Constraints = make([]constraint.Constraint, 0)
+	audience.Segments = make([]string, 0)
 	audience.ValueGroups = make(map[string]*ValueGroup)
 	audience.Exposure = 1.0
 	audience.Enabled = true
@@ -25,30 +30,89 @@ func NewAudience() *Audience {
 	return audience
 }
 
+// PromoteValue promotes the value at index in every value group of the audience, see ValueGroup.PromoteValue. The
+// value groups of aligned experiments share their weights, so they stay aligned. Nothing is changed unless every
+// value group can be promoted. Users outside of the exposure keep getting the control value.
+func (a *Audience) PromoteValue(index int, weight uint32) error {
+	for name, valueGroup := range a.ValueGroups {
+		if _, err := promoteWeights(valueGroup.WeightedValues, index, weight); err != nil {
+			return errors.Annotatef(err, "could not promote value %d of '%s' in audience '%s'", index, name, a.Name)
+		}
+	}
+
+	for _, valueGroup := range a.ValueGroups {
+		if err := valueGroup.PromoteValue(index, weight); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate returns every error with the audience, each with the path of its field, see validation.Errors.
 func (a *Audience) Validate() error {
+	problems := &validation.Collector{}
+	a.validate(problems, constraint.MISSING_FAIL)
+
+	return problems.Err()
+}
+
+func (a *Audience) validate(problems *validation.Collector, missing constraint.MISSING) {
 	if a.Exposure < 0 || a.Exposure > 1 {
-		return errors.Errorf("invalid exposure: %f", a.Exposure)
+		problems.Addf("exposure", "invalid exposure: %f", a.Exposure)
 	}
 
 	if len(a.ValueGroups) == 0 {
-		return errors.Errorf("audiences should have value groups")
+		problems.Addf("valueGroups", "audiences should have value groups")
 	}
 
-	for name, valueGroup := range a.ValueGroups {
+	for _, name := range valueGroupNames(a) {
+		valueGroup := a.ValueGroups[name]
+		path := validation.Field("valueGroups", name)
+
 		if name != valueGroup.Name {
-			return errors.Errorf("value group key '%s' does not match name '%s'", name, valueGroup.Name)
+			problems.Addf(validation.Field(path, "name"), "value group key '%s' does not match name '%s'", name, valueGroup.Name)
 		}
 
-		if err := valueGroup.Validate(); err != nil {
-			return err
+		valueGroup.validate(problems.At(path))
+	}
+
+	if a.Expression != "" {
+		if _, err := constraint.ParseExpression(a.Expression); err != nil {
+			problems.Add("expression", errors.Annotate(err, "invalid expression"))
 		}
 	}
 
-	for _, constraint := range a.Constraints {
-		if err := constraint.Validate(); err != nil {
-			return err
+	for i, reference := range a.Segments {
+		if _, _, err := parseSegmentReference(reference); err != nil {
+			problems.Add(validation.Index("segments", i), err)
 		}
 	}
 
-	return nil
+	for i := range a.Constraints {
+		problems.Add(validation.Index("constraints", i), a.Constraints[i].Validate())
+	}
+
+	// Constraints that can't all be met make the audience unreachable
+	for _, key := range constraint.FindContradictionsWithPolicy(a.Constraints, missing) {
+		problems.Warnf("constraints", "the constraints on '%s' can never all be met", key)
+	}
+}
+
+// matchesEveryone returns true if the audience has nothing that could stop a user from matching it.
+func (a *Audience) matchesEveryone() bool {
+	return a.Enabled && len(a.Constraints) == 0 && len(a.Segments) == 0 && a.Expression == ""
+}
+
+// valueGroupNames returns the names of the value groups of an audience in order.
+func valueGroupNames(audience *Audience) []string {
+	names := make([]string, 0, len(audience.ValueGroups))
+
+	for name := range audience.ValueGroups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
 }
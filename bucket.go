@@ -0,0 +1,250 @@
+package experiment
+
+import (
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment/validation"
+	"sort"
+)
+
+// ALLOCATION is intended to act as an enum for how the users of an audience are split between weighted values.
+type ALLOCATION = string
+
+const (
+	ALLOCATION_WEIGHTED = "WEIGHTED" // Users are split by cumulative weights, the default
+	ALLOCATION_BUCKETS  = "BUCKETS"  // Every weighted value owns explicit ranges of buckets
+)
+
+// BucketCount is the number of buckets users are hashed into when a value group allocates buckets.
+const BucketCount = 10000
+
+// BucketRange is the range of buckets [Start, End).
+type BucketRange struct {
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+}
+
+// AllocateBuckets switches the value group to ALLOCATION_BUCKETS. The weights are scaled to BucketCount and every
+// weighted value is given one range of buckets, in order. Users are hashed into buckets differently than into
+// weights, so switching reassigns users once; later weight changes made with Rebalance move as few as possible.
+func (valueGroup *ValueGroup) AllocateBuckets() error {
+	if valueGroup.Allocation == ALLOCATION_BUCKETS {
+		return errors.Errorf("value group '%s' already allocates buckets", valueGroup.Name)
+	}
+
+	var sum uint64
+	for _, value := range valueGroup.WeightedValues {
+		sum += uint64(value.Weight)
+	}
+
+	if sum == 0 {
+		return errors.Errorf("value group '%s' has no weight to allocate buckets from", valueGroup.Name)
+	}
+
+	// Largest remainder, so the counts add up to exactly BucketCount
+	counts := make([]uint32, len(valueGroup.WeightedValues))
+	remainders := make([]uint64, len(valueGroup.WeightedValues))
+	var allocated uint32
+
+	for i, value := range valueGroup.WeightedValues {
+		scaled := uint64(value.Weight) * BucketCount
+		counts[i] = uint32(scaled / sum)
+		remainders[i] = scaled % sum
+		allocated += counts[i]
+	}
+
+	order := make([]int, len(counts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]] > remainders[order[j]] })
+
+	for _, i := range order[:BucketCount-allocated] {
+		counts[i]++
+	}
+
+	var start uint32
+	for i, count := range counts {
+		valueGroup.WeightedValues[i].Weight = count
+		valueGroup.WeightedValues[i].Buckets = nil
+
+		if count > 0 {
+			valueGroup.WeightedValues[i].Buckets = []BucketRange{{Start: start, End: start + count}}
+		}
+
+		start += count
+	}
+
+	valueGroup.Allocation = ALLOCATION_BUCKETS
+
+	return nil
+}
+
+// Rebalance sets the number of buckets owned by every weighted value of a value group that allocates buckets. Only
+// buckets of values that shrink change owner: they go to values that grow, then any buckets left over are no longer
+// owned, so their users get the control value. Values that grow take buckets given up by others before unowned
+// ones. Weights must add up to at most BucketCount.
+func (valueGroup *ValueGroup) Rebalance(weights []uint32) error {
+	if valueGroup.Allocation != ALLOCATION_BUCKETS {
+		return errors.Errorf("value group '%s' does not allocate buckets", valueGroup.Name)
+	}
+
+	if len(weights) != len(valueGroup.WeightedValues) {
+		return errors.Errorf("expected %d weights for value group '%s', got %d", len(valueGroup.WeightedValues), valueGroup.Name, len(weights))
+	}
+
+	var sum uint64
+	for _, weight := range weights {
+		sum += uint64(weight)
+	}
+
+	if sum > BucketCount {
+		return errors.Errorf("weights of value group '%s' add up to %d, more than the %d buckets", valueGroup.Name, sum, BucketCount)
+	}
+
+	owners := valueGroup.bucketOwners()
+	counts := make([]uint32, len(weights))
+
+	for _, owner := range owners {
+		if owner >= 0 {
+			counts[owner]++
+		}
+	}
+
+	// Shrinking values give up their highest buckets
+	var released []uint32
+
+	for bucket := BucketCount - 1; bucket >= 0; bucket-- {
+		owner := owners[bucket]
+
+		if owner >= 0 && counts[owner] > weights[owner] {
+			owners[bucket] = -1
+			counts[owner]--
+			released = append(released, uint32(bucket))
+		}
+	}
+
+	sort.Slice(released, func(i, j int) bool { return released[i] < released[j] })
+
+	var unowned []uint32
+	for bucket, owner := range owners {
+		if owner < 0 && !containsBucket(released, uint32(bucket)) {
+			unowned = append(unowned, uint32(bucket))
+		}
+	}
+
+	free := append(released, unowned...)
+
+	for i, weight := range weights {
+		for counts[i] < weight {
+			owners[free[0]] = i
+			free = free[1:]
+			counts[i]++
+		}
+	}
+
+	for i := range valueGroup.WeightedValues {
+		valueGroup.WeightedValues[i].Weight = weights[i]
+		valueGroup.WeightedValues[i].Buckets = bucketRanges(owners, i)
+	}
+
+	return nil
+}
+
+// bucketOwners returns the index of the weighted value owning every bucket, or -1 for buckets that are not owned.
+func (valueGroup *ValueGroup) bucketOwners() []int {
+	owners := make([]int, BucketCount)
+
+	for i := range owners {
+		owners[i] = -1
+	}
+
+	for i, value := range valueGroup.WeightedValues {
+		for _, bucketRange := range value.Buckets {
+			for bucket := bucketRange.Start; bucket < bucketRange.End && bucket < BucketCount; bucket++ {
+				owners[bucket] = i
+			}
+		}
+	}
+
+	return owners
+}
+
+// validateBuckets checks that the bucket ranges are in bounds, don't overlap, and that the weight of every value is
+// the number of buckets it owns.
+func (valueGroup *ValueGroup) validateBuckets(problems *validation.Collector) {
+	switch valueGroup.Allocation {
+	case "", ALLOCATION_WEIGHTED:
+		for i, value := range valueGroup.WeightedValues {
+			if len(value.Buckets) > 0 {
+				problems.Addf(validation.Field(validation.Index("weightedValues", i), "buckets"), "value has buckets but the value group does not allocate buckets")
+			}
+		}
+
+		return
+	case ALLOCATION_BUCKETS:
+	default:
+		problems.Addf("allocation", "invalid allocation: %s", valueGroup.Allocation)
+		return
+	}
+
+	owned := make([]bool, BucketCount)
+
+	for i, value := range valueGroup.WeightedValues {
+		path := validation.Index("weightedValues", i)
+		var count uint32
+
+		for j, bucketRange := range value.Buckets {
+			rangePath := validation.Index(validation.Field(path, "buckets"), j)
+
+			if bucketRange.Start >= bucketRange.End || bucketRange.End > BucketCount {
+				problems.Addf(rangePath, "invalid bucket range [%d, %d)", bucketRange.Start, bucketRange.End)
+				continue
+			}
+
+			for bucket := bucketRange.Start; bucket < bucketRange.End; bucket++ {
+				if owned[bucket] {
+					problems.Addf(rangePath, "bucket %d is owned more than once", bucket)
+					break
+				}
+
+				owned[bucket] = true
+			}
+
+			count += bucketRange.End - bucketRange.Start
+		}
+
+		if count != value.Weight {
+			problems.Addf(validation.Field(path, "weight"), "value has weight %d but owns %d buckets", value.Weight, count)
+		}
+	}
+}
+
+// bucketRanges returns the buckets owned by a value as few ranges as possible.
+func bucketRanges(owners []int, index int) []BucketRange {
+	var ranges []BucketRange
+
+	for bucket, owner := range owners {
+		if owner != index {
+			continue
+		}
+
+		if n := len(ranges); n > 0 && ranges[n-1].End == uint32(bucket) {
+			ranges[n-1].End++
+		} else {
+			ranges = append(ranges, BucketRange{Start: uint32(bucket), End: uint32(bucket) + 1})
+		}
+	}
+
+	return ranges
+}
+
+func containsBucket(sorted []uint32, bucket uint32) bool {
+	i := sort.Search(len(sorted), func(i int) bool { return sorted[i] >= bucket })
+	return i < len(sorted) && sorted[i] == bucket
+}
+
+// getBucket hashes a user into one of BucketCount buckets. The hash string is prefixed so that the bucket does not
+// depend on the hash deciding exposure.
+func getBucket(hashString string) uint32 {
+	return getHash("bucket:"+hashString) % BucketCount
+}
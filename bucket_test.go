@@ -0,0 +1,282 @@
+package experiment
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAllocateBuckets(t *testing.T) {
+	valueGroup := NewIntValueGroup("variable", []uint32{1, 1, 1}, []int64{0, 1, 2})
+	valueGroup.Salt = "salt"
+	valueGroup.ControlValue = *NewIntValue(0)
+
+	assert.Nil(t, valueGroup.AllocateBuckets())
+	assert.Equal(t, ALLOCATION_BUCKETS, valueGroup.Allocation)
+	assert.Equal(t, []uint32{3334, 3333, 3333}, weightsOf(valueGroup))
+	assert.Equal(t, []BucketRange{{Start: 0, End: 3334}}, valueGroup.WeightedValues[0].Buckets)
+	assert.Equal(t, []BucketRange{{Start: 3334, End: 6667}}, valueGroup.WeightedValues[1].Buckets)
+	assert.Equal(t, []BucketRange{{Start: 6667, End: 10000}}, valueGroup.WeightedValues[2].Buckets)
+	assert.Nil(t, valueGroup.Validate())
+
+	assert.NotNil(t, valueGroup.AllocateBuckets())
+
+	empty := NewIntValueGroup("variable", []uint32{0, 0}, []int64{0, 1})
+	assert.NotNil(t, empty.AllocateBuckets())
+}
+
+func TestRebalance(t *testing.T) {
+	valueGroup := NewIntValueGroup("variable", []uint32{1, 1}, []int64{0, 1})
+	valueGroup.Salt = "salt"
+	valueGroup.ControlValue = *NewIntValue(0)
+
+	assert.NotNil(t, valueGroup.Rebalance([]uint32{4000, 6000}), "weighted value groups can't be rebalanced")
+	assert.Nil(t, valueGroup.AllocateBuckets())
+
+	before := valueGroup.bucketOwners()
+
+	// Only the buckets given up by the first value move
+	assert.Nil(t, valueGroup.Rebalance([]uint32{4000, 6000}))
+	assert.Nil(t, valueGroup.Validate())
+	assert.Equal(t, []BucketRange{{Start: 0, End: 4000}}, valueGroup.WeightedValues[0].Buckets)
+	assert.Equal(t, []BucketRange{{Start: 4000, End: 10000}}, valueGroup.WeightedValues[1].Buckets)
+	assert.Equal(t, 1000, movedBuckets(before, valueGroup.bucketOwners()))
+
+	// Buckets that are given up and not taken are no longer owned
+	assert.Nil(t, valueGroup.Rebalance([]uint32{2000, 6000}))
+	assert.Nil(t, valueGroup.Validate())
+	assert.Equal(t, []BucketRange{{Start: 0, End: 2000}}, valueGroup.WeightedValues[0].Buckets)
+
+	// Values that grow prefer buckets given up by others to unowned buckets
+	assert.Nil(t, valueGroup.Rebalance([]uint32{1000, 7000}))
+	assert.Nil(t, valueGroup.Validate())
+	assert.Equal(t, []BucketRange{{Start: 1000, End: 2000}, {Start: 4000, End: 10000}}, valueGroup.WeightedValues[1].Buckets)
+
+	assert.NotNil(t, valueGroup.Rebalance([]uint32{5000, 5001}))
+	assert.NotNil(t, valueGroup.Rebalance([]uint32{5000}))
+}
+
+func TestValidateBuckets(t *testing.T) {
+	newGroup := func() *ValueGroup {
+		valueGroup := NewIntValueGroup("variable", []uint32{1, 1}, []int64{0, 1})
+		valueGroup.Salt = "salt"
+		valueGroup.ControlValue = *NewIntValue(0)
+		assert.Nil(t, valueGroup.AllocateBuckets())
+		return valueGroup
+	}
+
+	valueGroup := newGroup()
+	valueGroup.WeightedValues[1].Buckets[0].Start = 4999
+	valueGroup.WeightedValues[1].Weight = 5001
+	assert.NotNil(t, valueGroup.Validate(), "buckets overlap")
+
+	valueGroup = newGroup()
+	valueGroup.WeightedValues[1].Weight = 1
+	assert.NotNil(t, valueGroup.Validate(), "weight is not the number of buckets")
+
+	valueGroup = newGroup()
+	valueGroup.WeightedValues[1].Buckets[0].End = BucketCount + 1
+	valueGroup.WeightedValues[1].Weight = 5001
+	assert.NotNil(t, valueGroup.Validate(), "bucket out of range")
+
+	valueGroup = newGroup()
+	valueGroup.Allocation = ALLOCATION_WEIGHTED
+	assert.NotNil(t, valueGroup.Validate(), "buckets without bucket allocation")
+
+	valueGroup = newGroup()
+	valueGroup.Allocation = "RANDOM"
+	assert.NotNil(t, valueGroup.Validate())
+}
+
+func TestBucketAllocationSurvivesWeightChange(t *testing.T) {
+	const users = 20000
+
+	builder := NewSimpleBuilder("checkout")
+	assert.Nil(t, builder.AddStrings("button_text", []uint32{1, 1}, []string{"A", "B"}))
+	experiment, err := builder.Build()
+	assert.Nil(t, err)
+
+	valueGroup := experiment.Audiences[0].ValueGroups["button_text"]
+	assert.Nil(t, valueGroup.AllocateBuckets())
+
+	assign := func() map[string]string {
+		service := NewService()
+		assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+		assignments := make(map[string]string, users)
+
+		for i := 0; i < users; i++ {
+			userID := makeUserID(i)
+			text, err := service.GetString("button_text", userID, nil, "")
+			assert.Nil(t, err)
+			assignments[userID] = text
+		}
+
+		return assignments
+	}
+
+	before := assign()
+	previous := copyExperiment(t, experiment)
+
+	assert.Nil(t, valueGroup.Rebalance([]uint32{4000, 6000}))
+	after := assign()
+
+	moved := 0
+	for userID, text := range after {
+		if text != before[userID] {
+			assert.Equal(t, "B", text, "only users of A should move")
+			moved++
+		}
+	}
+
+	changes := DiffAllocations(previous, experiment)
+	assert.Len(t, changes, 1)
+	assert.False(t, changes[0].Estimated)
+	assert.InDelta(t, 0.1, changes[0].Fraction, 1e-9)
+	assert.InDelta(t, changes[0].Fraction, float64(moved)/users, 0.01)
+}
+
+func TestDiffAllocations(t *testing.T) {
+	builder := NewSimpleBuilder("checkout")
+	assert.Nil(t, builder.AddInts("variable", []uint32{1, 1}, []int64{0, 1}))
+	before, err := builder.Build()
+	assert.Nil(t, err)
+
+	// The same weights
+	changes := DiffAllocations(before, before)
+	assert.Equal(t, []AllocationChange{{Audience: before.Audiences[0].Name, Variable: "variable"}}, changes)
+
+	// Weighted allocations with a different sum reshuffle everyone
+	after := copyExperiment(t, before)
+	after.Audiences[0].ValueGroups["variable"].WeightedValues[0].Weight = 2
+	after.Audiences[0].ValueGroups["variable"].WeightedValues[1].Weight = 3
+
+	changes = DiffAllocations(before, after)
+	assert.True(t, changes[0].Estimated)
+	assert.InDelta(t, 0.5, changes[0].Fraction, 1e-9)
+
+	// Halving the exposure moves half of the users to the control value
+	after = copyExperiment(t, before)
+	after.Audiences[0].Exposure = 0.5
+
+	changes = DiffAllocations(before, after)
+	assert.False(t, changes[0].Estimated)
+	assert.InDelta(t, 0.5, changes[0].Fraction, 0.001)
+
+	// Exposure and position come from the same hash, so with half of the users exposed only the first half of the
+	// positions gets a weighted value and moving the boundary from 5000 to 4000 moves a tenth of the users, not half
+	// of a tenth
+	before.Audiences[0].ValueGroups["variable"].WeightedValues[0].Weight = 5000
+	before.Audiences[0].ValueGroups["variable"].WeightedValues[1].Weight = 5000
+	before.Audiences[0].Exposure = 0.5
+	after = copyExperiment(t, before)
+	after.Audiences[0].ValueGroups["variable"].WeightedValues[0].Weight = 4000
+	after.Audiences[0].ValueGroups["variable"].WeightedValues[1].Weight = 6000
+
+	changes = DiffAllocations(before, after)
+	assert.False(t, changes[0].Estimated)
+	assert.InDelta(t, 0.1, changes[0].Fraction, 1e-9)
+	assert.InDelta(t, changes[0].Fraction, sampledChange(t, before, after, 20000), 0.01)
+
+	// So does raising the exposure, which only serves the second value to the newly exposed users
+	after = copyExperiment(t, before)
+	after.Audiences[0].Exposure = 1
+
+	changes = DiffAllocations(before, after)
+	assert.False(t, changes[0].Estimated)
+	assert.InDelta(t, 0.4999, changes[0].Fraction, 1e-9)
+	assert.InDelta(t, changes[0].Fraction, sampledChange(t, before, after, 20000), 0.01)
+
+	before = copyExperiment(t, before)
+	before.Audiences[0].Exposure = 1
+	before.Audiences[0].ValueGroups["variable"].WeightedValues[0].Weight = 1
+	before.Audiences[0].ValueGroups["variable"].WeightedValues[1].Weight = 1
+
+	// A new salt reassigns everyone at random
+	after = copyExperiment(t, before)
+	after.Salt = "new salt"
+
+	changes = DiffAllocations(before, after)
+	assert.True(t, changes[0].Estimated)
+	assert.InDelta(t, 0.5, changes[0].Fraction, 1e-9)
+
+	// Concluding serves the winner to everyone, so the users that had the other value move
+	after = copyExperiment(t, before)
+	after.Status = STATUS_CONCLUDED
+	after.Winners = map[string]int{"variable": 1}
+
+	changes = DiffAllocations(before, after)
+	assert.False(t, changes[0].Estimated)
+	assert.InDelta(t, 0.5, changes[0].Fraction, 1e-9)
+
+	// Audiences found in one version only are not compared
+	after = copyExperiment(t, before)
+	after.Audiences[0].Name = "renamed"
+	assert.Empty(t, DiffAllocations(before, after))
+}
+
+// sampledChange returns the fraction of users getting a different value of variable from the first audience of both
+// experiments, values told apart by their index as DiffAllocations does.
+func sampledChange(t *testing.T, before *Experiment, after *Experiment, users int) float64 {
+	s := &service{}
+	changed := 0
+
+	index := func(experiment *Experiment, userID string) int {
+		valueGroup := experiment.Audiences[0].ValueGroups["variable"]
+		value, err := s.getVariable(experiment, &experiment.Audiences[0], "variable", userID)
+		assert.Nil(t, err)
+
+		for i := range valueGroup.WeightedValues {
+			if value == &valueGroup.WeightedValues[i].Value {
+				return i
+			}
+		}
+
+		return -1
+	}
+
+	for i := 0; i < users; i++ {
+		if index(before, makeUserID(i)) != index(after, makeUserID(i)) {
+			changed++
+		}
+	}
+
+	return float64(changed) / float64(users)
+}
+
+func TestExposedPositions(t *testing.T) {
+	for _, exposure := range []float64{-1, 0, 0.00005, 0.0001, 0.1, 0.29, 0.3, 0.5, 0.57, 0.9999, 1, 2} {
+		exposed := uint64(0)
+
+		for position := 0; position < denominator; position++ {
+			if float64(position)/denominator <= exposure {
+				exposed++
+			}
+		}
+
+		assert.Equal(t, exposed, exposedPositions(exposure), "exposure %v", exposure)
+	}
+}
+
+func movedBuckets(before []int, after []int) int {
+	moved := 0
+
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+		}
+	}
+
+	return moved
+}
+
+// copyExperiment returns a deep copy of an experiment.
+func copyExperiment(t *testing.T, experiment *Experiment) *Experiment {
+	data, err := json.Marshal(experiment)
+	assert.Nil(t, err)
+
+	copied := &Experiment{}
+	assert.Nil(t, json.Unmarshal(data, copied))
+
+	return copied
+}
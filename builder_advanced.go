@@ -1,6 +1,7 @@
 package experiment
 
 import (
+	"encoding/json"
 	"github.com/juju/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/sneakylocke/experiment/constraint"
@@ -15,8 +16,14 @@ type AdvancedBuilder interface {
 	AddFloats(variableName string, audienceName string, weights []uint32, values []float64) error
 	AddInts(variableName string, audienceName string, weights []uint32, values []int64) error
 	AddBools(variableName string, audienceName string, weights []uint32, values []bool) error
+	AddStrings(variableName string, audienceName string, weights []uint32, values []string) error
+	AddJSON(variableName string, audienceName string, weights []uint32, values []json.RawMessage) error
 
 	AddConstraint(audienceName string, constraint *constraint.Constraint) error
+
+	// SetControl sets the control value of a variable added to an audience, which is otherwise its first value. See
+	// ValueGroup.SetControl.
+	SetControl(variableName string, audienceName string, value *Value) error
 }
 
 type advancedBuilder struct {
@@ -89,6 +96,26 @@ func (b *advancedBuilder) AddBools(variableName string, audienceName string, wei
 	return nil
 }
 
+func (b *advancedBuilder) AddStrings(variableName string, audienceName string, weights []uint32, values []string) error {
+	if err := b.preValidate(variableName, audienceName, weights, len(values)); err != nil {
+		return errors.Annotate(err, "could not add strings")
+	}
+
+	b.setup(NewStringValueGroup(variableName, weights, values), weights, variableName, audienceName)
+
+	return nil
+}
+
+func (b *advancedBuilder) AddJSON(variableName string, audienceName string, weights []uint32, values []json.RawMessage) error {
+	if err := b.preValidate(variableName, audienceName, weights, len(values)); err != nil {
+		return errors.Annotate(err, "could not add JSON")
+	}
+
+	b.setup(NewJSONValueGroup(variableName, weights, values), weights, variableName, audienceName)
+
+	return nil
+}
+
 func (b *advancedBuilder) AddConstraint(audienceName string, constraint *constraint.Constraint) error {
 	if constraint == nil {
 		return errors.Errorf("cannot add a nil constraint")
@@ -104,6 +131,28 @@ func (b *advancedBuilder) AddConstraint(audienceName string, constraint *constra
 	return errors.Errorf("could not find existing audience with name: %s", audienceName)
 }
 
+func (b *advancedBuilder) SetControl(variableName string, audienceName string, value *Value) error {
+	for _, audience := range b.Audiences {
+		if audience.Name != audienceName {
+			continue
+		}
+
+		valueGroup, ok := audience.ValueGroups[variableName]
+
+		if !ok {
+			break
+		}
+
+		if err := valueGroup.SetControl(value); err != nil {
+			return errors.Annotate(err, "could not set control value")
+		}
+
+		return nil
+	}
+
+	return errors.Errorf("could not find variable '%s' in audience '%s'", variableName, audienceName)
+}
+
 func (b *advancedBuilder) Build() (*Experiment, error) {
 	if postValidateErr := b.postValidate(); postValidateErr != nil {
 		return nil, errors.Annotate(postValidateErr, "could not build experiment")
@@ -1,5 +1,9 @@
 package experiment
 
+import (
+	"encoding/json"
+)
+
 const (
 	audienceName = "default_audience"
 )
@@ -9,6 +13,12 @@ type BasicBuilder interface {
 	AddFloats(variableName string, weights []uint32, values []float64) error
 	AddInts(variableName string, weights []uint32, values []int64) error
 	AddBools(variableName string, weights []uint32, values []bool) error
+	AddStrings(variableName string, weights []uint32, values []string) error
+	AddJSON(variableName string, weights []uint32, values []json.RawMessage) error
+
+	// SetControl sets the control value of a variable added before, which is otherwise its first value. See
+	// ValueGroup.SetControl.
+	SetControl(variableName string, value *Value) error
 }
 
 type basicBuilder struct {
@@ -48,6 +58,18 @@ func (b *basicBuilder) AddBools(variableName string, weights []uint32, values []
 	return b.AdvancedBuilder.AddBools(variableName, audienceName, weights, values)
 }
 
+func (b *basicBuilder) AddStrings(variableName string, weights []uint32, values []string) error {
+	return b.AdvancedBuilder.AddStrings(variableName, audienceName, weights, values)
+}
+
+func (b *basicBuilder) AddJSON(variableName string, weights []uint32, values []json.RawMessage) error {
+	return b.AdvancedBuilder.AddJSON(variableName, audienceName, weights, values)
+}
+
+func (b *basicBuilder) SetControl(variableName string, value *Value) error {
+	return b.AdvancedBuilder.SetControl(variableName, audienceName, value)
+}
+
 func (b *basicBuilder) Build() (*Experiment, error) {
 	return b.AdvancedBuilder.Build()
 }
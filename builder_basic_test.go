@@ -1,6 +1,7 @@
 package experiment
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -39,6 +40,12 @@ func testSimpleGetVariable(t *testing.T, config basicTestConfig) {
 	case Bool:
 		builder1.AddBools("variable_1", weights1, config.bools)
 		builder2.AddBools("variable_2", weights2, config.bools)
+	case String:
+		builder1.AddStrings("variable_1", weights1, config.strings)
+		builder2.AddStrings("variable_2", weights2, config.strings)
+	case JSON:
+		builder1.AddJSON("variable_1", weights1, config.json)
+		builder2.AddJSON("variable_2", weights2, config.json)
 	}
 
 	experiment1, eErr1 := builder1.Build()
@@ -72,6 +79,10 @@ func testSimpleGetVariable(t *testing.T, config basicTestConfig) {
 			assert.Equal(t, config.ints[config.numberWeights()-1], result2.Value.IntValue)
 		case Bool:
 			assert.Equal(t, config.bools[config.numberWeights()-1], result2.Value.BoolValue)
+		case String:
+			assert.Equal(t, config.strings[config.numberWeights()-1], result2.Value.StringValue)
+		case JSON:
+			assert.Equal(t, config.json[config.numberWeights()-1], result2.Value.JSONValue)
 		}
 	}
 	// A fake variable should return an error and nils for the result
@@ -101,6 +112,8 @@ func testReload(t *testing.T, builder BasicBuilder, variableName string) {
 			assert.Equal(t, firstValue.IntValue, result.Value.IntValue)
 			assert.Equal(t, firstValue.FloatValue, result.Value.FloatValue)
 			assert.Equal(t, firstValue.BoolValue, result.Value.BoolValue)
+			assert.Equal(t, firstValue.StringValue, result.Value.StringValue)
+			assert.Equal(t, firstValue.JSONValue, result.Value.JSONValue)
 		}
 	}
 }
@@ -236,6 +249,22 @@ func TestSimpleBools(t *testing.T) {
 	testSimpleGetVariable(t, config)
 }
 
+func TestSimpleStrings(t *testing.T) {
+	config := basicTestConfig{}
+	config.variableType = String
+	config.strings = []string{"Buy now", "Add to cart", "Checkout"}
+
+	testSimpleGetVariable(t, config)
+}
+
+func TestSimpleJSON(t *testing.T) {
+	config := basicTestConfig{}
+	config.variableType = JSON
+	config.json = []json.RawMessage{json.RawMessage(`{"steps":3}`), json.RawMessage(`{"steps":1,"express":true}`)}
+
+	testSimpleGetVariable(t, config)
+}
+
 func TestSimpleFullyDistributed(t *testing.T) {
 	floatValues := []float64{1.0, 2.0, 3.0}
 
@@ -293,6 +322,57 @@ func TestSimpleNoWeights(t *testing.T) {
 	assert.Nil(t, err1)
 }
 
+func TestSimpleControl(t *testing.T) {
+	// The control value, such as the value in production, need not be one of the tested values
+	builder := NewSimpleBuilder("experiment_1")
+	assert.Nil(t, builder.AddFloats("variable_1", []uint32{0, 0}, []float64{1.0, 2.0}))
+	assert.Nil(t, builder.SetControl("variable_1", NewFloatValue(5.0)))
+
+	experiment1, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, *NewFloatValue(5.0), experiment1.Audiences[0].ValueGroups["variable_1"].ControlValue)
+
+	service := NewService()
+	service.Reload([]Experiment{*experiment1})
+
+	result, err := service.GetVariable("variable_1", "some_user_id", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 5.0, result.Value.FloatValue)
+
+	// Aligned experiments take a control value per variable of every audience
+	advanced := NewAdvancedAlignedBuilder("experiment_2")
+	assert.Nil(t, advanced.AddInts("variable_1", "audience_1", []uint32{1, 1}, []int64{1, 2}))
+	assert.Nil(t, advanced.AddStrings("variable_2", "audience_1", []uint32{1, 1}, []string{"a", "b"}))
+	assert.Nil(t, advanced.AddInts("variable_1", "audience_2", []uint32{1, 1}, []int64{3, 4}))
+	assert.Nil(t, advanced.SetControl("variable_2", "audience_1", NewStringValue("c")))
+	assert.Nil(t, advanced.SetControl("variable_1", "audience_2", NewIntValue(5)))
+
+	experiment2, err := advanced.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, *NewIntValue(1), experiment2.Audiences[0].ValueGroups["variable_1"].ControlValue)
+	assert.Equal(t, *NewStringValue("c"), experiment2.Audiences[0].ValueGroups["variable_2"].ControlValue)
+	assert.Equal(t, *NewIntValue(5), experiment2.Audiences[1].ValueGroups["variable_1"].ControlValue)
+}
+
+func TestSimpleControlFail(t *testing.T) {
+	builder := NewSimpleBuilder("experiment_1")
+	assert.Nil(t, builder.AddFloats("variable_1", []uint32{1, 1}, []float64{1.0, 2.0}))
+
+	assert.NotNil(t, builder.SetControl("variable_1", NewIntValue(5)))
+	assert.NotNil(t, builder.SetControl("variable_1", nil))
+	assert.NotNil(t, builder.SetControl("variable_1", &Value{Type: "DECIMAL"}))
+	assert.NotNil(t, builder.SetControl("variable_2", NewFloatValue(5.0)))
+
+	// The control value is left as it was
+	experiment1, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, *NewFloatValue(1.0), experiment1.Audiences[0].ValueGroups["variable_1"].ControlValue)
+
+	advanced := NewAdvancedFactorialBuilder("experiment_2")
+	assert.Nil(t, advanced.AddBools("variable_1", "audience_1", []uint32{1, 1}, []bool{false, true}))
+	assert.NotNil(t, advanced.SetControl("variable_1", "audience_2", NewBoolValue(true)))
+}
+
 func TestSimpleFail(t *testing.T) {
 	builder1 := NewSimpleBuilder("experiment_1")
 	builder1.AddFloats("variable_1", []uint32{1}, []float64{1.0, 2.0, 3.0})
@@ -325,6 +405,8 @@ const (
 	Float variableType = iota
 	Int
 	Bool
+	String
+	JSON
 )
 
 // A struct to help generate tests
@@ -333,11 +415,15 @@ type basicTestConfig struct {
 	floats       []float64
 	ints         []int64
 	bools        []bool
+	strings      []string
+	json         []json.RawMessage
 }
 
 func (c *basicTestConfig) numberWeights() int {
 	maximum := maxInt(len(c.floats), len(c.ints))
-	return maxInt(maximum, len(c.bools))
+	maximum = maxInt(maximum, len(c.bools))
+	maximum = maxInt(maximum, len(c.strings))
+	return maxInt(maximum, len(c.json))
 }
 
 func maxInt(a int, b int) int {
@@ -0,0 +1,206 @@
+package experiment
+
+import (
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/sneakylocke/experiment/validation"
+	"reflect"
+)
+
+// EditExperiment returns a builder seeded from an existing experiment, such as a running one, to add audiences after
+// its audiences, add variables to its audiences or change weights. Every salt is kept, and an experiment whose value
+// groups all share its salt stays aligned. The experiment itself is not changed.
+//
+// Users must keep their values, so Build returns an error for every change that moves them between values:
+// changing a salt or which users an audience matches, lowering an exposure, or changing weights other than by moving
+// users out of values that shrink into values that grow, like Audience.PromoteValue and ValueGroup.Rebalance do.
+// Changing a weighted value itself, rather than its weight, is stable. Changes marked with Rerandomize are allowed.
+func EditExperiment(experiment *Experiment) ExperimentBuilder {
+	original := cloneExperiment(experiment)
+	seeded := cloneExperiment(experiment)
+
+	b := &experimentBuilder{}
+	b.experiment = *seeded
+	b.experiment.Audiences = nil
+	b.variableNames = seeded.VariableNames
+	b.original = original
+	b.aligned = isAligned(experiment)
+
+	for i := range seeded.Audiences {
+		audience := &seeded.Audiences[i]
+
+		a := &audienceBuilder{parent: b, path: validation.Index("audiences", i), audience: audience, order: valueGroupNames(audience)}
+		b.audiences = append(b.audiences, a)
+
+		if b.aligned && b.firstWeights == nil && len(a.order) > 0 {
+			b.firstWeights = weightsOf(audience.ValueGroups[a.order[0]])
+		}
+	}
+
+	return b
+}
+
+// weightsOf returns the weight of every weighted value of a value group, in order. EditExperiment keeps those of the
+// first value group of an aligned experiment so that variables added later get the same weights.
+func weightsOf(valueGroup *ValueGroup) []uint32 {
+	weights := make([]uint32, len(valueGroup.WeightedValues))
+
+	for i, value := range valueGroup.WeightedValues {
+		weights[i] = value.Weight
+	}
+
+	return weights
+}
+
+// checkStable records every change since the experiment being edited that moves users between values.
+func (b *experimentBuilder) checkStable(experiment *Experiment, problems *validation.Collector) {
+	if b.original == nil || b.rerandomize {
+		return
+	}
+
+	if experiment.Salt != b.original.Salt {
+		problems.Addf("salt", "changing the salt of the experiment re-randomizes every user")
+	}
+
+	// Audiences of the original experiment come first, in the same order
+	for i := range b.original.Audiences {
+		if b.audiences[i].rerandomize {
+			continue
+		}
+
+		before, after := &b.original.Audiences[i], &experiment.Audiences[i]
+		path := validation.Index("audiences", i)
+
+		if !sameMatching(before, after) {
+			problems.Addf(path, "changing which users audience '%s' matches moves users between audiences", before.Name)
+		}
+
+		if exposedShare(after.Exposure) < exposedShare(before.Exposure) {
+			problems.Addf(validation.Field(path, "exposure"), "lowering the exposure of audience '%s' moves users back to the control value", before.Name)
+		}
+
+		for _, name := range valueGroupNames(before) {
+			beforeGroup, afterGroup := before.ValueGroups[name], after.ValueGroups[name]
+			groupPath := validation.Field(validation.Field(path, "valueGroups"), name)
+
+			switch {
+			case afterGroup.Salt != beforeGroup.Salt:
+				problems.Addf(validation.Field(groupPath, "salt"), "changing the salt of '%s' re-randomizes its users", name)
+			case !stableAllocation(beforeGroup, afterGroup):
+				problems.Addf(validation.Field(groupPath, "weightedValues"), "the weights of '%s' move users between values that don't shrink and grow, see Promote", name)
+			}
+		}
+	}
+}
+
+// sameMatching tells if two versions of an audience match the same users.
+func sameMatching(a *Audience, b *Audience) bool {
+	sameSegments := len(a.Segments) == 0 && len(b.Segments) == 0 || reflect.DeepEqual(a.Segments, b.Segments)
+
+	return sameConstraints(a.Constraints, b.Constraints) && sameSegments && a.Expression == b.Expression && a.Enabled == b.Enabled
+}
+
+// sameConstraints tells if two lists of constraints are the same, comparing only the fields of a constraint that end
+// up in an experiment file.
+func sameConstraints(a []constraint.Constraint, b []constraint.Constraint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Key != b[i].Key || a[i].Operator != b[i].Operator || a[i].Missing != b[i].Missing || !reflect.DeepEqual(a[i].Value, b[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isAligned tells if every value group of an experiment shares its salt, as the aligned builders leave them.
+func isAligned(experiment *Experiment) bool {
+	found := false
+
+	for _, audience := range experiment.Audiences {
+		for _, valueGroup := range audience.ValueGroups {
+			if valueGroup.Salt != experiment.Salt {
+				return false
+			}
+
+			found = true
+		}
+	}
+
+	return found
+}
+
+// cloneExperiment returns a copy of an experiment that shares nothing with it but constraint values and raw JSON
+// values, which are never changed in place.
+func cloneExperiment(experiment *Experiment) *Experiment {
+	clone := *experiment
+	clone.VariableNames = cloneStrings(experiment.VariableNames)
+	clone.Winners = cloneWinners(experiment.Winners)
+
+	if experiment.Audiences != nil {
+		clone.Audiences = make([]Audience, len(experiment.Audiences))
+
+		for i := range experiment.Audiences {
+			clone.Audiences[i] = cloneAudience(&experiment.Audiences[i])
+		}
+	}
+
+	return &clone
+}
+
+func cloneAudience(audience *Audience) Audience {
+	clone := *audience
+	clone.Segments = cloneStrings(audience.Segments)
+
+	if audience.Constraints != nil {
+		clone.Constraints = append([]constraint.Constraint{}, audience.Constraints...)
+	}
+
+	if audience.ValueGroups != nil {
+		clone.ValueGroups = make(map[string]*ValueGroup, len(audience.ValueGroups))
+
+		for name, valueGroup := range audience.ValueGroups {
+			valueGroupClone := *valueGroup
+
+			if valueGroup.WeightedValues != nil {
+				valueGroupClone.WeightedValues = make([]WeightedValue, len(valueGroup.WeightedValues))
+
+				for i, value := range valueGroup.WeightedValues {
+					valueGroupClone.WeightedValues[i] = value
+
+					if value.Buckets != nil {
+						valueGroupClone.WeightedValues[i].Buckets = append([]BucketRange{}, value.Buckets...)
+					}
+				}
+			}
+
+			clone.ValueGroups[name] = &valueGroupClone
+		}
+	}
+
+	return clone
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	return append([]string{}, s...)
+}
+
+func cloneWinners(winners map[string]int) map[string]int {
+	if winners == nil {
+		return nil
+	}
+
+	clone := make(map[string]int, len(winners))
+
+	for name, index := range winners {
+		clone[name] = index
+	}
+
+	return clone
+}
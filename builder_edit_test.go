@@ -0,0 +1,179 @@
+package experiment
+
+import (
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func newEditExperiment(t *testing.T) *Experiment {
+	experiment, err := NewExperiment("checkout").
+		Audience("us").
+		Where("country", constraint.OPERATOR_EQ, "US").
+		Exposure(0.5).
+		Ints("price", []uint32{30, 30, 40}, []int64{10, 20, 30}).Salt("price_v1").
+		Done().
+		Audience("everyone").
+		Strings("button_text", []uint32{1, 1}, []string{"Buy", "Add"}).Buckets().
+		Done().
+		Build()
+
+	assert.Nil(t, err)
+
+	return experiment
+}
+
+func TestEditExperimentStable(t *testing.T) {
+	original := newEditExperiment(t)
+	before := cloneExperiment(original)
+
+	edited, err := EditExperiment(original).
+		Audience("us").
+		Promote(1, 50).
+		Bools("express", []uint32{1, 1}, []bool{false, true}).
+		Done().
+		Audience("everyone").
+		Weights("button_text", []uint32{3000, 7000}).
+		Done().
+		Audience("ca").
+		Where("country", constraint.OPERATOR_EQ, "CA").
+		Ints("price", []uint32{1}, []int64{15}).
+		Done().
+		Build()
+
+	assert.Nil(t, err)
+	assert.Equal(t, before, original, "the experiment edited is left as it was")
+
+	assert.Equal(t, "checkout", edited.Salt)
+	assert.Equal(t, []string{"price", "button_text", "express"}, edited.VariableNames)
+	assert.Equal(t, []string{"us", "everyone", "ca"}, []string{edited.Audiences[0].Name, edited.Audiences[1].Name, edited.Audiences[2].Name})
+	assert.Equal(t, "price_v1", edited.Audiences[0].ValueGroups["price"].Salt)
+	assert.Equal(t, []uint32{30, 50, 20}, weightsOf(edited.Audiences[0].ValueGroups["price"]))
+	assert.Equal(t, "express", edited.Audiences[0].ValueGroups["express"].Salt)
+	assert.Equal(t, []uint32{3000, 7000}, weightsOf(edited.Audiences[1].ValueGroups["button_text"]))
+
+	// Users only move into the value that grew
+	us := map[string]interface{}{"country": "US"}
+	beforeService, afterService := NewService(), NewService()
+	assert.Nil(t, beforeService.Reload([]Experiment{*original}))
+	assert.Nil(t, afterService.Reload([]Experiment{*edited}))
+
+	for i := 0; i < 1000; i++ {
+		userID := "user_" + strconv.Itoa(i)
+
+		beforeResult, err := beforeService.GetVariable("price", userID, constraint.NewMapContext(us))
+		assert.Nil(t, err)
+		afterResult, err := afterService.GetVariable("price", userID, constraint.NewMapContext(us))
+		assert.Nil(t, err)
+
+		if beforeResult.Value.IntValue != afterResult.Value.IntValue {
+			assert.Equal(t, int64(20), afterResult.Value.IntValue, userID)
+		}
+	}
+
+	// Raising the exposure only moves users out of the control value
+	_, err = EditExperiment(original).Audience("us").Exposure(0.8).Done().Build()
+	assert.Nil(t, err)
+}
+
+func TestEditExperimentUnstable(t *testing.T) {
+	original := newEditExperiment(t)
+
+	_, err := EditExperiment(original).
+		Salt("checkout_v2").
+		Audience("us").
+		Where("age", constraint.OPERATOR_GT, 18).
+		Exposure(0.25).
+		Weights("price", []uint32{1, 1, 1}).
+		Done().
+		Audience("everyone").
+		Weights("button_text", []uint32{100, 100}).
+		Done().
+		Build()
+
+	assert.Equal(t, []string{
+		"salt",
+		"audiences[0]",
+		"audiences[0].exposure",
+		"audiences[0].valueGroups.price.weightedValues",
+		"audiences[1].valueGroups.button_text.weightedValues", // Buckets given up move their users to the control value
+	}, problemPaths(err))
+
+	// Weights with the same sum can still swap users between values that don't change
+	_, err = EditExperiment(original).Audience("us").Weights("price", []uint32{40, 30, 30}).Done().Build()
+	assert.Equal(t, []string{"audiences[0].valueGroups.price.weightedValues"}, problemPaths(err))
+
+	_, err = EditExperiment(original).Audience("us").Weights("price", []uint32{20, 40, 40}).Done().Build()
+	assert.Nil(t, err)
+}
+
+func TestSameMatching(t *testing.T) {
+	before := &Audience{Constraints: []constraint.Constraint{*constraint.NewConstraint("country", constraint.OPERATOR_IN, []interface{}{"US", "CA"})}}
+	after := &Audience{Constraints: []constraint.Constraint{*constraint.NewConstraint("country", constraint.OPERATOR_IN, []interface{}{"US", "CA"})}}
+	assert.True(t, sameMatching(before, after))
+
+	after.Constraints[0].Missing = constraint.MISSING_PASS
+	assert.False(t, sameMatching(before, after))
+
+	after.Constraints[0].Missing = ""
+	after.Constraints[0].Value = []interface{}{"US"}
+	assert.False(t, sameMatching(before, after))
+
+	// No constraints at all, however they are written
+	assert.True(t, sameMatching(&Audience{}, &Audience{Constraints: []constraint.Constraint{}}))
+}
+
+func TestEditExperimentRerandomize(t *testing.T) {
+	original := newEditExperiment(t)
+
+	edited, err := EditExperiment(original).
+		Rerandomize().
+		Salt("checkout_v2").
+		Audience("us").Exposure(0.1).Done().
+		Build()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "checkout_v2", edited.Salt)
+
+	// Only the audience marked may change
+	_, err = EditExperiment(original).
+		Audience("us").Rerandomize().Exposure(0.1).Weights("price", []uint32{1, 1, 1}).Done().
+		Audience("everyone").Enabled(false).Done().
+		Build()
+
+	assert.Equal(t, []string{"audiences[1]"}, problemPaths(err))
+}
+
+func TestEditExperimentAligned(t *testing.T) {
+	original, err := NewExperiment("aligned").
+		Aligned().
+		Audience("everyone").
+		Ints("a", []uint32{1, 2}, []int64{1, 2}).
+		Done().
+		Build()
+
+	assert.Nil(t, err)
+
+	edited, err := EditExperiment(original).
+		Audience("everyone").
+		Bools("b", []uint32{1, 2}, []bool{false, true}).
+		Promote(0, 2).
+		Done().
+		Build()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "aligned", edited.Audiences[0].ValueGroups["b"].Salt)
+	assert.Equal(t, []uint32{2, 1}, weightsOf(edited.Audiences[0].ValueGroups["a"]))
+	assert.Equal(t, []uint32{2, 1}, weightsOf(edited.Audiences[0].ValueGroups["b"]))
+
+	_, err = EditExperiment(original).
+		Aligned().
+		Audience("everyone").
+		Ints("c", []uint32{1, 1}, []int64{1, 2}).
+		Weights("a", []uint32{2, 1}).
+		Done().
+		Build()
+
+	assert.Equal(t, []string{"", "audiences[0].valueGroups.c.weightedValues", "audiences[0].valueGroups.a.weightedValues"}, problemPaths(err))
+}
@@ -0,0 +1,404 @@
+package experiment
+
+import (
+	"encoding/json"
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/sneakylocke/experiment/validation"
+)
+
+// ExperimentBuilder builds an experiment with chained calls, audience by audience:
+//
+//	experiment, err := NewExperiment("checkout").
+//		Audience("us").Where("country", constraint.OPERATOR_EQ, "US").Exposure(0.2).
+//		Floats("price", []uint32{1, 1}, []float64{9.99, 7.99}).Control(NewFloatValue(9.99)).
+//		Done().
+//		Build()
+//
+// Mistakes don't stop the chain: they are collected and Build returns all of them together with the problems found
+// validating the experiment, as validation.Errors.
+type ExperimentBuilder interface {
+	Salt(salt string) ExperimentBuilder     // Defaults to the name of the experiment
+	Enabled(enabled bool) ExperimentBuilder // Defaults to true
+	Status(status STATUS) ExperimentBuilder // Defaults to no status
+	Winner(variableName string, index int) ExperimentBuilder
+	Variables(variableNames ...string) ExperimentBuilder // Defaults to the variables of every audience, in order
+	Aligned() ExperimentBuilder                          // Variables of an audience share weights and salt, see NewAdvancedAlignedBuilder
+	Rerandomize() ExperimentBuilder                      // Allows every change of an edit, see EditExperiment
+	Audience(name string) AudienceBuilder                // Adds an audience, or continues one added before
+	Build() (*Experiment, error)
+}
+
+// AudienceBuilder builds an audience of an ExperimentBuilder. Audiences are matched in the order they were added.
+// Control, Salt and Buckets apply to the variable added last, while Weights and Promote also apply to variables of
+// an experiment being edited.
+type AudienceBuilder interface {
+	Where(key string, operator constraint.OPERATOR, value interface{}) AudienceBuilder
+	Constraint(c constraint.Constraint) AudienceBuilder
+	Segments(references ...string) AudienceBuilder
+	Expression(expression string) AudienceBuilder
+	Exposure(exposure float64) AudienceBuilder // Defaults to 1
+	Enabled(enabled bool) AudienceBuilder      // Defaults to true
+
+	Floats(variableName string, weights []uint32, values []float64) AudienceBuilder
+	Ints(variableName string, weights []uint32, values []int64) AudienceBuilder
+	Bools(variableName string, weights []uint32, values []bool) AudienceBuilder
+	Strings(variableName string, weights []uint32, values []string) AudienceBuilder
+	JSON(variableName string, weights []uint32, values []json.RawMessage) AudienceBuilder
+
+	Control(value *Value) AudienceBuilder // Defaults to the first value, see ValueGroup.SetControl
+	Salt(salt string) AudienceBuilder     // Defaults to the name of the variable, not allowed in aligned experiments
+	Buckets() AudienceBuilder             // Allocates buckets, see ValueGroup.AllocateBuckets
+
+	Weights(variableName string, weights []uint32) AudienceBuilder // Rebalances buckets when allocated, see ValueGroup.Rebalance
+	Promote(index int, weight uint32) AudienceBuilder              // See Audience.PromoteValue
+	Rerandomize() AudienceBuilder                                  // Allows every change to the audience in an edit, see EditExperiment
+
+	Done() ExperimentBuilder
+}
+
+type experimentBuilder struct {
+	experiment        Experiment
+	audiences         []*audienceBuilder
+	variableNames     []string // Variables of the experiment edited and those set by Variables
+	explicitVariables bool     // Whether Variables was called, otherwise variables are collected from the audiences
+	aligned           bool
+	firstWeights      []uint32    // Weights every variable must have in aligned experiments
+	original          *Experiment // Experiment being edited, nil for new experiments
+	rerandomize       bool
+	problems          validation.Collector
+}
+
+type audienceBuilder struct {
+	parent      *experimentBuilder
+	path        string
+	audience    *Audience
+	last        *ValueGroup // Value group added last, not part of the audience if it could not be added
+	lastPath    string
+	order       []string // Names of the variables in the order they were added
+	rerandomize bool
+}
+
+// NewExperiment returns a builder of an enabled experiment named name.
+func NewExperiment(name string) ExperimentBuilder {
+	b := &experimentBuilder{}
+	b.experiment.Name = name
+	b.experiment.Salt = name
+	b.experiment.Enabled = true
+
+	return b
+}
+
+func (b *experimentBuilder) Salt(salt string) ExperimentBuilder {
+	b.experiment.Salt = salt
+	return b
+}
+
+func (b *experimentBuilder) Enabled(enabled bool) ExperimentBuilder {
+	b.experiment.Enabled = enabled
+	return b
+}
+
+func (b *experimentBuilder) Status(status STATUS) ExperimentBuilder {
+	b.experiment.Status = status
+	return b
+}
+
+func (b *experimentBuilder) Winner(variableName string, index int) ExperimentBuilder {
+	if b.experiment.Winners == nil {
+		b.experiment.Winners = make(map[string]int)
+	}
+
+	b.experiment.Winners[variableName] = index
+	return b
+}
+
+func (b *experimentBuilder) Variables(variableNames ...string) ExperimentBuilder {
+	b.variableNames = append(b.variableNames, variableNames...)
+	b.explicitVariables = true
+	return b
+}
+
+func (b *experimentBuilder) Aligned() ExperimentBuilder {
+	if len(b.audiences) > 0 {
+		b.problems.Addf("", "experiments must be made aligned before adding audiences")
+	}
+
+	b.aligned = true
+	return b
+}
+
+func (b *experimentBuilder) Rerandomize() ExperimentBuilder {
+	b.rerandomize = true
+	return b
+}
+
+func (b *experimentBuilder) Audience(name string) AudienceBuilder {
+	for _, audience := range b.audiences {
+		if audience.audience.Name == name {
+			return audience
+		}
+	}
+
+	audience := NewAudience()
+	audience.Name = name
+
+	a := &audienceBuilder{parent: b, path: validation.Index("audiences", len(b.audiences)), audience: audience}
+	b.audiences = append(b.audiences, a)
+
+	return a
+}
+
+// Build returns the experiment, or validation.Errors holding every mistake made building it, every error with the
+// experiment itself and, for builders returned by EditExperiment, every change that is not stable. The builder can
+// still be used after Build.
+func (b *experimentBuilder) Build() (*Experiment, error) {
+	experiment := b.experiment
+	experiment.Audiences = make([]Audience, 0, len(b.audiences))
+	experiment.VariableNames = cloneStrings(b.variableNames)
+	experiment.Winners = cloneWinners(b.experiment.Winners)
+
+	seen := make(map[string]bool)
+
+	for _, name := range experiment.VariableNames {
+		seen[name] = true
+	}
+
+	if experiment.VariableNames == nil {
+		experiment.VariableNames = []string{}
+	}
+
+	for _, a := range b.audiences {
+		// Copied so that the builder can keep being used without changing the experiment
+		audience := cloneAudience(a.audience)
+
+		// Aligned experiments need the value group salt to be the same
+		if b.aligned {
+			for _, valueGroup := range audience.ValueGroups {
+				valueGroup.Salt = experiment.Salt
+			}
+		}
+
+		experiment.Audiences = append(experiment.Audiences, audience)
+
+		for _, name := range a.order {
+			if !b.explicitVariables && !seen[name] {
+				seen[name] = true
+				experiment.VariableNames = append(experiment.VariableNames, name)
+			}
+		}
+	}
+
+	problems := &validation.Collector{}
+	problems.Add("", b.problems.Err())
+	experiment.validate(problems, constraint.MISSING_FAIL)
+	b.checkStable(&experiment, problems)
+
+	if err := problems.Err(); err != nil {
+		return nil, err
+	}
+
+	return &experiment, nil
+}
+
+func (a *audienceBuilder) Where(key string, operator constraint.OPERATOR, value interface{}) AudienceBuilder {
+	return a.Constraint(*constraint.NewConstraint(key, operator, value))
+}
+
+func (a *audienceBuilder) Constraint(c constraint.Constraint) AudienceBuilder {
+	a.audience.Constraints = append(a.audience.Constraints, c)
+	return a
+}
+
+func (a *audienceBuilder) Segments(references ...string) AudienceBuilder {
+	a.audience.Segments = append(a.audience.Segments, references...)
+	return a
+}
+
+func (a *audienceBuilder) Expression(expression string) AudienceBuilder {
+	a.audience.Expression = expression
+	return a
+}
+
+func (a *audienceBuilder) Exposure(exposure float64) AudienceBuilder {
+	a.audience.Exposure = exposure
+	return a
+}
+
+func (a *audienceBuilder) Enabled(enabled bool) AudienceBuilder {
+	a.audience.Enabled = enabled
+	return a
+}
+
+func (a *audienceBuilder) Floats(variableName string, weights []uint32, values []float64) AudienceBuilder {
+	if a.check(variableName, weights, len(values)) {
+		a.add(NewFloatValueGroup(variableName, weights, values))
+	}
+
+	return a
+}
+
+func (a *audienceBuilder) Ints(variableName string, weights []uint32, values []int64) AudienceBuilder {
+	if a.check(variableName, weights, len(values)) {
+		a.add(NewIntValueGroup(variableName, weights, values))
+	}
+
+	return a
+}
+
+func (a *audienceBuilder) Bools(variableName string, weights []uint32, values []bool) AudienceBuilder {
+	if a.check(variableName, weights, len(values)) {
+		a.add(NewBoolValueGroup(variableName, weights, values))
+	}
+
+	return a
+}
+
+func (a *audienceBuilder) Strings(variableName string, weights []uint32, values []string) AudienceBuilder {
+	if a.check(variableName, weights, len(values)) {
+		a.add(NewStringValueGroup(variableName, weights, values))
+	}
+
+	return a
+}
+
+func (a *audienceBuilder) JSON(variableName string, weights []uint32, values []json.RawMessage) AudienceBuilder {
+	if a.check(variableName, weights, len(values)) {
+		a.add(NewJSONValueGroup(variableName, weights, values))
+	}
+
+	return a
+}
+
+func (a *audienceBuilder) Control(value *Value) AudienceBuilder {
+	if a.last == nil {
+		a.parent.problems.Addf(a.path, "control value set before adding a variable")
+		return a
+	}
+
+	a.parent.problems.Add(validation.Field(a.lastPath, "controlValue"), a.last.SetControl(value))
+	return a
+}
+
+func (a *audienceBuilder) Salt(salt string) AudienceBuilder {
+	if a.last == nil {
+		a.parent.problems.Addf(a.path, "salt set before adding a variable")
+		return a
+	}
+
+	if a.parent.aligned {
+		a.parent.problems.Addf(validation.Field(a.lastPath, "salt"), "variables of aligned experiments share the salt of the experiment")
+		return a
+	}
+
+	a.last.Salt = salt
+	return a
+}
+
+func (a *audienceBuilder) Buckets() AudienceBuilder {
+	if a.last == nil {
+		a.parent.problems.Addf(a.path, "buckets allocated before adding a variable")
+		return a
+	}
+
+	if err := a.last.AllocateBuckets(); err != nil {
+		a.parent.problems.Add(validation.Field(a.lastPath, "allocation"), err)
+	}
+
+	return a
+}
+
+func (a *audienceBuilder) Weights(variableName string, weights []uint32) AudienceBuilder {
+	path := validation.Field(validation.Field(a.path, "valueGroups"), variableName)
+	valueGroup, ok := a.audience.ValueGroups[variableName]
+
+	switch {
+	case !ok:
+		a.parent.problems.Addf(path, "could not find variable '%s'", variableName)
+	case a.parent.aligned:
+		a.parent.problems.Addf(validation.Field(path, "weightedValues"), "weights of aligned experiments change for every variable at once, with Promote")
+	case len(weights) != len(valueGroup.WeightedValues):
+		a.parent.problems.Addf(validation.Field(path, "weightedValues"), "expected %d weights, got %d", len(valueGroup.WeightedValues), len(weights))
+	case valueGroup.Allocation == ALLOCATION_BUCKETS:
+		a.parent.problems.Add(validation.Field(path, "weightedValues"), valueGroup.Rebalance(weights))
+	default:
+		for i, weight := range weights {
+			valueGroup.WeightedValues[i].Weight = weight
+		}
+	}
+
+	return a
+}
+
+func (a *audienceBuilder) Promote(index int, weight uint32) AudienceBuilder {
+	a.parent.problems.Add(a.path, a.audience.PromoteValue(index, weight))
+	return a
+}
+
+func (a *audienceBuilder) Rerandomize() AudienceBuilder {
+	a.rerandomize = true
+	return a
+}
+
+func (a *audienceBuilder) Done() ExperimentBuilder {
+	return a.parent
+}
+
+// check records what is wrong with adding a variable, keeping the rules of the advanced builders, and tells if it
+// can be added.
+func (a *audienceBuilder) check(variableName string, weights []uint32, numberValues int) bool {
+	b := a.parent
+	path := validation.Field(validation.Field(a.path, "valueGroups"), variableName)
+	ok := true
+
+	// Later calls configure a value group that is thrown away rather than the one set before
+	a.last, a.lastPath = &ValueGroup{Name: variableName}, path
+
+	if _, found := a.audience.ValueGroups[variableName]; found {
+		b.problems.Addf(path, "cannot set the same variable twice")
+		ok = false
+	}
+
+	if len(a.audience.ValueGroups)+1 > maximumVariables {
+		b.problems.Addf(path, "an audience can have at most %d variables", maximumVariables)
+		ok = false
+	}
+
+	if len(weights) != numberValues || len(weights) == 0 {
+		b.problems.Addf(path, "expected as many weights as values, got %d weights and %d values", len(weights), numberValues)
+		return false
+	}
+
+	if b.aligned {
+		if b.firstWeights == nil {
+			b.firstWeights = weights
+		} else if !sameWeights(b.firstWeights, weights) {
+			b.problems.Addf(validation.Field(path, "weightedValues"), "aligned experiments should have the same weights")
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func (a *audienceBuilder) add(valueGroup *ValueGroup) {
+	// Set control value to first element
+	valueGroup.ControlValue = valueGroup.WeightedValues[0].Value
+
+	a.audience.ValueGroups[valueGroup.Name] = valueGroup
+	a.order = append(a.order, valueGroup.Name)
+	a.last = valueGroup
+}
+
+func sameWeights(a []uint32, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
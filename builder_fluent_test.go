@@ -0,0 +1,127 @@
+package experiment
+
+import (
+	"encoding/json"
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/sneakylocke/experiment/validation"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFluentBuilder(t *testing.T) {
+	experiment, err := NewExperiment("checkout").
+		Salt("checkout_v1").
+		Status(STATUS_RUNNING).
+		Audience("us").
+		Where("country", constraint.OPERATOR_EQ, "US").
+		Segments("beta@1").
+		Exposure(0.2).
+		Floats("price", []uint32{1, 1}, []float64{9.99, 7.99}).Control(NewFloatValue(9.99)).Salt("price_v2").
+		Strings("button_text", []uint32{1, 3}, []string{"Buy", "Add"}).
+		Done().
+		Audience("everyone").
+		Enabled(false).
+		JSON("config", []uint32{1}, []json.RawMessage{json.RawMessage(`{"steps":3}`)}).Buckets().
+		Done().
+		Build()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "checkout", experiment.Name)
+	assert.Equal(t, "checkout_v1", experiment.Salt)
+	assert.Equal(t, STATUS_RUNNING, experiment.Status)
+	assert.True(t, experiment.Enabled)
+	assert.Equal(t, []string{"price", "button_text", "config"}, experiment.VariableNames)
+	assert.Len(t, experiment.Audiences, 2)
+
+	us := experiment.Audiences[0]
+	assert.Equal(t, "us", us.Name)
+	assert.Equal(t, []constraint.Constraint{*constraint.NewConstraint("country", constraint.OPERATOR_EQ, "US")}, us.Constraints)
+	assert.Equal(t, []string{"beta@1"}, us.Segments)
+	assert.Equal(t, 0.2, us.Exposure)
+	assert.True(t, us.Enabled)
+	assert.Equal(t, "price_v2", us.ValueGroups["price"].Salt)
+	assert.Equal(t, *NewFloatValue(9.99), us.ValueGroups["price"].ControlValue)
+	assert.Equal(t, "button_text", us.ValueGroups["button_text"].Salt)
+	assert.Equal(t, *NewStringValue("Buy"), us.ValueGroups["button_text"].ControlValue)
+
+	everyone := experiment.Audiences[1]
+	assert.False(t, everyone.Enabled)
+	assert.Equal(t, ALLOCATION_BUCKETS, everyone.ValueGroups["config"].Allocation)
+	assert.Equal(t, uint32(BucketCount), everyone.ValueGroups["config"].WeightedValues[0].Weight)
+}
+
+func TestFluentBuilderAligned(t *testing.T) {
+	experiment, err := NewExperiment("aligned").
+		Aligned().
+		Audience("everyone").
+		Ints("a", []uint32{1, 2}, []int64{1, 2}).
+		Bools("b", []uint32{1, 2}, []bool{false, true}).
+		Done().
+		Build()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "aligned", experiment.Audiences[0].ValueGroups["a"].Salt)
+	assert.Equal(t, "aligned", experiment.Audiences[0].ValueGroups["b"].Salt)
+
+	_, err = NewExperiment("aligned").
+		Aligned().
+		Audience("everyone").
+		Ints("a", []uint32{1, 2}, []int64{1, 2}).
+		Ints("b", []uint32{2, 1}, []int64{1, 2}).Salt("b").
+		Done().
+		Build()
+
+	assert.Equal(t, []string{"audiences[0].valueGroups.b.weightedValues", "audiences[0].valueGroups.b.salt"}, problemPaths(err))
+}
+
+func TestFluentBuilderCollectsErrors(t *testing.T) {
+	_, err := NewExperiment("broken").
+		Audience("us").
+		Control(NewIntValue(1)).
+		Floats("price", []uint32{1, 1}, []float64{1}).
+		Ints("count", []uint32{1}, []int64{1}).
+		Ints("count", []uint32{1}, []int64{2}).Control(NewIntValue(2)).
+		Strings("label", []uint32{1}, []string{"a"}).Control(NewIntValue(2)).
+		Exposure(1.5).
+		Done().
+		Build()
+
+	assert.Equal(t, []string{
+		"audiences[0]",
+		"audiences[0].valueGroups.price",
+		"audiences[0].valueGroups.count",
+		"audiences[0].valueGroups.label.controlValue",
+		"audiences[0].exposure",
+	}, problemPaths(err))
+
+	_, err = NewExperiment("").Build()
+	assert.Equal(t, []string{"name", "salt", "variableNames", "audiences"}, problemPaths(err))
+}
+
+func TestFluentBuilderReuse(t *testing.T) {
+	builder := NewExperiment("reuse")
+	builder.Audience("everyone").Ints("a", []uint32{1}, []int64{1})
+
+	first, err := builder.Build()
+	assert.Nil(t, err)
+
+	builder.Audience("everyone").Where("country", constraint.OPERATOR_EQ, "US").Ints("b", []uint32{1}, []int64{1})
+
+	second, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Empty(t, first.Audiences[0].Constraints)
+	assert.Len(t, first.Audiences[0].ValueGroups, 1)
+	assert.Equal(t, []string{"a"}, first.VariableNames)
+	assert.Len(t, second.Audiences[0].Constraints, 1)
+	assert.Equal(t, []string{"a", "b"}, second.VariableNames)
+}
+
+func problemPaths(err error) []string {
+	var paths []string
+
+	for _, problem := range validation.Problems(err) {
+		paths = append(paths, problem.Path)
+	}
+
+	return paths
+}
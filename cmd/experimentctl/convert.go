@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// runConvert converts an experiment file between JSON and YAML, or from TOML. The format of the file is told by its
+// extension:
+//
+//	experimentctl convert -to yaml -out checkout.yaml checkout.json
+func runConvert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	to := flags.String("to", "yaml", "format to convert to, json or yaml; toml files can be read but not written")
+	out := flags.String("out", "", "file to write, defaults to standard output")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: experimentctl convert [-to json|yaml] [-out file] experiment-file\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one experiment file")
+	}
+
+	from, err := experiment.FormatOf(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(flags.Arg(0))
+
+	if err != nil {
+		return errors.Annotatef(err, "could not read '%s'", flags.Arg(0))
+	}
+
+	data, err = experiment.ConvertExperiment(data, from, strings.ToUpper(*to))
+
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(*out, data, 0644)
+}
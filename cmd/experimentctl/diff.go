@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment"
+	"github.com/sneakylocke/experiment/constraint"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// runDiff prints what changes for users between two versions of a set of experiments, each given as an experiment
+// file or a directory of them. Given a JSON array of contexts, synthetic users are matched to audiences with them:
+//
+//	experimentctl diff -contexts contexts.json -segments segments.json main/experiments experiments
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	samples := flags.Int("samples", experiment.DefaultDiffSamples, "number of synthetic users evaluated per variable")
+	contextsPath := flags.String("contexts", "", "JSON file with an array of contexts given to the synthetic users in turn")
+	segmentsPath := flags.String("segments", "", "JSON file with an array of the segments experiments refer to, used with -contexts")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: experimentctl diff [-samples n] [-contexts file [-segments file]] before after\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("expected two experiment files or directories")
+	}
+
+	before, err := loadSnapshot(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	after, err := loadSnapshot(flags.Arg(1))
+
+	if err != nil {
+		return err
+	}
+
+	var segments []experiment.Segment
+	var contexts []constraint.Context
+
+	if *segmentsPath != "" {
+		if err := readJSONFile(*segmentsPath, &segments); err != nil {
+			return err
+		}
+	}
+
+	if *contextsPath != "" {
+		var documents []map[string]interface{}
+
+		if err := readJSONFile(*contextsPath, &documents); err != nil {
+			return err
+		}
+
+		for _, document := range documents {
+			contexts = append(contexts, constraint.NewMapContext(document))
+		}
+	}
+
+	diff, err := experiment.DiffExperimentsWithContexts(before, after, *samples, segments, contexts)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(os.Stdout, diff.String())
+	return err
+}
+
+// loadSnapshot loads an experiment file, or every experiment file of a directory in name order.
+func loadSnapshot(path string) ([]experiment.Experiment, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, errors.Annotatef(err, "could not read '%s'", path)
+	}
+
+	if !info.IsDir() {
+		return experiment.LoadExperimentFiles([]string{path})
+	}
+
+	entries, err := ioutil.ReadDir(path)
+
+	if err != nil {
+		return nil, errors.Annotatef(err, "could not list experiment files in '%s'", path)
+	}
+
+	var paths []string
+
+	// Sorted by name already
+	for _, entry := range entries {
+		if _, err := experiment.FormatOf(entry.Name()); err == nil && !entry.IsDir() {
+			paths = append(paths, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	return experiment.LoadExperimentFiles(paths)
+}
+
+// readJSONFile decodes a JSON file into v.
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return errors.Annotatef(err, "could not read '%s'", path)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Annotatef(err, "could not decode '%s'", path)
+	}
+
+	return nil
+}
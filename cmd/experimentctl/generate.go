@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment"
+	"github.com/sneakylocke/experiment/codegen"
+	"io/ioutil"
+	"os"
+)
+
+// runGenerate writes a Go package with typed accessors for the variables of the experiment files. It is meant to be
+// used from a go:generate directive, in which case the package name defaults to the package of the directive:
+//
+//	//go:generate go run github.com/sneakylocke/experiment/cmd/experimentctl generate -out experiments_gen.go experiments/checkout.json
+func runGenerate(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	packageName := flags.String("package", os.Getenv("GOPACKAGE"), "name of the generated package, defaults to $GOPACKAGE")
+	out := flags.String("out", "", "file to write, defaults to standard output")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: experimentctl generate [-package name] [-out file] experiment-file...\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no experiment files given")
+	}
+
+	experiments, err := experiment.LoadExperimentFiles(flags.Args())
+
+	if err != nil {
+		return err
+	}
+
+	source, err := codegen.Generate(*packageName, experiments)
+
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(source)
+		return err
+	}
+
+	return ioutil.WriteFile(*out, source, 0644)
+}
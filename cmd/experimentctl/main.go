@@ -0,0 +1,61 @@
+// Command experimentctl works with experiment files.
+//
+// Usage:
+//
+//	experimentctl <command> [arguments]
+//
+// The commands are:
+//
+//	generate    write typed accessors for the variables of experiment files
+//	diff        show what changes for users between two versions of experiment files
+//	schema      write the JSON Schema of experiment files
+//	convert     convert JSON, YAML or TOML experiment files to JSON or YAML
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"generate", "write typed accessors for the variables of experiment files", runGenerate},
+	{"diff", "show what changes for users between two versions of experiment files", runDiff},
+	{"schema", "write the JSON Schema of experiment files", runSchema},
+	{"convert", "convert JSON, YAML or TOML experiment files to JSON or YAML", runConvert},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "experimentctl %s: %s\n", c.name, err)
+				os.Exit(1)
+			}
+
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "experimentctl: unknown command '%s'\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: experimentctl <command> [arguments]\n\ncommands:\n")
+
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s  %s\n", c.name, c.description)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sneakylocke/experiment/schema"
+	"io/ioutil"
+	"os"
+)
+
+// runSchema writes the JSON Schema of experiment files.
+func runSchema(args []string) error {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	out := flags.String("out", "", "file to write, defaults to standard output")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: experimentctl schema [-out file]\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := schema.Generate()
+
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(*out, data, 0644)
+}
@@ -0,0 +1,364 @@
+// Package codegen writes Go source with a typed accessor for every variable of a set of experiments, so that a
+// misspelled variable name is a compile error rather than an error at runtime.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// variable is a variable name along with the type of its values and where they were found.
+type variable struct {
+	name      string
+	valueType experiment.VALUE_TYPE
+	sources   map[experiment.VALUE_TYPE][]string // Value groups without a type are under ""
+	untyped   []experiment.Value                 // Values of the value groups without a type
+}
+
+// Generate returns gofmt'd Go source for a package with constants for the names of the experiments, audiences and
+// variables, and one function per variable that evaluates it with the typed getter for its values. Values without a
+// type are read as the type of their payload, see Value.CanReadAs. Generation fails when a variable has values of
+// different types or payloads that fit more than one type, or when two names map to the same Go identifier.
+func Generate(packageName string, experiments []experiment.Experiment) ([]byte, error) {
+	if packageName == "" {
+		return nil, errors.New("package name must be specified")
+	}
+
+	variables, err := collectVariables(experiments)
+
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{identifiers: make(map[string]string)}
+
+	if err := g.write(packageName, experiments, variables); err != nil {
+		return nil, err
+	}
+
+	source, err := format.Source(g.buffer.Bytes())
+
+	if err != nil {
+		return nil, errors.Annotate(err, "could not format generated source")
+	}
+
+	return source, nil
+}
+
+// collectVariables finds the type of every variable, sorted by name.
+func collectVariables(experiments []experiment.Experiment) ([]*variable, error) {
+	variableMap := make(map[string]*variable)
+
+	for _, e := range experiments {
+		for _, name := range e.VariableNames {
+			if _, ok := variableMap[name]; !ok {
+				variableMap[name] = &variable{name: name, sources: make(map[experiment.VALUE_TYPE][]string)}
+			}
+		}
+
+		for _, audience := range e.Audiences {
+			for name, valueGroup := range audience.ValueGroups {
+				v, ok := variableMap[name]
+
+				if !ok {
+					v = &variable{name: name, sources: make(map[experiment.VALUE_TYPE][]string)}
+					variableMap[name] = v
+				}
+
+				if len(valueGroup.WeightedValues) == 0 {
+					continue
+				}
+
+				// Validation ensures every value of a group is of the type of its first weighted value
+				valueType := valueGroup.WeightedValues[0].Value.Type
+				v.sources[valueType] = append(v.sources[valueType], e.Name+"/"+audience.Name)
+
+				if valueType == "" {
+					v.untyped = append(v.untyped, valueGroup.ControlValue)
+
+					for _, weightedValue := range valueGroup.WeightedValues {
+						v.untyped = append(v.untyped, weightedValue.Value)
+					}
+				}
+			}
+		}
+	}
+
+	variables := make([]*variable, 0, len(variableMap))
+
+	for _, v := range variableMap {
+		variables = append(variables, v)
+	}
+
+	sort.Slice(variables, func(i, j int) bool { return variables[i].name < variables[j].name })
+
+	// In name order so the same experiments always fail with the same error
+	for _, v := range variables {
+		if err := v.resolveType(); err != nil {
+			return nil, err
+		}
+	}
+
+	return variables, nil
+}
+
+// untypedTypes are the types a value without a type may be read as, FLOAT first since it is the type of values
+// whose payloads are all empty.
+var untypedTypes = []experiment.VALUE_TYPE{experiment.VALUE_TYPE_FLOAT, experiment.VALUE_TYPE_INT, experiment.VALUE_TYPE_BOOL}
+
+// resolveType picks the type of the variable. Values without a type take the type every one of their payloads can
+// be read as, or the type of the typed values of the variable. Payloads that are all empty can be read as any type
+// and are read as floats.
+func (v *variable) resolveType() error {
+	types := make([]string, 0, len(v.sources))
+
+	for valueType := range v.sources {
+		if valueType != "" {
+			types = append(types, valueType)
+		}
+	}
+
+	sort.Strings(types)
+
+	if len(v.sources) == 0 {
+		return errors.Errorf("variable '%s' has no values", v.name)
+	}
+
+	if len(types) > 1 {
+		return v.conflictingTypes()
+	}
+
+	if len(v.untyped) == 0 {
+		v.valueType = types[0]
+		return nil
+	}
+
+	// The types every value without a type can be read as
+	var readableAs []experiment.VALUE_TYPE
+
+	for _, valueType := range untypedTypes {
+		readable := true
+
+		for i := range v.untyped {
+			readable = readable && v.untyped[i].CanReadAs(valueType)
+		}
+
+		if readable {
+			readableAs = append(readableAs, valueType)
+		}
+	}
+
+	untypedSources := strings.Join(v.sources[""], ", ")
+
+	switch {
+	case len(types) == 1:
+		for _, valueType := range readableAs {
+			if valueType == types[0] {
+				v.valueType = valueType
+				return nil
+			}
+		}
+
+		return v.conflictingTypes()
+	case len(readableAs) == 0:
+		return errors.Errorf("variable '%s' has values without a type holding payloads of different types in %s", v.name, untypedSources)
+	case len(readableAs) == 1 || len(readableAs) == len(untypedTypes):
+		v.valueType = readableAs[0]
+		return nil
+	default:
+		return errors.Errorf("variable '%s' has values without a type holding payloads of more than one type in %s", v.name, untypedSources)
+	}
+}
+
+// conflictingTypes returns the error for a variable with values of different types.
+func (v *variable) conflictingTypes() error {
+	types := make([]string, 0, len(v.sources))
+
+	for valueType := range v.sources {
+		types = append(types, valueType)
+	}
+
+	sort.Strings(types)
+
+	descriptions := make([]string, len(types))
+	for i, valueType := range types {
+		name := valueType
+		if name == "" {
+			name = "untyped"
+		}
+
+		descriptions[i] = fmt.Sprintf("%s in %s", name, strings.Join(v.sources[valueType], ", "))
+	}
+
+	return errors.Errorf("variable '%s' has conflicting types: %s", v.name, strings.Join(descriptions, "; "))
+}
+
+type generator struct {
+	buffer      bytes.Buffer
+	identifiers map[string]string // Generated identifiers and the names they came from
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buffer, format, args...)
+}
+
+// identifier returns the Go identifier for a name, failing if another name already produced it.
+func (g *generator) identifier(prefix string, name string, description string) (string, error) {
+	id := prefix + camelCase(name)
+
+	if id == "" || !unicode.IsLetter([]rune(id)[0]) {
+		id = "X" + id
+	}
+
+	if previous, ok := g.identifiers[id]; ok {
+		return "", errors.Errorf("%s and %s both generate the identifier %s", previous, description, id)
+	}
+
+	g.identifiers[id] = description
+
+	return id, nil
+}
+
+func (g *generator) write(packageName string, experiments []experiment.Experiment, variables []*variable) error {
+	usesJSON := false
+	for _, v := range variables {
+		usesJSON = usesJSON || v.valueType == experiment.VALUE_TYPE_JSON
+	}
+
+	g.printf("// Code generated by experimentctl generate. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", packageName)
+	g.printf("import (\n")
+	if usesJSON {
+		g.printf("\t\"encoding/json\"\n")
+	}
+	g.printf("\t\"github.com/sneakylocke/experiment\"\n")
+	g.printf("\t\"github.com/sneakylocke/experiment/constraint\"\n")
+	g.printf(")\n\n")
+
+	// Names of experiments and their audiences
+	sorted := make([]experiment.Experiment, len(experiments))
+	copy(sorted, experiments)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	g.printf("// Names of experiments.\nconst (\n")
+	for _, e := range sorted {
+		id, err := g.identifier("Experiment", e.Name, fmt.Sprintf("experiment '%s'", e.Name))
+
+		if err != nil {
+			return err
+		}
+
+		g.printf("\t%s = %q\n", id, e.Name)
+	}
+	g.printf(")\n\n")
+
+	g.printf("// Names of audiences, prefixed by the name of their experiment.\nconst (\n")
+	for _, e := range sorted {
+		for _, audience := range e.Audiences {
+			description := fmt.Sprintf("audience '%s' of experiment '%s'", audience.Name, e.Name)
+			id, err := g.identifier("Audience", e.Name+"_"+audience.Name, description)
+
+			if err != nil {
+				return err
+			}
+
+			g.printf("\t%s = %q\n", id, audience.Name)
+		}
+	}
+	g.printf(")\n\n")
+
+	// Names of variables, then an accessor for each
+	variableIDs := make([]string, len(variables))
+
+	g.printf("// Names of variables.\nconst (\n")
+	for i, v := range variables {
+		id, err := g.identifier("Variable", v.name, fmt.Sprintf("variable '%s'", v.name))
+
+		if err != nil {
+			return err
+		}
+
+		variableIDs[i] = id
+		g.printf("\t%s = %q\n", id, v.name)
+	}
+	g.printf(")\n")
+
+	for i, v := range variables {
+		id, err := g.identifier("", v.name, fmt.Sprintf("the accessor of variable '%s'", v.name))
+
+		if err != nil {
+			return err
+		}
+
+		g.printf("\n")
+
+		if err := g.writeAccessor(id, variableIDs[i], v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *generator) writeAccessor(id string, variableID string, v *variable) error {
+	const parameters = "service experiment.Service, userID string, context constraint.Context"
+
+	var goType, getter string
+
+	switch v.valueType {
+	case experiment.VALUE_TYPE_INT:
+		goType, getter = "int64", "service.GetInt"
+	case experiment.VALUE_TYPE_FLOAT:
+		goType, getter = "float64", "service.GetFloat"
+	case experiment.VALUE_TYPE_BOOL:
+		goType, getter = "bool", "service.GetBool"
+	case experiment.VALUE_TYPE_STRING:
+		goType, getter = "string", "service.GetString"
+	case experiment.VALUE_TYPE_JSON:
+		goType, getter = "json.RawMessage", "experiment.Get"
+	default:
+		return errors.Errorf("variable '%s' has values of unknown type %s", v.name, v.valueType)
+	}
+
+	g.printf("// %s returns the %s value of the %s variable, or defaultValue if it can't be evaluated.\n", id, goType, v.name)
+	g.printf("func %s(%s, defaultValue %s) (%s, error) {\n", id, parameters, goType, goType)
+
+	if getter == "experiment.Get" {
+		g.printf("\treturn %s(service, %s, userID, context, defaultValue)\n", getter, variableID)
+	} else {
+		g.printf("\treturn %s(%s, userID, context, defaultValue)\n", getter, variableID)
+	}
+
+	g.printf("}\n")
+
+	return nil
+}
+
+// camelCase joins the letters and digits of a name, capitalizing the start of every word: checkout_button-color
+// becomes CheckoutButtonColor.
+func camelCase(name string) string {
+	var buffer bytes.Buffer
+	upper := true
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		buffer.WriteRune(r)
+	}
+
+	return buffer.String()
+}
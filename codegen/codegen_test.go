@@ -0,0 +1,152 @@
+package codegen
+
+import (
+	"github.com/sneakylocke/experiment"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGenerateMatchesExample(t *testing.T) {
+	experiments, err := experiment.LoadExperimentFiles([]string{
+		"../testdata/experiments/typed_values_1.json",
+	})
+	assert.Nil(t, err)
+
+	source, err := Generate("example", experiments)
+	assert.Nil(t, err)
+
+	// The example package is compiled with the module, run go generate in it after changing the generator
+	expected, err := ioutil.ReadFile("internal/example/experiments_gen.go")
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), string(source))
+}
+
+func TestGenerateTypes(t *testing.T) {
+	builder := experiment.NewFactorialBuilder("checkout")
+	assert.Nil(t, builder.AddInts("max-items", []uint32{1}, []int64{10}))
+	assert.Nil(t, builder.AddFloats("discount", []uint32{1}, []float64{0.1}))
+	assert.Nil(t, builder.AddBools("express.enabled", []uint32{1}, []bool{true}))
+	assert.Nil(t, builder.AddStrings("checkout_button_color", []uint32{1}, []string{"#00ff00"}))
+	e, err := builder.Build()
+	assert.Nil(t, err)
+
+	source, err := Generate("flags", []experiment.Experiment{*e})
+	assert.Nil(t, err)
+
+	code := string(source)
+	assert.Contains(t, code, "package flags")
+	assert.NotContains(t, code, "encoding/json")
+	assert.Contains(t, code, `ExperimentCheckout = "checkout"`)
+	assert.Contains(t, code, `AudienceCheckoutDefaultAudience = "default_audience"`)
+	assert.Contains(t, code, `VariableCheckoutButtonColor = "checkout_button_color"`)
+	assert.Contains(t, code, "func MaxItems(service experiment.Service, userID string, context constraint.Context, defaultValue int64) (int64, error)")
+	assert.Contains(t, code, "return service.GetFloat(VariableDiscount, userID, context, defaultValue)")
+	assert.Contains(t, code, "func ExpressEnabled(service experiment.Service, userID string, context constraint.Context, defaultValue bool) (bool, error)")
+	assert.Contains(t, code, "return service.GetString(VariableCheckoutButtonColor, userID, context, defaultValue)")
+}
+
+func TestGenerateConflictingTypes(t *testing.T) {
+	builder := experiment.NewSimpleBuilder("experiment_1")
+	assert.Nil(t, builder.AddInts("color", []uint32{1}, []int64{1}))
+	e1, err := builder.Build()
+	assert.Nil(t, err)
+
+	builder = experiment.NewSimpleBuilder("experiment_2")
+	assert.Nil(t, builder.AddStrings("color", []uint32{1}, []string{"red"}))
+	e2, err := builder.Build()
+	assert.Nil(t, err)
+
+	_, err = Generate("flags", []experiment.Experiment{*e1, *e2})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "variable 'color' has conflicting types: INT in experiment_1/default_audience; STRING in experiment_2/default_audience")
+
+	valueGroup := experiment.NewIntValueGroup("color", []uint32{1}, []int64{2})
+	valueGroup.ControlValue = *experiment.NewIntValue(2)
+	e2.Audiences[0].ValueGroups["color"] = valueGroup
+
+	source, err := Generate("flags", []experiment.Experiment{*e1, *e2})
+	assert.Nil(t, err)
+	assert.Contains(t, string(source), "func Color(service experiment.Service, userID string, context constraint.Context, defaultValue int64) (int64, error)")
+
+	// Untyped values take the type of the typed values they can be read as
+	e1.Audiences[0].ValueGroups["color"].ControlValue.Type = ""
+	e1.Audiences[0].ValueGroups["color"].WeightedValues[0].Value.Type = ""
+
+	source, err = Generate("flags", []experiment.Experiment{*e1, *e2})
+	assert.Nil(t, err)
+	assert.Contains(t, string(source), "func Color(service experiment.Service, userID string, context constraint.Context, defaultValue int64) (int64, error)")
+
+	source, err = Generate("flags", []experiment.Experiment{*e1})
+	assert.Nil(t, err)
+	assert.Contains(t, string(source), "func Color(service experiment.Service, userID string, context constraint.Context, defaultValue int64) (int64, error)")
+
+	// But not of a type they can't be read as
+	e2.Audiences[0].ValueGroups["color"] = experiment.NewStringValueGroup("color", []uint32{1}, []string{"red"})
+
+	_, err = Generate("flags", []experiment.Experiment{*e1, *e2})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "variable 'color' has conflicting types: untyped in experiment_1/default_audience; STRING in experiment_2/default_audience")
+}
+
+func TestGenerateUntyped(t *testing.T) {
+	// Values written before values had a type, all of them zero
+	experiments, err := experiment.LoadExperimentFiles([]string{"../testdata/experiments/constraints_test_1.json"})
+	assert.Nil(t, err)
+
+	source, err := Generate("example", experiments)
+	assert.Nil(t, err)
+	assert.Contains(t, string(source), "return service.GetFloat(VariableA, userID, context, defaultValue)")
+
+	untyped := func(values ...experiment.Value) experiment.Experiment {
+		valueGroup := &experiment.ValueGroup{Name: "a", Salt: "salt"}
+		for _, value := range values {
+			valueGroup.WeightedValues = append(valueGroup.WeightedValues, experiment.WeightedValue{Value: value, Weight: 1})
+		}
+
+		return experiment.Experiment{
+			Name:          "legacy",
+			VariableNames: []string{"a"},
+			Audiences:     []experiment.Audience{{Name: "everyone", ValueGroups: map[string]*experiment.ValueGroup{"a": valueGroup}}},
+		}
+	}
+
+	// Payloads decide the type, empty ones can be read as any type
+	source, err = Generate("example", []experiment.Experiment{untyped(experiment.Value{}, experiment.Value{IntValue: 3})})
+	assert.Nil(t, err)
+	assert.Contains(t, string(source), "return service.GetInt(VariableA, userID, context, defaultValue)")
+
+	source, err = Generate("example", []experiment.Experiment{untyped(experiment.Value{BoolValue: true})})
+	assert.Nil(t, err)
+	assert.Contains(t, string(source), "return service.GetBool(VariableA, userID, context, defaultValue)")
+
+	_, err = Generate("example", []experiment.Experiment{untyped(experiment.Value{FloatValue: 0.5}, experiment.Value{IntValue: 3})})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "variable 'a' has values without a type holding payloads of different types in legacy/everyone")
+
+	_, err = Generate("example", []experiment.Experiment{untyped(experiment.Value{FloatValue: 0.5, IntValue: 3})})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "variable 'a' has values without a type holding payloads of more than one type in legacy/everyone")
+}
+
+func TestGenerateIdentifierCollision(t *testing.T) {
+	builder := experiment.NewFactorialBuilder("experiment_1")
+	assert.Nil(t, builder.AddInts("button_color", []uint32{1}, []int64{1}))
+	assert.Nil(t, builder.AddInts("button-color", []uint32{1}, []int64{1}))
+	e, err := builder.Build()
+	assert.Nil(t, err)
+
+	_, err = Generate("flags", []experiment.Experiment{*e})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "both generate the identifier VariableButtonColor")
+
+	_, err = Generate("", []experiment.Experiment{*e})
+	assert.NotNil(t, err)
+}
+
+func TestCamelCase(t *testing.T) {
+	assert.Equal(t, "CheckoutButtonColor", camelCase("checkout_button_color"))
+	assert.Equal(t, "CheckoutButtonColor", camelCase("checkout-button.color"))
+	assert.Equal(t, "ABTest2", camelCase("a b test 2"))
+	assert.Equal(t, "IsPremium", camelCase("isPremium"))
+}
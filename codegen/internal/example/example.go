@@ -0,0 +1,5 @@
+// Package example holds accessors generated from the test experiments. It is compiled with the rest of the module
+// so a change to the generator that produces invalid code fails the build.
+package example
+
+//go:generate go run ../../../cmd/experimentctl generate -out experiments_gen.go ../../../testdata/experiments/typed_values_1.json
@@ -0,0 +1,35 @@
+// Code generated by experimentctl generate. DO NOT EDIT.
+
+package example
+
+import (
+	"encoding/json"
+	"github.com/sneakylocke/experiment"
+	"github.com/sneakylocke/experiment/constraint"
+)
+
+// Names of experiments.
+const (
+	ExperimentTypedExperiment = "typed_experiment"
+)
+
+// Names of audiences, prefixed by the name of their experiment.
+const (
+	AudienceTypedExperimentEveryone = "everyone"
+)
+
+// Names of variables.
+const (
+	VariableButtonText     = "button_text"
+	VariableCheckoutConfig = "checkout_config"
+)
+
+// ButtonText returns the string value of the button_text variable, or defaultValue if it can't be evaluated.
+func ButtonText(service experiment.Service, userID string, context constraint.Context, defaultValue string) (string, error) {
+	return service.GetString(VariableButtonText, userID, context, defaultValue)
+}
+
+// CheckoutConfig returns the json.RawMessage value of the checkout_config variable, or defaultValue if it can't be evaluated.
+func CheckoutConfig(service experiment.Service, userID string, context constraint.Context, defaultValue json.RawMessage) (json.RawMessage, error) {
+	return experiment.Get(service, VariableCheckoutConfig, userID, context, defaultValue)
+}
@@ -0,0 +1,209 @@
+package constraint
+
+import (
+	"bytes"
+	"github.com/juju/errors"
+	"net"
+	"reflect"
+	"sort"
+)
+
+// cidrSet holds a list of network prefixes as sorted, non-overlapping address ranges. IPv4 and IPv6 ranges are
+// kept apart so a membership check is a single binary search no matter how many prefixes were provided.
+type cidrSet struct {
+	v4 []ipRange
+	v6 []ipRange
+}
+
+// ipRange is an inclusive range of addresses. Both ends have the same length: 4 bytes for IPv4, 16 for IPv6.
+type ipRange struct {
+	first net.IP
+	last  net.IP
+}
+
+// cachedCIDRSet is a cidrSet along with the constraint Value it was parsed from.
+type cachedCIDRSet struct {
+	value interface{}
+	set   *cidrSet
+}
+
+// cidrSetOf returns the parsed prefixes of a CIDR constraint. They are parsed the first time the constraint is
+// resolved and again only if its Value was replaced since, so lists of thousands of prefixes are not sorted and
+// merged on every call.
+func (r *resolver) cidrSetOf(constraint *Constraint) (*cidrSet, error) {
+	if cached, ok := r.cidrs.Load(constraint); ok && sameList(cached.(*cachedCIDRSet).value, constraint.Value) {
+		return cached.(*cachedCIDRSet).set, nil
+	}
+
+	set, err := newCIDRSet(constraint.Value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.cidrs.Store(constraint, &cachedCIDRSet{value: constraint.Value, set: set})
+
+	return set, nil
+}
+
+// sameList tells if two values are the same list, rather than lists with the same elements.
+func sameList(a interface{}, b interface{}) bool {
+	listA, listB := reflect.ValueOf(a), reflect.ValueOf(b)
+
+	if listA.Kind() != reflect.Slice || listB.Kind() != reflect.Slice || listA.Type() != listB.Type() {
+		return false
+	}
+
+	return listA.Pointer() == listB.Pointer() && listA.Len() == listB.Len()
+}
+
+// newCIDRSet parses a list of CIDRs such as "10.0.0.0/8" or "2001:db8::/32". A bare address is treated as a
+// single host prefix.
+func newCIDRSet(value interface{}) (*cidrSet, error) {
+	cidrs, err := forceStrings(value)
+
+	if err != nil {
+		return nil, errors.Annotate(err, "expected a list of CIDRs")
+	}
+
+	set := &cidrSet{}
+
+	for _, cidr := range cidrs {
+		r, parseErr := parseIPRange(cidr)
+
+		if parseErr != nil {
+			return nil, parseErr
+		}
+
+		if len(r.first) == net.IPv4len {
+			set.v4 = append(set.v4, r)
+		} else {
+			set.v6 = append(set.v6, r)
+		}
+	}
+
+	set.v4 = mergeIPRanges(set.v4)
+	set.v6 = mergeIPRanges(set.v6)
+
+	return set, nil
+}
+
+// contains reports whether ip falls within any of the prefixes in the set.
+func (set *cidrSet) contains(ip net.IP) bool {
+	ranges := set.v6
+
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		ranges = set.v4
+	}
+
+	// Find the first range that ends at or after the ip, then check that it also starts before it
+	i := sort.Search(len(ranges), func(i int) bool {
+		return bytes.Compare(ranges[i].last, ip) >= 0
+	})
+
+	return i < len(ranges) && bytes.Compare(ranges[i].first, ip) <= 0
+}
+
+func parseIPRange(cidr string) (ipRange, error) {
+	_, network, err := net.ParseCIDR(cidr)
+
+	if err != nil {
+		ip := net.ParseIP(cidr)
+
+		if ip == nil {
+			return ipRange{}, errors.Errorf("invalid CIDR: %s", cidr)
+		}
+
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+
+		return ipRange{first: ip, last: ip}, nil
+	}
+
+	first, mask := network.IP, network.Mask
+
+	// Prefixes of IPv4-mapped IPv6 addresses such as ::ffff:10.0.0.0/104 hold the same addresses as 10.0.0.0/8
+	if ones, bits := mask.Size(); bits == 8*net.IPv6len && ones >= 96 && first.To4() != nil {
+		mask = net.CIDRMask(ones-96, 8*net.IPv4len)
+	}
+
+	if v4 := first.To4(); v4 != nil && len(mask) == net.IPv4len {
+		first = v4
+	}
+
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^mask[i]
+	}
+
+	return ipRange{first: first, last: last}, nil
+}
+
+// mergeIPRanges sorts ranges by their first address and collapses any that overlap or are adjacent.
+func mergeIPRanges(ranges []ipRange) []ipRange {
+	if len(ranges) == 0 {
+		return ranges
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].first, ranges[j].first) < 0
+	})
+
+	merged := ranges[:1]
+
+	for _, r := range ranges[1:] {
+		current := &merged[len(merged)-1]
+
+		if bytes.Compare(r.first, current.last) <= 0 || isNextIP(current.last, r.first) {
+			if bytes.Compare(r.last, current.last) > 0 {
+				current.last = r.last
+			}
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// isNextIP reports whether next is the address right after ip.
+func isNextIP(ip net.IP, next net.IP) bool {
+	if len(ip) != len(next) {
+		return false
+	}
+
+	following := make(net.IP, len(ip))
+	copy(following, ip)
+
+	for i := len(following) - 1; i >= 0; i-- {
+		following[i]++
+
+		if following[i] != 0 {
+			return following.Equal(next)
+		}
+	}
+
+	// ip was the last address
+	return false
+}
+
+// forceIP converts a context value holding an address into a net.IP.
+func forceIP(value interface{}) (net.IP, error) {
+	switch v := value.(type) {
+	case net.IP:
+		return v, nil
+	case string:
+		ip := net.ParseIP(v)
+
+		if ip == nil {
+			return nil, errors.Errorf("invalid IP address: %s", v)
+		}
+
+		return ip, nil
+	default:
+		return nil, errors.Errorf("could not force %+v to an IP address", value)
+	}
+}
@@ -0,0 +1,206 @@
+package constraint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestCIDRIPv4(t *testing.T) {
+	context := make(map[string]interface{})
+	context["ip"] = "10.1.2.3"
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	// IN CIDR
+	constraintIn := NewConstraint("ip", OPERATOR_IN_CIDR, []string{"192.168.0.0/16", "10.0.0.0/8"})
+	okIn, errIn := resolver.Resolve(constraintIn, mapContext)
+	assert.Nil(t, errIn)
+	assert.True(t, okIn)
+
+	// NOT IN CIDR
+	constraintNotIn := NewConstraint("ip", OPERATOR_NOT_IN_CIDR, []string{"192.168.0.0/16", "10.0.0.0/8"})
+	okNotIn, errNotIn := resolver.Resolve(constraintNotIn, mapContext)
+	assert.Nil(t, errNotIn)
+	assert.False(t, okNotIn)
+
+	// Outside of the range
+	constraintOut := NewConstraint("ip", OPERATOR_IN_CIDR, []string{"10.2.0.0/16"})
+	okOut, errOut := resolver.Resolve(constraintOut, mapContext)
+	assert.Nil(t, errOut)
+	assert.False(t, okOut)
+}
+
+func TestCIDRIPv6(t *testing.T) {
+	context := make(map[string]interface{})
+	context["ip"] = net.ParseIP("2001:db8::1")
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	constraintIn := NewConstraint("ip", OPERATOR_IN_CIDR, []string{"10.0.0.0/8", "2001:db8::/32"})
+	okIn, errIn := resolver.Resolve(constraintIn, mapContext)
+	assert.Nil(t, errIn)
+	assert.True(t, okIn)
+
+	constraintOut := NewConstraint("ip", OPERATOR_IN_CIDR, []string{"2001:db9::/32"})
+	okOut, errOut := resolver.Resolve(constraintOut, mapContext)
+	assert.Nil(t, errOut)
+	assert.False(t, okOut)
+}
+
+func TestCIDRJSONValue(t *testing.T) {
+	context := make(map[string]interface{})
+	context["ip"] = net.ParseIP("172.16.5.4")
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	// JSON decoding produces []interface{}, a bare address is a single host
+	constraint := NewConstraint("ip", OPERATOR_IN_CIDR, []interface{}{"172.16.5.4", "8.8.8.0/24"})
+	assert.Nil(t, constraint.Validate())
+
+	ok, err := resolver.Resolve(constraint, mapContext)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	evaluator, compileErr := Compile(constraint)
+	assert.Nil(t, compileErr)
+
+	ok, err = evaluator.Evaluate(mapContext)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestCIDRIPv4Mapped(t *testing.T) {
+	resolver := resolver{}
+
+	// A prefix of IPv4-mapped addresses matches the IPv4 addresses it holds
+	constraint := NewConstraint("ip", OPERATOR_IN_CIDR, []string{"::ffff:10.0.0.0/104"})
+	assert.Nil(t, constraint.Validate())
+
+	tests := map[string]bool{
+		"10.1.2.3":         true,
+		"::ffff:10.1.2.3":  true,
+		"11.0.0.1":         false,
+		"::ffff:11.0.0.1":  false,
+		"2001:db8::1":      false,
+		"::ffff:10.0.0.0":  true,
+		"::ffff:9.255.0.1": false,
+	}
+
+	for ip, expected := range tests {
+		context := NewMapContext(map[string]interface{}{"ip": ip})
+		ok, err := resolver.Resolve(constraint, context)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, ok, ip)
+	}
+
+	set, err := newCIDRSet([]string{"::ffff:10.0.0.0/104", "10.0.0.0/8", "::ffff:192.168.1.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(set.v4))
+	assert.Equal(t, 0, len(set.v6))
+}
+
+func TestCIDRAdjacentRanges(t *testing.T) {
+	set, err := newCIDRSet([]string{"10.0.0.128/25", "10.0.0.0/25", "10.0.1.0", "10.0.2.1", "255.255.255.255", "2001:db8::/33", "2001:db8:8000::/33"})
+	assert.Nil(t, err)
+
+	// 10.0.0.0/25, 10.0.0.128/25 and 10.0.1.0 make up one range, 10.0.2.1 and 255.255.255.255 are not adjacent
+	assert.Equal(t, 3, len(set.v4))
+	assert.Equal(t, net.ParseIP("10.0.1.0").To4(), set.v4[0].last)
+	assert.Equal(t, 1, len(set.v6))
+}
+
+func TestCIDRInvalid(t *testing.T) {
+	assert.NotNil(t, NewConstraint("ip", OPERATOR_IN_CIDR, []string{"10.0.0.0/33"}).Validate())
+	assert.NotNil(t, NewConstraint("ip", OPERATOR_IN_CIDR, []string{"not an ip"}).Validate())
+	assert.NotNil(t, NewConstraint("ip", OPERATOR_IN_CIDR, []int{1, 2}).Validate())
+	assert.NotNil(t, NewConstraint("ip", OPERATOR_NOT_IN_CIDR, "10.0.0.0/8").Validate())
+
+	context := make(map[string]interface{})
+	context["ip"] = "10.0.0.256"
+	context["number"] = 10
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	ok, err := resolver.Resolve(NewConstraint("ip", OPERATOR_IN_CIDR, []string{"10.0.0.0/8"}), mapContext)
+	assert.NotNil(t, err)
+	assert.False(t, ok)
+
+	ok, err = resolver.Resolve(NewConstraint("number", OPERATOR_IN_CIDR, []string{"10.0.0.0/8"}), mapContext)
+	assert.NotNil(t, err)
+	assert.False(t, ok)
+}
+
+func TestCIDRManyRanges(t *testing.T) {
+	// Build thousands of small ranges along with some that overlap
+	cidrs := make([]string, 0, 4200)
+	for i := 0; i < 4096; i++ {
+		cidrs = append(cidrs, fmt.Sprintf("10.%d.%d.0/24", i/16, (i%16)*16))
+	}
+	cidrs = append(cidrs, "10.200.0.0/16", "10.200.3.0/24", "2001:db8::/48")
+
+	constraint := NewConstraint("ip", OPERATOR_IN_CIDR, cidrs)
+	assert.Nil(t, constraint.Validate())
+
+	set, err := newCIDRSet(cidrs)
+	assert.Nil(t, err)
+
+	// The 16 prefixes of 10.200.0.0/16 and 10.200.3.0/24 are collapsed into it, and 10.201.0.0/24 is adjacent to it
+	assert.Equal(t, 4080, len(set.v4))
+	assert.Equal(t, 1, len(set.v6))
+
+	resolver := resolver{}
+
+	tests := map[string]bool{
+		"10.0.0.1":      true,
+		"10.0.1.1":      false,
+		"10.0.16.255":   true,
+		"10.255.240.10": true,
+		"10.200.3.4":    true,
+		"10.200.255.1":  true,
+		"11.0.0.1":      false,
+		"9.255.255.255": false,
+		"2001:db8::5":   true,
+		"2001:db9::5":   false,
+	}
+
+	for ip, expected := range tests {
+		context := NewMapContext(map[string]interface{}{"ip": ip})
+		ok, err := resolver.Resolve(constraint, context)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, ok, ip)
+	}
+}
+
+func TestCIDRParsedOnce(t *testing.T) {
+	context := NewMapContext(map[string]interface{}{"ip": "10.1.2.3"})
+	resolver := resolver{}
+
+	constraint := NewConstraint("ip", OPERATOR_IN_CIDR, []string{"10.0.0.0/8"})
+	ok, err := resolver.Resolve(constraint, context)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	set, err := resolver.cidrSetOf(constraint)
+	assert.Nil(t, err)
+
+	again, err := resolver.cidrSetOf(constraint)
+	assert.Nil(t, err)
+	assert.True(t, set == again)
+
+	// Replacing the Value parses the new prefixes
+	constraint.Value = []string{"192.168.0.0/16"}
+	ok, err = resolver.Resolve(constraint, context)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// Compiling reports prefixes that don't parse
+	_, err = Compile(NewConstraint("ip", OPERATOR_IN_CIDR, []string{"10.0.0.0/33"}))
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+}
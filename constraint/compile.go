@@ -0,0 +1,426 @@
+package constraint
+
+import (
+	"github.com/juju/errors"
+	"math"
+)
+
+// Evaluator resolves a Constraint or Expression that was compiled ahead of time. It gives the same results as the
+// default Resolver but does the work that only depends on the constraint, such as converting its Value and building
+// sets for membership operators, once when it is compiled rather than on every call.
+type Evaluator interface {
+	Evaluate(context Context) (bool, error)
+}
+
+// pathContext is implemented by contexts that can look up a key path that was parsed ahead of time.
+type pathContext interface {
+	valueAtPath(key string, segments []string) (interface{}, error)
+}
+
+// Compile validates the Constraint and returns an Evaluator for it. The Constraint must not be changed afterwards.
+// Custom operators are looked up when compiling, so unregistering one does not affect Evaluators that use it.
+func Compile(constraint *Constraint) (Evaluator, error) {
+	return CompileWithPolicy(constraint, "")
+}
+
+// CompileWithPolicy is Compile for an Evaluator that applies the missing key policy if the constraint has none,
+// like a Resolver from NewResolverWithPolicy.
+func CompileWithPolicy(constraint *Constraint, missing MISSING) (Evaluator, error) {
+	if err := constraint.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := &compiledConstraint{constraint: constraint, missing: missing}
+
+	if isKeyPath(constraint.Key) {
+		segments, err := parseKeyPath(constraint.Key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.segments = segments
+	}
+
+	r := &resolver{}
+
+	switch {
+	case !builtinOperators[constraint.Operator]:
+		custom, _ := lookupOperator(constraint.Operator)
+		c.evaluate = func(value interface{}) (bool, error) {
+			return custom.evaluate(value, constraint.Value)
+		}
+	case constraint.Operator == OPERATOR_IN_CIDR || constraint.Operator == OPERATOR_NOT_IN_CIDR:
+		// Parse the prefixes once rather than on every call
+		set, err := newCIDRSet(constraint.Value)
+
+		if err != nil {
+			return nil, withConstraint(newError(ErrInvalidValue, err), constraint)
+		}
+
+		c.evaluate = func(value interface{}) (bool, error) {
+			return r.resolveCIDRSet(constraint, set, value)
+		}
+	case isIntersectionOperator(constraint.Operator):
+		c.evaluate = compileIntersection(r, constraint)
+	default:
+		c.evaluate = compileComparison(r, constraint).evaluate
+	}
+
+	return c, nil
+}
+
+// compiledConstraint looks up the Key of its Constraint and passes the value to an operator specific function.
+type compiledConstraint struct {
+	constraint *Constraint
+	segments   []string // The parsed Key when it is a path, nil otherwise
+	missing    MISSING
+	evaluate   func(value interface{}) (bool, error)
+}
+
+func (c *compiledConstraint) Evaluate(context Context) (bool, error) {
+	ok, err := c.resolve(context)
+
+	if err != nil {
+		return false, withConstraint(err, c.constraint)
+	}
+
+	return ok, nil
+}
+
+func (c *compiledConstraint) resolve(context Context) (bool, error) {
+	if context == nil {
+		return false, newError(ErrNoContext, errors.Errorf("no context provided"))
+	}
+
+	var value interface{}
+	var contextErr error
+
+	if pc, ok := context.(pathContext); ok {
+		value, contextErr = pc.valueAtPath(c.constraint.Key, c.segments)
+	} else {
+		value, contextErr = context.value(c.constraint.Key)
+	}
+
+	if contextErr != nil {
+		return missingResult(c.constraint, c.missing, contextErr)
+	}
+
+	return c.evaluate(value)
+}
+
+// compileIntersection returns a function that resolves HAS_ANY, HAS_ALL and HAS_NONE against a set of the
+// constraint's values.
+func compileIntersection(r *resolver, constraint *Constraint) func(value interface{}) (bool, error) {
+	keys, _ := r.forceKeys(constraint.Value)
+
+	set := make(map[interface{}]struct{}, len(keys))
+	for _, key := range keys {
+		set[key] = struct{}{}
+	}
+
+	return func(value interface{}) (bool, error) {
+		values, valuesErr := r.forceKeys(value)
+
+		if valuesErr != nil {
+			return false, newError(ErrTypeMismatch, errors.Annotatef(valuesErr, "expected a list of strings or numbers in context: %s", constraint.Key))
+		}
+
+		switch constraint.Operator {
+		case OPERATOR_HAS_ANY, OPERATOR_HAS_NONE:
+			found := false
+			for _, v := range values {
+				if _, ok := set[v]; ok {
+					found = true
+					break
+				}
+			}
+
+			return found == (constraint.Operator == OPERATOR_HAS_ANY), nil
+		default:
+			// Count the distinct values of the constraint present in the context
+			seen := make(map[interface{}]struct{}, len(set))
+			for _, v := range values {
+				if _, ok := set[v]; ok {
+					seen[v] = struct{}{}
+				}
+			}
+
+			return len(seen) == len(set), nil
+		}
+	}
+}
+
+// compiledComparison holds the constraint's Value converted to each type a context value may be compared as. The
+// conversion errors are kept so they are returned in the same cases the Resolver returns them.
+type compiledComparison struct {
+	r          *resolver
+	constraint *Constraint
+	operator   OPERATOR
+
+	floatValue float64
+	floatErr   error
+	intValue   int64
+	intErr     error
+
+	// Sets and bounds for list operators
+	floatSet    map[float64]struct{}
+	floatBounds []float64
+	floatsErr   error
+	intSet      map[int64]struct{}
+	intBounds   []int64
+	intsErr     error
+	stringSet   map[string]struct{}
+	stringsErr  error
+	stringOk    bool
+
+	// Whether ints are compared as floats because the value, bounds or members are not all whole numbers
+	intsAsFloats bool
+}
+
+func compileComparison(r *resolver, constraint *Constraint) *compiledComparison {
+	c := &compiledComparison{r: r, constraint: constraint, operator: constraint.Operator}
+
+	_, c.stringOk = constraint.Value.(string)
+
+	if stringValues, err := forceStrings(constraint.Value); err == nil {
+		c.stringSet = make(map[string]struct{}, len(stringValues))
+		for _, s := range stringValues {
+			c.stringSet[s] = struct{}{}
+		}
+	} else {
+		c.stringsErr = err
+	}
+
+	if !isListOperator(c.operator) {
+		c.floatValue, c.floatErr = r.forceFloat64(constraint.Value)
+		c.intValue, c.intErr = r.forceInt64(constraint.Value)
+		c.intsAsFloats = c.floatErr == nil && c.floatValue != math.Trunc(c.floatValue)
+
+		return c
+	}
+
+	floatValues, floatsErr := r.forceFloat64s(constraint.Value)
+	intValues, intsErr := r.forceInt64s(constraint.Value)
+	c.floatsErr, c.intsErr = floatsErr, intsErr
+	c.intsAsFloats = floatsErr == nil && !wholeNumbers(floatValues)
+
+	if c.operator == OPERATOR_BETWEEN || c.operator == OPERATOR_BETWEEN_EXCLUSIVE {
+		c.floatBounds, c.intBounds = floatValues, intValues
+		return c
+	}
+
+	c.floatSet = make(map[float64]struct{}, len(floatValues))
+	for _, f := range floatValues {
+		c.floatSet[f] = struct{}{}
+	}
+
+	c.intSet = make(map[int64]struct{}, len(intValues))
+	for _, n := range intValues {
+		c.intSet[n] = struct{}{}
+	}
+
+	return c
+}
+
+func (c *compiledComparison) evaluate(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case float64:
+		return c.evaluateFloat64(v)
+	case float32:
+		return c.evaluateFloat64(float64(v))
+	case int:
+		return c.evaluateInt64(int64(v))
+	case int8:
+		return c.evaluateInt64(int64(v))
+	case int16:
+		return c.evaluateInt64(int64(v))
+	case int32:
+		return c.evaluateInt64(int64(v))
+	case int64:
+		return c.evaluateInt64(v)
+	case uint:
+		return c.evaluateUint64(uint64(v))
+	case uint8:
+		return c.evaluateInt64(int64(v))
+	case uint16:
+		return c.evaluateInt64(int64(v))
+	case uint32:
+		return c.evaluateInt64(int64(v))
+	case uint64:
+		return c.evaluateUint64(v)
+	case string:
+		return c.evaluateString(v)
+	case bool:
+		return c.evaluateBool(v)
+	default:
+		return false, newError(ErrTypeMismatch, errors.New("unknown type found"))
+	}
+}
+
+func (c *compiledComparison) evaluateFloat64(value float64) (bool, error) {
+	if !isListOperator(c.operator) {
+		if c.floatErr != nil {
+			return false, newError(ErrTypeMismatch, errors.Annotatef(c.floatErr, "could not compare %f with %+v", value, c.constraint.Value))
+		}
+
+		return c.r.compareFloat64(c.operator, value, c.floatValue)
+	}
+
+	if c.floatsErr != nil {
+		return false, newError(ErrTypeMismatch, errors.Annotatef(c.floatsErr, "could not compare %f with %+v", value, c.constraint.Value))
+	}
+
+	switch c.operator {
+	case OPERATOR_BETWEEN, OPERATOR_BETWEEN_EXCLUSIVE:
+		return c.r.arrayCompareFloat64(c.operator, value, c.floatBounds)
+	}
+
+	_, found := c.floatSet[value]
+
+	return c.membership(found)
+}
+
+func (c *compiledComparison) evaluateInt64(value int64) (bool, error) {
+	if c.intsAsFloats {
+		return c.evaluateFloat64(float64(value))
+	}
+
+	if !isListOperator(c.operator) {
+		if c.intErr != nil {
+			return false, newError(ErrTypeMismatch, errors.Annotatef(c.intErr, "could not compare %d with %+v", value, c.constraint.Value))
+		}
+
+		return c.r.compareInt64(c.operator, value, c.intValue)
+	}
+
+	if c.intsErr != nil {
+		return false, newError(ErrTypeMismatch, errors.Annotatef(c.intsErr, "could not compare %d with %+v", value, c.constraint.Value))
+	}
+
+	switch c.operator {
+	case OPERATOR_BETWEEN, OPERATOR_BETWEEN_EXCLUSIVE:
+		return c.r.arrayCompareInt64(c.operator, value, c.intBounds)
+	}
+
+	_, found := c.intSet[value]
+
+	return c.membership(found)
+}
+
+func (c *compiledComparison) evaluateUint64(value uint64) (bool, error) {
+	// Values that do not fit in an int64 can only be compared as floats
+	if value > math.MaxInt64 {
+		return c.evaluateFloat64(float64(value))
+	}
+
+	return c.evaluateInt64(int64(value))
+}
+
+func (c *compiledComparison) evaluateBool(value bool) (bool, error) {
+	return c.r.resolveBool(c.constraint, value)
+}
+
+func (c *compiledComparison) evaluateString(value string) (bool, error) {
+	if c.stringOk {
+		return c.r.resolveString(c.constraint, value)
+	}
+
+	if c.stringsErr != nil {
+		return false, newError(ErrTypeMismatch, errors.Errorf("could not compare input %s with constraint %+v", value, c.constraint.Value))
+	}
+
+	_, found := c.stringSet[value]
+
+	return c.membership(found)
+}
+
+// membership returns the result of a set operator given whether the context value is in the constraint's set.
+func (c *compiledComparison) membership(found bool) (bool, error) {
+	switch c.operator {
+	case OPERATOR_CONTAINS, OPERATOR_IN:
+		return found, nil
+	case OPERATOR_NOT_CONTAINS, OPERATOR_NOT_IN:
+		return !found, nil
+	default:
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for comparison: %s", c.operator))
+	}
+}
+
+// CompileExpression validates the Expression and returns an Evaluator that resolves it like Expression.Resolve.
+func CompileExpression(expression *Expression) (Evaluator, error) {
+	return CompileExpressionWithPolicy(expression, "")
+}
+
+// CompileExpressionWithPolicy is CompileExpression with a missing key policy for constraints that don't set one.
+func CompileExpressionWithPolicy(expression *Expression, missing MISSING) (Evaluator, error) {
+	if err := expression.Validate(); err != nil {
+		return nil, err
+	}
+
+	return compileExpression(expression, missing)
+}
+
+func compileExpression(expression *Expression, missing MISSING) (Evaluator, error) {
+	if expression.Kind == EXPRESSION_CONSTRAINT {
+		return CompileWithPolicy(expression.Constraint, missing)
+	}
+
+	compiled := &compiledExpression{kind: expression.Kind, children: make([]Evaluator, len(expression.Children))}
+
+	for i, child := range expression.Children {
+		evaluator, err := compileExpression(child, missing)
+
+		if err != nil {
+			return nil, err
+		}
+
+		compiled.children[i] = evaluator
+	}
+
+	return compiled, nil
+}
+
+type compiledExpression struct {
+	kind     EXPRESSION
+	children []Evaluator
+}
+
+func (e *compiledExpression) Evaluate(context Context) (bool, error) {
+	switch e.kind {
+	case EXPRESSION_AND:
+		for _, child := range e.children {
+			if ok, err := child.Evaluate(context); !ok || err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case EXPRESSION_OR:
+		var firstErr error
+
+		for _, child := range e.children {
+			ok, err := child.Evaluate(context)
+
+			if ok && err == nil {
+				return true, nil
+			}
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		return false, firstErr
+	case EXPRESSION_NOT:
+		ok, err := e.children[0].Evaluate(context)
+
+		if err != nil {
+			return false, err
+		}
+
+		return !ok, nil
+	default:
+		return false, errors.Errorf("invalid expression kind: %s", e.kind)
+	}
+}
@@ -0,0 +1,233 @@
+package constraint
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
+	"net"
+	"testing"
+)
+
+func TestCompileMatchesResolver(t *testing.T) {
+	constraints := []*Constraint{
+		NewConstraint("key", OPERATOR_EQ, "USA"),
+		NewConstraint("key", OPERATOR_NOT_EQ, "USA"),
+		NewConstraint("key", OPERATOR_GTE, "4.12"),
+		NewConstraint("key", OPERATOR_VERSION_GTE, "4.12"),
+		NewConstraint("key", OPERATOR_VERSION_LT, "4.12"),
+		NewConstraint("key", OPERATOR_EQ, 70),
+		NewConstraint("key", OPERATOR_GT, 70),
+		NewConstraint("key", OPERATOR_LT, 80.5),
+		NewConstraint("key", OPERATOR_GT, 69.5),
+		NewConstraint("key", OPERATOR_EQ, 70.9),
+		NewConstraint("key", OPERATOR_NOT_EQ, 70.5),
+		NewConstraint("key", OPERATOR_GTE, 74.5),
+		NewConstraint("key", OPERATOR_LTE, uint64(math.MaxUint64)),
+		NewConstraint("key", OPERATOR_NOT_EQ, true),
+		NewConstraint("key", OPERATOR_CONTAINS, []interface{}{"banana", "berry"}),
+		NewConstraint("key", OPERATOR_NOT_CONTAINS, []string{"banana", "berry"}),
+		NewConstraint("key", OPERATOR_CONTAINS, []interface{}{1, 2.5, 3}),
+		NewConstraint("key", OPERATOR_IN, []interface{}{"USA", "CA"}),
+		NewConstraint("key", OPERATOR_IN, []int{1, 2, 3}),
+		NewConstraint("key", OPERATOR_NOT_IN, []float64{1.5, 70}),
+		NewConstraint("key", OPERATOR_BETWEEN, []interface{}{70, 80}),
+		NewConstraint("key", OPERATOR_BETWEEN_EXCLUSIVE, []float64{70.5, 80}),
+		NewConstraint("key", OPERATOR_BETWEEN, []float64{69.5, 70.5}),
+		NewConstraint("key", OPERATOR_BETWEEN_EXCLUSIVE, []interface{}{74.5, 75.5}),
+		NewConstraint("key", OPERATOR_IN, []float64{1.9, 70}),
+		NewConstraint("key", OPERATOR_IS_TRUE, nil),
+		NewConstraint("key", OPERATOR_IS_FALSE, nil),
+		NewConstraint("key", OPERATOR_HAS_ANY, []interface{}{"a", 1}),
+		NewConstraint("key", OPERATOR_HAS_ALL, []interface{}{"a", "a", 1}),
+		NewConstraint("key", OPERATOR_HAS_NONE, []string{"a", "b"}),
+		NewConstraint("key", OPERATOR_IN_CIDR, []string{"10.0.0.0/8", "2001:db8::/32"}),
+		NewConstraint("key", OPERATOR_NOT_IN_CIDR, []interface{}{"192.168.0.0/16"}),
+		NewConstraint("nested.key", OPERATOR_EQ, "USA"),
+	}
+
+	values := []interface{}{
+		"USA", "CA", "4.9", "4.12.1", "banana", "10.1.2.3", "192.168.1.1", "",
+		70, 75, 80, int8(2), int64(-1), uint(3), uint64(math.MaxUint64), uint32(70),
+		70.0, 70.5, 2.5, float32(80), math.NaN(),
+		true, false,
+		[]string{"a", "b"}, []interface{}{"a", 1.0}, []int{1}, []interface{}{}, []interface{}{map[string]interface{}{}},
+		net.ParseIP("10.0.0.1"), nil, struct{}{},
+	}
+
+	resolver := NewDefaultResolver()
+
+	for _, constraint := range constraints {
+		evaluator, err := Compile(constraint)
+		assert.Nil(t, err, "%+v", constraint)
+
+		for _, value := range values {
+			context := NewMapContext(map[string]interface{}{"key": value, "nested": map[string]interface{}{"key": value}})
+
+			expected, expectedErr := resolver.Resolve(constraint, context)
+			ok, err := evaluator.Evaluate(context)
+
+			assert.Equal(t, expected, ok, "%+v with %#v", constraint, value)
+			assert.Equal(t, expectedErr == nil, err == nil, "%+v with %#v: %v %v", constraint, value, expectedErr, err)
+		}
+
+		// A missing key is an error either way
+		_, err = evaluator.Evaluate(NewMapContext(map[string]interface{}{}))
+		assert.NotNil(t, err)
+
+		_, err = evaluator.Evaluate(nil)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestCompileCustomOperator(t *testing.T) {
+	assert.Nil(t, RegisterOperator("STARTS_WITH", nil, func(contextValue interface{}, constraintValue interface{}) (bool, error) {
+		s, _ := contextValue.(string)
+		prefix, _ := constraintValue.(string)
+		return len(s) >= len(prefix) && s[:len(prefix)] == prefix, nil
+	}))
+
+	evaluator, err := Compile(NewConstraint("name", "STARTS_WITH", "ba"))
+	assert.Nil(t, err)
+
+	// The operator was captured when compiling
+	assert.Nil(t, UnregisterOperator("STARTS_WITH"))
+
+	ok, err := evaluator.Evaluate(NewMapContext(map[string]interface{}{"name": "banana"}))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	_, err = Compile(NewConstraint("name", "STARTS_WITH", "ba"))
+	assert.NotNil(t, err)
+}
+
+func TestCompileInvalid(t *testing.T) {
+	_, err := Compile(NewConstraint("key", OPERATOR_IN, "USA"))
+	assert.NotNil(t, err)
+
+	_, err = Compile(NewConstraint("", OPERATOR_EQ, "USA"))
+	assert.NotNil(t, err)
+
+	_, err = CompileExpression(&Expression{Kind: EXPRESSION_AND})
+	assert.NotNil(t, err)
+}
+
+func TestCompileExpression(t *testing.T) {
+	inputs := []string{
+		`country in ["US","CA"] && app_version VERSION_GTE "4.12" && !is_employee`,
+		`country == "US" || temperature > 70`,
+		`!(country == "US")`,
+		`!(a && b) || (c || d) && is_premium == true`,
+	}
+
+	contexts := []map[string]interface{}{
+		{"country": "US", "app_version": "4.12.1", "is_employee": false},
+		{"country": "CA", "app_version": "4.9", "is_employee": false, "temperature": 75},
+		{"temperature": 65},
+		{"a": true, "b": false, "is_premium": true},
+		{"a": true, "b": true, "c": false, "d": true, "is_premium": false},
+		{},
+	}
+
+	resolver := NewDefaultResolver()
+
+	for _, input := range inputs {
+		expression, err := ParseExpression(input)
+		assert.Nil(t, err)
+
+		evaluator, err := CompileExpression(expression)
+		assert.Nil(t, err)
+
+		for _, c := range contexts {
+			context := NewMapContext(c)
+
+			expected, expectedErr := expression.Resolve(resolver, context)
+			ok, err := evaluator.Evaluate(context)
+
+			assert.Equal(t, expected, ok, "%s with %+v", input, c)
+			assert.Equal(t, expectedErr == nil, err == nil, "%s with %+v", input, c)
+		}
+	}
+}
+
+// benchmarkAudiences returns the constraints of each audience in constraints_test_1.json.
+func benchmarkAudiences(b *testing.B) [][]Constraint {
+	data, err := ioutil.ReadFile("../testdata/experiments/constraints_test_1.json")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var experiment struct {
+		Audiences []struct {
+			Constraints []Constraint `json:"constraints"`
+		} `json:"audiences"`
+	}
+
+	if err := json.Unmarshal(data, &experiment); err != nil {
+		b.Fatal(err)
+	}
+
+	audiences := make([][]Constraint, len(experiment.Audiences))
+	for i, audience := range experiment.Audiences {
+		audiences[i] = audience.Constraints
+	}
+
+	return audiences
+}
+
+var benchmarkContexts = []*MapContext{
+	NewMapContext(map[string]interface{}{"country": "USA", "temperature": 75.0, "food": "banana"}),
+	NewMapContext(map[string]interface{}{"country": "ITALY", "temperature": 60.0, "food": "berry"}),
+	NewMapContext(map[string]interface{}{"country": "FRANCE", "temperature": 85.0, "food": "cheese"}),
+}
+
+func BenchmarkResolver(b *testing.B) {
+	audiences := benchmarkAudiences(b)
+	resolver := NewDefaultResolver()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		context := benchmarkContexts[i%len(benchmarkContexts)]
+
+		for _, constraints := range audiences {
+			for j := range constraints {
+				if ok, _ := resolver.Resolve(&constraints[j], context); !ok {
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	audiences := benchmarkAudiences(b)
+	evaluators := make([][]Evaluator, len(audiences))
+
+	for i, constraints := range audiences {
+		for j := range constraints {
+			evaluator, err := Compile(&constraints[j])
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			evaluators[i] = append(evaluators[i], evaluator)
+		}
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		context := benchmarkContexts[i%len(benchmarkContexts)]
+
+		for _, audience := range evaluators {
+			for _, evaluator := range audience {
+				if ok, _ := evaluator.Evaluate(context); !ok {
+					break
+				}
+			}
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package constraint
 
-import "github.com/juju/errors"
+import (
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment/validation"
+)
 
 // Constraint is a struct that defines an Operator, an object to compare to, and the Key/name of what type of thing
 // Value is (country, height).
@@ -8,6 +11,7 @@ type Constraint struct {
 	Key      string      `json:"key"`
 	Operator OPERATOR    `json:"operator"`
 	Value    interface{} `json:"value"`
+	Missing  MISSING     `json:"missing,omitempty"` // What to do when Key is not in the Context, see MISSING
 }
 
 // NewConstraint creates and returns a pointer to a Constraint.
@@ -20,17 +24,82 @@ func NewConstraint(key string, operator OPERATOR, value interface{}) *Constraint
 	return constraint
 }
 
+// Validate returns every problem with the constraint, each with the path of its field, see validation.Errors. Every
+// problem is an *Error of the kind of the problem.
 func (c *Constraint) Validate() error {
+	problems := &validation.Collector{}
+
 	if c.Key == "" {
-		return errors.Errorf("constraint Key must be specified: %+v", c)
+		problems.Add("key", withConstraint(newError(ErrInvalidKey, errors.Errorf("constraint Key must be specified: %+v", c)), c))
+	} else if err := ValidateKey(c.Key); err != nil {
+		problems.Add("key", withConstraint(newError(ErrInvalidKey, errors.Annotatef(err, "constraint Key is malformed: %+v", c)), c))
+	}
+
+	operatorErr := ValidateOperator(c.Operator)
+
+	if operatorErr != nil {
+		problems.Add("operator", withConstraint(operatorErr, c))
 	}
 
-	if c.Value == nil {
-		return errors.Errorf("constraint Value must not be nil: %+v", c)
+	if err := ValidateMissing(c.Missing); err != nil {
+		problems.Add("missing", withConstraint(err, c))
 	}
 
-	if err := ValidateOperator(c.Operator); err != nil {
-		return err
+	// The shape of the Value depends on the Operator
+	if c.Value == nil && !isUnaryOperator(c.Operator) {
+		problems.Add("value", withConstraint(newError(ErrInvalidValue, errors.Errorf("constraint Value must not be nil: %+v", c)), c))
+	} else if operatorErr == nil {
+		if err := c.validateValue(); err != nil {
+			problems.Add("value", withConstraint(newError(ErrInvalidValue, errors.Annotatef(err, "invalid constraint Value: %+v", c)), c))
+		}
+	}
+
+	return problems.Err()
+}
+
+// validateValue checks that the Value has the right shape for the Operator.
+func (c *Constraint) validateValue() error {
+	r := resolver{}
+
+	if custom, ok := lookupOperator(c.Operator); ok {
+		if custom.validate == nil {
+			return nil
+		}
+
+		return custom.validate(c.Value)
+	}
+
+	switch c.Operator {
+	case OPERATOR_IN_CIDR, OPERATOR_NOT_IN_CIDR:
+		if _, err := newCIDRSet(c.Value); err != nil {
+			return err
+		}
+	case OPERATOR_IN, OPERATOR_NOT_IN, OPERATOR_CONTAINS, OPERATOR_NOT_CONTAINS:
+		if _, err := forceStrings(c.Value); err == nil {
+			return nil
+		}
+
+		if _, err := r.forceFloat64s(c.Value); err != nil {
+			return errors.Errorf("expected a list of strings or numbers")
+		}
+	case OPERATOR_HAS_ANY, OPERATOR_HAS_ALL, OPERATOR_HAS_NONE:
+		if _, err := r.forceKeys(c.Value); err != nil {
+			return err
+		}
+	case OPERATOR_VERSION_LT, OPERATOR_VERSION_LTE, OPERATOR_VERSION_GT, OPERATOR_VERSION_GTE:
+		if _, ok := c.Value.(string); !ok {
+			return errors.Errorf("expected a version string")
+		}
+	case OPERATOR_BETWEEN, OPERATOR_BETWEEN_EXCLUSIVE:
+		bounds, err := r.forceFloat64s(c.Value)
+
+		if err != nil {
+			return err
+		}
+
+		if len(bounds) != 2 || bounds[0] > bounds[1] {
+			return errors.Errorf("expected lower and upper bounds, found %+v", c.Value)
+		}
 	}
 
 	return nil
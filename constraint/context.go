@@ -27,5 +27,29 @@ func (context *MapContext) value(key string) (interface{}, error) {
 		return value, nil
 	}
 
+	// Walk into nested values when the key is a path
+	if isKeyPath(key) {
+		segments, err := parseKeyPath(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return walkKeyPath(context.context, key, segments)
+	}
+
+	return nil, errors.Errorf("Key '%s' does not exists in context", key)
+}
+
+// valueAtPath is value for a key whose path was parsed ahead of time, segments is nil when the key is not a path.
+func (context *MapContext) valueAtPath(key string, segments []string) (interface{}, error) {
+	if value, ok := context.context[key]; ok {
+		return value, nil
+	}
+
+	if segments != nil {
+		return walkKeyPath(context.context, key, segments)
+	}
+
 	return nil, errors.Errorf("Key '%s' does not exists in context", key)
 }
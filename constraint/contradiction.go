@@ -0,0 +1,239 @@
+package constraint
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// bound is one end of the range of numbers allowed by constraints on a key.
+type bound struct {
+	value     float64
+	inclusive bool
+}
+
+// stringBound is one end of the range of strings allowed by constraints on a key, no bound at all until set.
+type stringBound struct {
+	value     string
+	inclusive bool
+	set       bool
+}
+
+// stringRange is the range of strings allowed by constraints on a key, in the order of compare.
+type stringRange struct {
+	low, high stringBound
+	compare   func(left string, right string) int
+}
+
+// keyRange is what the constraints on a key allow.
+type keyRange struct {
+	lower, upper bound
+	strings      stringRange     // Strings compared lexically, by LT, LTE, GT and GTE
+	versions     stringRange     // Strings compared as versions, by the VERSION_ operators
+	equal        map[string]bool // Strings the key must equal
+	notEqual     map[string]bool // Strings the key must not equal
+	isTrue       bool
+	isFalse      bool
+	passMissing  bool // Whether every constraint on the key passes when the key is missing
+}
+
+// FindContradictions returns, in order, the keys whose constraints can never all be met: numeric ranges that don't
+// overlap, such as temperature GT 80 and temperature LT 70, string or version ranges that don't overlap, a key that
+// must equal two different strings, or a key that must be both true and false. Keys whose constraints all pass when
+// the key is missing are left out since a user without the key meets them. Constraints without a missing key policy
+// don't pass, as when resolved without a default, see FindContradictionsWithPolicy.
+func FindContradictions(constraints []Constraint) []string {
+	return FindContradictionsWithPolicy(constraints, "")
+}
+
+// FindContradictionsWithPolicy is FindContradictions for constraints resolved with a default missing key policy, such
+// as by a service created with one. Constraints that don't set a policy use missing.
+func FindContradictionsWithPolicy(constraints []Constraint, missing MISSING) []string {
+	ranges := make(map[string]*keyRange)
+	r := &resolver{}
+
+	for i := range constraints {
+		c := &constraints[i]
+		k, ok := ranges[c.Key]
+
+		if !ok {
+			k = &keyRange{
+				lower:       bound{value: math.Inf(-1), inclusive: true},
+				upper:       bound{value: math.Inf(1), inclusive: true},
+				strings:     stringRange{compare: strings.Compare},
+				versions:    stringRange{compare: compareVersions},
+				equal:       make(map[string]bool),
+				notEqual:    make(map[string]bool),
+				passMissing: true,
+			}
+			ranges[c.Key] = k
+		}
+
+		policy := c.Missing
+		if policy == "" {
+			policy = missing
+		}
+
+		k.passMissing = k.passMissing && policy == MISSING_PASS
+
+		switch c.Operator {
+		case OPERATOR_IS_TRUE:
+			k.isTrue = true
+			continue
+		case OPERATOR_IS_FALSE:
+			k.isFalse = true
+			continue
+		}
+
+		if s, ok := c.Value.(string); ok {
+			switch c.Operator {
+			case OPERATOR_EQ:
+				k.equal[s] = true
+			case OPERATOR_NOT_EQ:
+				k.notEqual[s] = true
+			case OPERATOR_GT:
+				k.strings.raise(stringBound{s, false, true})
+			case OPERATOR_GTE:
+				k.strings.raise(stringBound{s, true, true})
+			case OPERATOR_LT:
+				k.strings.lower(stringBound{s, false, true})
+			case OPERATOR_LTE:
+				k.strings.lower(stringBound{s, true, true})
+			case OPERATOR_VERSION_GT:
+				k.versions.raise(stringBound{s, false, true})
+			case OPERATOR_VERSION_GTE:
+				k.versions.raise(stringBound{s, true, true})
+			case OPERATOR_VERSION_LT:
+				k.versions.lower(stringBound{s, false, true})
+			case OPERATOR_VERSION_LTE:
+				k.versions.lower(stringBound{s, true, true})
+			}
+
+			continue
+		}
+
+		if f, err := r.forceFloat64(c.Value); err == nil && !math.IsNaN(f) {
+			switch c.Operator {
+			case OPERATOR_EQ:
+				k.lower.raise(bound{f, true})
+				k.upper.lower(bound{f, true})
+			case OPERATOR_GT:
+				k.lower.raise(bound{f, false})
+			case OPERATOR_GTE:
+				k.lower.raise(bound{f, true})
+			case OPERATOR_LT:
+				k.upper.lower(bound{f, false})
+			case OPERATOR_LTE:
+				k.upper.lower(bound{f, true})
+			}
+
+			continue
+		}
+
+		if c.Operator == OPERATOR_BETWEEN || c.Operator == OPERATOR_BETWEEN_EXCLUSIVE {
+			if bounds, err := r.forceFloat64s(c.Value); err == nil && len(bounds) == 2 {
+				inclusive := c.Operator == OPERATOR_BETWEEN
+				k.lower.raise(bound{bounds[0], inclusive})
+				k.upper.lower(bound{bounds[1], inclusive})
+			}
+		}
+	}
+
+	var keys []string
+
+	for key, k := range ranges {
+		if !k.passMissing && k.contradicts() {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (k *keyRange) contradicts() bool {
+	if k.isTrue && k.isFalse {
+		return true
+	}
+
+	if len(k.equal) > 1 {
+		return true
+	}
+
+	for s := range k.equal {
+		if k.notEqual[s] || !k.strings.allows(s) || !k.versions.allows(s) {
+			return true
+		}
+	}
+
+	if k.strings.empty() || k.versions.empty() {
+		return true
+	}
+
+	if k.lower.value > k.upper.value {
+		return true
+	}
+
+	return k.lower.value == k.upper.value && !(k.lower.inclusive && k.upper.inclusive)
+}
+
+// raise moves a lower bound up to other if it is higher.
+func (b *bound) raise(other bound) {
+	if other.value > b.value || (other.value == b.value && !other.inclusive) {
+		*b = other
+	}
+}
+
+// lower moves an upper bound down to other if it is lower.
+func (b *bound) lower(other bound) {
+	if other.value < b.value || (other.value == b.value && !other.inclusive) {
+		*b = other
+	}
+}
+
+// raise moves the lower bound up to other if it is higher.
+func (r *stringRange) raise(other stringBound) {
+	c := r.compare(other.value, r.low.value)
+
+	if !r.low.set || c > 0 || (c == 0 && !other.inclusive) {
+		r.low = other
+	}
+}
+
+// lower moves the upper bound down to other if it is lower.
+func (r *stringRange) lower(other stringBound) {
+	c := r.compare(other.value, r.high.value)
+
+	if !r.high.set || c < 0 || (c == 0 && !other.inclusive) {
+		r.high = other
+	}
+}
+
+// allows tells if s is within both bounds.
+func (r *stringRange) allows(s string) bool {
+	if r.low.set {
+		if c := r.compare(s, r.low.value); c < 0 || (c == 0 && !r.low.inclusive) {
+			return false
+		}
+	}
+
+	if r.high.set {
+		if c := r.compare(s, r.high.value); c > 0 || (c == 0 && !r.high.inclusive) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// empty tells if the bounds leave no string between them.
+func (r *stringRange) empty() bool {
+	if !r.low.set || !r.high.set {
+		return false
+	}
+
+	c := r.compare(r.low.value, r.high.value)
+
+	return c > 0 || (c == 0 && !(r.low.inclusive && r.high.inclusive))
+}
@@ -0,0 +1,61 @@
+package constraint
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFindContradictions(t *testing.T) {
+	tests := []struct {
+		constraints []Constraint
+		keys        []string
+	}{
+		{[]Constraint{*NewConstraint("temperature", OPERATOR_GT, 80), *NewConstraint("temperature", OPERATOR_LT, 70)}, []string{"temperature"}},
+		{[]Constraint{*NewConstraint("temperature", OPERATOR_GT, 70), *NewConstraint("temperature", OPERATOR_LT, 80)}, nil},
+		{[]Constraint{*NewConstraint("temperature", OPERATOR_GTE, 70), *NewConstraint("temperature", OPERATOR_LTE, 70)}, nil},
+		{[]Constraint{*NewConstraint("temperature", OPERATOR_GT, 70), *NewConstraint("temperature", OPERATOR_LTE, 70)}, []string{"temperature"}},
+		{[]Constraint{*NewConstraint("temperature", OPERATOR_EQ, 70.0), *NewConstraint("temperature", OPERATOR_BETWEEN, []interface{}{71.0, 80.0})}, []string{"temperature"}},
+		{[]Constraint{*NewConstraint("temperature", OPERATOR_BETWEEN_EXCLUSIVE, []int{70, 80}), *NewConstraint("temperature", OPERATOR_EQ, 80)}, []string{"temperature"}},
+		{[]Constraint{*NewConstraint("country", OPERATOR_EQ, "US"), *NewConstraint("country", OPERATOR_EQ, "CA")}, []string{"country"}},
+		{[]Constraint{*NewConstraint("country", OPERATOR_EQ, "US"), *NewConstraint("country", OPERATOR_NOT_EQ, "US")}, []string{"country"}},
+		{[]Constraint{*NewConstraint("country", OPERATOR_EQ, "US"), *NewConstraint("country", OPERATOR_NOT_EQ, "CA")}, nil},
+		{[]Constraint{*NewConstraint("premium", OPERATOR_IS_TRUE, nil), *NewConstraint("premium", OPERATOR_IS_FALSE, nil)}, []string{"premium"}},
+		{[]Constraint{*NewConstraint("a", OPERATOR_GT, 1), *NewConstraint("b", OPERATOR_LT, 0)}, nil},
+
+		// Strings are compared lexically, so "4.12" comes before "4.9"
+		{[]Constraint{*NewConstraint("app_version", OPERATOR_GT, "4.12"), *NewConstraint("app_version", OPERATOR_LT, "4.9")}, nil},
+		{[]Constraint{*NewConstraint("name", OPERATOR_GT, "m"), *NewConstraint("name", OPERATOR_LTE, "b")}, []string{"name"}},
+		{[]Constraint{*NewConstraint("name", OPERATOR_GTE, "m"), *NewConstraint("name", OPERATOR_LTE, "m")}, nil},
+		{[]Constraint{*NewConstraint("name", OPERATOR_EQ, "alice"), *NewConstraint("name", OPERATOR_GT, "m")}, []string{"name"}},
+
+		// Unless they are versions
+		{[]Constraint{*NewConstraint("app_version", OPERATOR_VERSION_GT, "4.12"), *NewConstraint("app_version", OPERATOR_VERSION_LT, "4.9")}, []string{"app_version"}},
+		{[]Constraint{*NewConstraint("app_version", OPERATOR_VERSION_GT, "4.9"), *NewConstraint("app_version", OPERATOR_VERSION_LT, "4.12")}, nil},
+		{[]Constraint{*NewConstraint("app_version", OPERATOR_VERSION_GTE, "4.12"), *NewConstraint("app_version", OPERATOR_VERSION_LT, "4.12")}, []string{"app_version"}},
+		{[]Constraint{*NewConstraint("app_version", OPERATOR_EQ, "4.9"), *NewConstraint("app_version", OPERATOR_VERSION_GTE, "4.12")}, []string{"app_version"}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.keys, FindContradictions(test.constraints), "%+v", test.constraints)
+	}
+}
+
+func TestFindContradictionsMissing(t *testing.T) {
+	gt := NewConstraint("temperature", OPERATOR_GT, 80)
+	lt := NewConstraint("temperature", OPERATOR_LT, 70)
+
+	// Users without the key meet both constraints
+	gt.Missing, lt.Missing = MISSING_PASS, MISSING_PASS
+	assert.Empty(t, FindContradictions([]Constraint{*gt, *lt}))
+
+	lt.Missing = MISSING_FAIL
+	assert.Equal(t, []string{"temperature"}, FindContradictions([]Constraint{*gt, *lt}))
+
+	// Constraints without a policy use the default one
+	gt.Missing, lt.Missing = "", ""
+	assert.Equal(t, []string{"temperature"}, FindContradictions([]Constraint{*gt, *lt}))
+	assert.Empty(t, FindContradictionsWithPolicy([]Constraint{*gt, *lt}, MISSING_PASS))
+
+	lt.Missing = MISSING_ERROR
+	assert.Equal(t, []string{"temperature"}, FindContradictionsWithPolicy([]Constraint{*gt, *lt}, MISSING_PASS))
+}
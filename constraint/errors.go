@@ -0,0 +1,68 @@
+package constraint
+
+import (
+	"github.com/juju/errors"
+)
+
+// The kinds of error returned by a Resolver, an Evaluator and Constraint.Validate. Test for them with errors.Is, or
+// use errors.As with an *Error to find the constraint that caused it.
+var (
+	// ErrNoContext is returned when resolving against a nil Context.
+	ErrNoContext = errors.New("no context provided")
+
+	// ErrKeyNotFound is returned when the Key of a constraint is not in the Context.
+	ErrKeyNotFound = errors.New("key not found in context")
+
+	// ErrTypeMismatch is returned when the value in the Context can't be compared with the constraint's Value, or
+	// when a key path goes into a value that can't be traversed.
+	ErrTypeMismatch = errors.New("type mismatch")
+
+	// ErrInvalidOperator is returned for an unknown Operator or one that can't be used with the values compared.
+	ErrInvalidOperator = errors.New("invalid operator")
+
+	// ErrInvalidValue is returned when a constraint's Value does not have the shape its Operator expects.
+	ErrInvalidValue = errors.New("invalid constraint value")
+
+	// ErrInvalidKey is returned when a constraint's Key is empty or malformed.
+	ErrInvalidKey = errors.New("invalid constraint key")
+
+	// ErrInvalidPolicy is returned when a constraint's Missing policy is not one of the MISSING values.
+	ErrInvalidPolicy = errors.New("invalid missing key policy")
+)
+
+// Error is an error about a single constraint. Kind is one of the errors above and Err holds the details.
+type Error struct {
+	Kind     error
+	Key      string
+	Operator OPERATOR
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Is reports whether target is the Kind of the error.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind error, err error) error {
+	return &Error{Kind: kind, Err: err}
+}
+
+// withConstraint returns err with the Key and Operator of the constraint filled in if it is an *Error without them.
+// A copy is returned since errors may be shared.
+func withConstraint(err error, constraint *Constraint) error {
+	e, ok := err.(*Error)
+
+	if !ok || e.Key != "" {
+		return err
+	}
+
+	return &Error{Kind: e.Kind, Key: constraint.Key, Operator: constraint.Operator, Err: e.Err}
+}
@@ -0,0 +1,91 @@
+package constraint
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResolveErrorKinds(t *testing.T) {
+	context := NewMapContext(map[string]interface{}{
+		"country":     "USA",
+		"temperature": 75,
+		"tags":        []string{"a"},
+		"ip":          "10.0.0.1",
+		"object":      struct{}{},
+		"premium":     true,
+	})
+
+	tests := []struct {
+		constraint *Constraint
+		context    Context
+		kind       error
+	}{
+		{NewConstraint("country", OPERATOR_EQ, "USA"), nil, ErrNoContext},
+		{NewConstraint("city", OPERATOR_EQ, "Rome"), context, ErrKeyNotFound},
+		{NewConstraint("device.os", OPERATOR_EQ, "ios"), context, ErrKeyNotFound},
+		{NewConstraint("temperature", OPERATOR_GT, "hot"), context, ErrTypeMismatch},
+		{NewConstraint("country", OPERATOR_IN, []interface{}{1, 2}), context, ErrTypeMismatch},
+		{NewConstraint("object", OPERATOR_EQ, "USA"), context, ErrTypeMismatch},
+		{NewConstraint("country", OPERATOR_HAS_ANY, []string{"USA"}), context, ErrTypeMismatch},
+		{NewConstraint("premium", OPERATOR_EQ, "yes"), context, ErrTypeMismatch},
+		{NewConstraint("country", OPERATOR_CONTAINS, "USA"), context, ErrInvalidOperator},
+		{NewConstraint("country", OPERATOR_EQ, []string{"USA"}), context, ErrInvalidOperator},
+		{NewConstraint("temperature", OPERATOR_HAS_ANY, 1), context, ErrTypeMismatch},
+		{NewConstraint("premium", OPERATOR_GT, true), context, ErrInvalidOperator},
+		{NewConstraint("temperature", OPERATOR_BETWEEN, []int{1, 2, 3}), context, ErrInvalidValue},
+		{NewConstraint("tags", OPERATOR_HAS_ANY, 1), context, ErrInvalidValue},
+		{NewConstraint("ip", OPERATOR_IN_CIDR, []string{"not a network"}), context, ErrInvalidValue},
+	}
+
+	resolver := NewDefaultResolver()
+
+	for _, test := range tests {
+		_, err := resolver.Resolve(test.constraint, test.context)
+		assert.True(t, errors.Is(err, test.kind), "%+v: %v", test.constraint, err)
+
+		var constraintErr *Error
+		assert.True(t, errors.As(err, &constraintErr))
+		assert.Equal(t, test.constraint.Key, constraintErr.Key)
+		assert.Equal(t, test.constraint.Operator, constraintErr.Operator)
+	}
+}
+
+func TestValidateErrorKinds(t *testing.T) {
+	tests := []struct {
+		constraint *Constraint
+		kind       error
+	}{
+		{NewConstraint("", OPERATOR_EQ, "USA"), ErrInvalidKey},
+		{NewConstraint("/device//os", OPERATOR_EQ, "ios"), ErrInvalidKey},
+		{NewConstraint("country", OPERATOR_EQ, nil), ErrInvalidValue},
+		{NewConstraint("country", "LIKE", "US%"), ErrInvalidOperator},
+		{NewConstraint("country", OPERATOR_IN, "USA"), ErrInvalidValue},
+		{NewConstraint("food", OPERATOR_CONTAINS, "banana"), ErrInvalidValue},
+		{NewConstraint("food", OPERATOR_NOT_CONTAINS, 1), ErrInvalidValue},
+	}
+
+	for _, test := range tests {
+		err := test.constraint.Validate()
+		assert.True(t, errors.Is(err, test.kind), "%+v: %v", test.constraint, err)
+		assert.False(t, errors.Is(err, ErrKeyNotFound))
+
+		_, err = Compile(test.constraint)
+		assert.True(t, errors.Is(err, test.kind), "%+v: %v", test.constraint, err)
+	}
+}
+
+func TestEvaluateErrorKinds(t *testing.T) {
+	evaluator, err := Compile(NewConstraint("temperature", OPERATOR_GT, 70))
+	assert.Nil(t, err)
+
+	_, err = evaluator.Evaluate(NewMapContext(map[string]interface{}{}))
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+
+	_, err = evaluator.Evaluate(NewMapContext(map[string]interface{}{"temperature": "hot"}))
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	assert.Contains(t, err.Error(), "could not compare input hot")
+
+	_, err = evaluator.Evaluate(nil)
+	assert.True(t, errors.Is(err, ErrNoContext))
+}
@@ -0,0 +1,263 @@
+package constraint
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/juju/errors"
+	"strings"
+)
+
+// EXPRESSION is intended to act as an enum for the kinds of nodes in an Expression.
+type EXPRESSION = string
+
+const (
+	EXPRESSION_AND        = "AND"
+	EXPRESSION_OR         = "OR"
+	EXPRESSION_NOT        = "NOT"
+	EXPRESSION_CONSTRAINT = "CONSTRAINT"
+)
+
+// Expression is a tree of constraints joined by boolean logic. Leaves hold a Constraint, AND and OR nodes hold two
+// or more Children and a NOT node holds exactly one.
+type Expression struct {
+	Kind       EXPRESSION
+	Children   []*Expression
+	Constraint *Constraint
+}
+
+// operatorSymbols are the operators that have a symbol of their own in the expression syntax. Every other operator
+// is written using its name, e.g. `tags HAS_ANY ["a", "b"]`.
+var operatorSymbols = map[OPERATOR]string{
+	OPERATOR_EQ:     "==",
+	OPERATOR_NOT_EQ: "!=",
+	OPERATOR_LT:     "<",
+	OPERATOR_LTE:    "<=",
+	OPERATOR_GT:     ">",
+	OPERATOR_GTE:    ">=",
+	OPERATOR_IN:     "in",
+	OPERATOR_NOT_IN: "not in",
+}
+
+// NewConstraintExpression returns a leaf Expression holding the constraint.
+func NewConstraintExpression(constraint *Constraint) *Expression {
+	return &Expression{Kind: EXPRESSION_CONSTRAINT, Constraint: constraint}
+}
+
+// NewExpressionFromConstraints returns an Expression that is satisfied when all of the constraints are, which is
+// how a list of constraints in an audience is resolved.
+func NewExpressionFromConstraints(constraints []Constraint) *Expression {
+	if len(constraints) == 1 {
+		return NewConstraintExpression(&constraints[0])
+	}
+
+	expression := &Expression{Kind: EXPRESSION_AND}
+
+	for i := range constraints {
+		expression.Children = append(expression.Children, NewConstraintExpression(&constraints[i]))
+	}
+
+	return expression
+}
+
+// Validate checks the shape of the tree and validates every constraint in it.
+func (e *Expression) Validate() error {
+	switch e.Kind {
+	case EXPRESSION_CONSTRAINT:
+		if e.Constraint == nil {
+			return errors.New("constraint expression has no constraint")
+		}
+
+		return e.Constraint.Validate()
+	case EXPRESSION_AND, EXPRESSION_OR:
+		if len(e.Children) < 2 {
+			return errors.Errorf("%s expression needs at least two children", e.Kind)
+		}
+	case EXPRESSION_NOT:
+		if len(e.Children) != 1 {
+			return errors.New("NOT expression needs exactly one child")
+		}
+	default:
+		return errors.Errorf("invalid expression kind: %s", e.Kind)
+	}
+
+	for _, child := range e.Children {
+		if err := child.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Constraints returns every constraint in the tree from left to right.
+func (e *Expression) Constraints() []*Constraint {
+	if e.Kind == EXPRESSION_CONSTRAINT {
+		return []*Constraint{e.Constraint}
+	}
+
+	constraints := make([]*Constraint, 0, len(e.Children))
+
+	for _, child := range e.Children {
+		constraints = append(constraints, child.Constraints()...)
+	}
+
+	return constraints
+}
+
+// Resolve returns true if the Expression is satisfied by the Context. A constraint that can't be resolved counts
+// as not satisfied, and so does its negation. The error of such a constraint is returned unless the Expression is
+// satisfied regardless.
+func (e *Expression) Resolve(resolver Resolver, context Context) (bool, error) {
+	switch e.Kind {
+	case EXPRESSION_CONSTRAINT:
+		return resolver.Resolve(e.Constraint, context)
+	case EXPRESSION_AND:
+		for _, child := range e.Children {
+			if ok, err := child.Resolve(resolver, context); !ok || err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case EXPRESSION_OR:
+		var firstErr error
+
+		for _, child := range e.Children {
+			ok, err := child.Resolve(resolver, context)
+
+			if ok && err == nil {
+				return true, nil
+			}
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		return false, firstErr
+	case EXPRESSION_NOT:
+		ok, err := e.Children[0].Resolve(resolver, context)
+
+		if err != nil {
+			return false, err
+		}
+
+		return !ok, nil
+	default:
+		return false, errors.Errorf("invalid expression kind: %s", e.Kind)
+	}
+}
+
+// String prints the Expression using the syntax accepted by ParseExpression.
+func (e *Expression) String() string {
+	var buffer bytes.Buffer
+	e.write(&buffer)
+	return buffer.String()
+}
+
+func (e *Expression) write(buffer *bytes.Buffer) {
+	switch e.Kind {
+	case EXPRESSION_CONSTRAINT:
+		writeConstraint(buffer, e.Constraint)
+	case EXPRESSION_AND, EXPRESSION_OR:
+		separator := " && "
+		if e.Kind == EXPRESSION_OR {
+			separator = " || "
+		}
+
+		for i, child := range e.Children {
+			if i > 0 {
+				buffer.WriteString(separator)
+			}
+
+			// AND binds tighter than OR, so only nested ORs need parentheses
+			parenthesize := e.Kind == EXPRESSION_AND && child.Kind == EXPRESSION_OR
+			parenthesize = parenthesize || (e.Kind == child.Kind)
+
+			if parenthesize {
+				buffer.WriteString("(")
+			}
+
+			child.write(buffer)
+
+			if parenthesize {
+				buffer.WriteString(")")
+			}
+		}
+	case EXPRESSION_NOT:
+		buffer.WriteString("!(")
+		e.Children[0].write(buffer)
+		buffer.WriteString(")")
+	}
+}
+
+func writeConstraint(buffer *bytes.Buffer, constraint *Constraint) {
+	switch constraint.Operator {
+	case OPERATOR_IS_TRUE:
+		buffer.WriteString(formatKey(constraint.Key))
+	case OPERATOR_IS_FALSE:
+		buffer.WriteString("!")
+		buffer.WriteString(formatKey(constraint.Key))
+	default:
+		symbol, ok := operatorSymbols[constraint.Operator]
+		if !ok {
+			symbol = constraint.Operator
+		}
+
+		buffer.WriteString(formatKey(constraint.Key))
+		buffer.WriteString(" ")
+		buffer.WriteString(symbol)
+		buffer.WriteString(" ")
+		buffer.WriteString(formatValue(constraint.Value))
+	}
+
+	if constraint.Missing != "" {
+		buffer.WriteString(" missing ")
+		buffer.WriteString(constraint.Missing)
+	}
+}
+
+// formatKey prints a Key as an identifier when the parser reads it as one, and as a JSON string otherwise.
+func formatKey(key string) string {
+	for i, r := range key {
+		if (i == 0 && !isIdentStart(r)) || !isIdentRune(r) {
+			return formatValue(key)
+		}
+	}
+
+	if key == "" {
+		return formatValue(key)
+	}
+
+	return key
+}
+
+// formatValue prints a constraint Value as a JSON literal, which is what the parser reads values as.
+func formatValue(value interface{}) string {
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return "null"
+	}
+
+	s := strings.TrimSuffix(buffer.String(), "\n")
+
+	// JSON separates list elements with a bare comma, add a space to read more naturally
+	if strings.HasPrefix(s, "[") {
+		var elements []json.RawMessage
+
+		if json.Unmarshal([]byte(s), &elements) == nil {
+			parts := make([]string, len(elements))
+			for i, element := range elements {
+				parts[i] = string(element)
+			}
+
+			return "[" + strings.Join(parts, ", ") + "]"
+		}
+	}
+
+	return s
+}
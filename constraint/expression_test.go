@@ -0,0 +1,280 @@
+package constraint
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	expression, err := ParseExpression(`country in ["US","CA"] && app_version VERSION_GTE "4.12" && !is_employee`)
+	assert.Nil(t, err)
+
+	assert.Equal(t, EXPRESSION_AND, expression.Kind)
+	assert.Equal(t, 3, len(expression.Children))
+	assert.Equal(t, *NewConstraint("country", OPERATOR_IN, []interface{}{"US", "CA"}), *expression.Children[0].Constraint)
+	assert.Equal(t, *NewConstraint("app_version", OPERATOR_VERSION_GTE, "4.12"), *expression.Children[1].Constraint)
+	assert.Equal(t, *NewConstraint("is_employee", OPERATOR_IS_FALSE, nil), *expression.Children[2].Constraint)
+
+	assert.Equal(t, `country in ["US", "CA"] && app_version VERSION_GTE "4.12" && !is_employee`, expression.String())
+}
+
+func TestResolveExpression(t *testing.T) {
+	expression, err := ParseExpression(`country in ["US","CA"] && app_version VERSION_GTE "4.12" && !is_employee`)
+	assert.Nil(t, err)
+
+	resolver := resolver{}
+
+	tests := []struct {
+		context  map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"country": "US", "app_version": "4.12.1", "is_employee": false}, true},
+		{map[string]interface{}{"country": "CA", "app_version": "10.0", "is_employee": false}, true},
+		{map[string]interface{}{"country": "US", "app_version": "4.9", "is_employee": false}, false},
+		{map[string]interface{}{"country": "MX", "app_version": "4.12", "is_employee": false}, false},
+		{map[string]interface{}{"country": "US", "app_version": "4.12", "is_employee": true}, false},
+	}
+
+	for _, test := range tests {
+		ok, err := expression.Resolve(&resolver, NewMapContext(test.context))
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, ok, "%+v", test.context)
+	}
+
+	// A missing key does not satisfy a constraint or its negation
+	negated, err := ParseExpression(`!(country == "US")`)
+	assert.Nil(t, err)
+
+	ok, err := negated.Resolve(&resolver, NewMapContext(map[string]interface{}{}))
+	assert.NotNil(t, err)
+	assert.False(t, ok)
+
+	// An OR is satisfied if any branch is, even when another can't be resolved
+	either, err := ParseExpression(`country == "US" || temperature > 70`)
+	assert.Nil(t, err)
+
+	ok, err = either.Resolve(&resolver, NewMapContext(map[string]interface{}{"temperature": 75}))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = either.Resolve(&resolver, NewMapContext(map[string]interface{}{"temperature": 65}))
+	assert.NotNil(t, err)
+	assert.False(t, ok)
+}
+
+func TestParseExpressionPrecedence(t *testing.T) {
+	expression, err := ParseExpression(`a || b && !c`)
+	assert.Nil(t, err)
+
+	// && binds tighter than ||
+	assert.Equal(t, EXPRESSION_OR, expression.Kind)
+	assert.Equal(t, EXPRESSION_CONSTRAINT, expression.Children[0].Kind)
+	assert.Equal(t, EXPRESSION_AND, expression.Children[1].Kind)
+	assert.Equal(t, OPERATOR_IS_FALSE, expression.Children[1].Children[1].Constraint.Operator)
+
+	grouped, err := ParseExpression(`(a || b) && !(c && d.e)`)
+	assert.Nil(t, err)
+	assert.Equal(t, EXPRESSION_AND, grouped.Kind)
+	assert.Equal(t, EXPRESSION_OR, grouped.Children[0].Kind)
+	assert.Equal(t, EXPRESSION_NOT, grouped.Children[1].Kind)
+	assert.Equal(t, "(a || b) && !(c && d.e)", grouped.String())
+
+	// Parentheses don't change how a negated key is parsed
+	negated, err := ParseExpression(`!a`)
+	assert.Nil(t, err)
+
+	for _, input := range []string{`!(a)`, `!((a))`, `(!a)`} {
+		parsed, err := ParseExpression(input)
+		assert.Nil(t, err, input)
+		assert.Equal(t, negated, parsed, input)
+	}
+}
+
+func TestParseExpressionRoundTrip(t *testing.T) {
+	inputs := []string{
+		`country == "US"`,
+		`country != "IT" && temperature > 70 && temperature <= 80.5`,
+		`store_id not in [12, 55, 910] || store_id in []`,
+		`ip IN_CIDR ["10.0.0.0/8", "2001:db8::/32"] && /device/os == "ios"`,
+		`tags HAS_ANY ["a", "b"] && tags HAS_NONE [1, 2.5, -3e+21]`,
+		`age BETWEEN [18, 65] && score BETWEEN_EXCLUSIVE [0, 1]`,
+		`food CONTAINS ["banana", "berry"] || food NCONTAINS ["quote \" and \\ slash"]`,
+		`!(a && b) || (c || d) && is_premium == true`,
+		`(a && b) && !c`,
+		`!(!x)`,
+		`location WITHIN_KM {"km":5,"lat":40.7}`,
+		`country == "US" missing PASS && !is_employee missing FAIL && beta missing ERROR`,
+		`"user name" == "x" && !"1st" && "a b.c" == 1`,
+	}
+
+	assert.Nil(t, RegisterOperator("WITHIN_KM", nil, func(interface{}, interface{}) (bool, error) { return true, nil }))
+	defer UnregisterOperator("WITHIN_KM")
+
+	for _, input := range inputs {
+		expression, err := ParseExpression(input)
+		assert.Nil(t, err, input)
+
+		printed := expression.String()
+		reparsed, err := ParseExpression(printed)
+		assert.Nil(t, err, printed)
+
+		// Printing and parsing again gives the same tree and the same text
+		assert.Equal(t, expression, reparsed, input)
+		assert.Equal(t, printed, reparsed.String(), input)
+	}
+}
+
+// TestParsePrintedExpressions checks that printing any expression and parsing it back gives the same expression.
+func TestParsePrintedExpressions(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		expression := randomExpression(random, 3)
+		printed := expression.String()
+
+		parsed, err := ParseExpression(printed)
+		assert.Nil(t, err, printed)
+		assert.Equal(t, expression, parsed, printed)
+	}
+}
+
+var randomKeys = []string{"country", "device.os", "/device/os", "/a~1b/~0c", "user name", "1st", "-x", "a..b", "naïve", "in", "not", "missing", `quote"d`, "tab\t"}
+
+func randomExpression(random *rand.Rand, depth int) *Expression {
+	if depth == 0 || random.Intn(3) == 0 {
+		return NewConstraintExpression(randomConstraint(random))
+	}
+
+	switch random.Intn(3) {
+	case 0:
+		child := randomExpression(random, depth-1)
+
+		// A negated key is parsed as IS_FALSE rather than as a NOT
+		if child.Kind == EXPRESSION_CONSTRAINT && child.Constraint.Operator == OPERATOR_IS_TRUE {
+			child.Constraint.Operator = OPERATOR_NOT_EQ
+			child.Constraint.Value = true
+		}
+
+		return &Expression{Kind: EXPRESSION_NOT, Children: []*Expression{child}}
+	default:
+		kind := EXPRESSION_AND
+		if random.Intn(2) == 0 {
+			kind = EXPRESSION_OR
+		}
+
+		expression := &Expression{Kind: kind}
+		for j := 2 + random.Intn(2); j > 0; j-- {
+			expression.Children = append(expression.Children, randomExpression(random, depth-1))
+		}
+
+		return expression
+	}
+}
+
+func randomConstraint(random *rand.Rand) *Constraint {
+	key := randomKeys[random.Intn(len(randomKeys))]
+	numbers := []interface{}{random.NormFloat64() * 100, float64(random.Intn(10)), -1e21}
+	strings := []interface{}{"US", "4.12", `quote " and \ slash`, "日本", ""}
+
+	var constraint *Constraint
+
+	switch random.Intn(10) {
+	case 0:
+		constraint = NewConstraint(key, OPERATOR_IS_TRUE, nil)
+	case 1:
+		constraint = NewConstraint(key, OPERATOR_IS_FALSE, nil)
+	case 2:
+		constraint = NewConstraint(key, OPERATOR_EQ, strings[random.Intn(len(strings))])
+	case 3:
+		constraint = NewConstraint(key, OPERATOR_NOT_EQ, random.Intn(2) == 0)
+	case 4:
+		operators := []OPERATOR{OPERATOR_LT, OPERATOR_LTE, OPERATOR_GT, OPERATOR_GTE}
+		constraint = NewConstraint(key, operators[random.Intn(len(operators))], numbers[random.Intn(len(numbers))])
+	case 5:
+		operators := []OPERATOR{OPERATOR_VERSION_LT, OPERATOR_VERSION_LTE, OPERATOR_VERSION_GT, OPERATOR_VERSION_GTE}
+		constraint = NewConstraint(key, operators[random.Intn(len(operators))], strings[random.Intn(len(strings))])
+	case 6:
+		operators := []OPERATOR{OPERATOR_IN, OPERATOR_NOT_IN, OPERATOR_CONTAINS, OPERATOR_NOT_CONTAINS, OPERATOR_HAS_ANY}
+		values := strings[:random.Intn(len(strings))]
+		if random.Intn(2) == 0 {
+			values = numbers[:random.Intn(len(numbers))]
+		}
+		constraint = NewConstraint(key, operators[random.Intn(len(operators))], append([]interface{}{}, values...))
+	case 7:
+		constraint = NewConstraint(key, OPERATOR_BETWEEN, []interface{}{-1e21, numbers[random.Intn(len(numbers))]})
+	case 8:
+		constraint = NewConstraint(key, OPERATOR_IN_CIDR, []interface{}{"10.0.0.0/8", "2001:db8::/32"})
+	default:
+		constraint = NewConstraint(key, OPERATOR_EQ, numbers[random.Intn(len(numbers))])
+	}
+
+	missing := []MISSING{"", MISSING_FAIL, MISSING_PASS, MISSING_ERROR}
+	constraint.Missing = missing[random.Intn(len(missing))]
+
+	return constraint
+}
+
+func TestExpressionFromConstraints(t *testing.T) {
+	var constraints []Constraint
+	data := `[{"key":"country","operator":"EQ","value":"ITALY"},{"key":"food","operator":"CONTAINS","value":["banana","berry"]}]`
+	assert.Nil(t, json.Unmarshal([]byte(data), &constraints))
+
+	expression := NewExpressionFromConstraints(constraints)
+	assert.Equal(t, `country == "ITALY" && food CONTAINS ["banana", "berry"]`, expression.String())
+
+	parsed, err := ParseExpression(expression.String())
+	assert.Nil(t, err)
+	assert.Equal(t, expression, parsed)
+	assert.Equal(t, 2, len(parsed.Constraints()))
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		line    int
+		column  int
+		message string
+	}{
+		{`country ==`, 1, 11, "expected a value, found end of expression"},
+		{`country == "US" &&`, 1, 19, "expected a key"},
+		{`country LIKE "US"`, 1, 9, "unknown operator 'LIKE'"},
+		{`(country == "US"`, 1, 17, "expected ')'"},
+		{`country == "US")`, 1, 16, "unexpected ')'"},
+		{`country == "US" # comment`, 1, 17, `unexpected character "#"`},
+		{`country in "US"`, 1, 12, "invalid constraint Value"},
+		{`a && b in 1`, 1, 11, "invalid constraint Value"},
+		{`country == "US`, 1, 12, "invalid value"},
+		{`a == 1 &&` + "\n" + `b == [1, 2`, 2, 11, "expected ','"},
+		{`/device//os == "ios"`, 1, 1, "empty segment"},
+		{`x not y`, 1, 3, "unknown operator 'not'"},
+		{`x == 1 missing MAYBE`, 1, 16, "invalid missing key policy"},
+		{`x missing`, 1, 10, "expected a missing key policy"},
+		{`"x == 1`, 1, 1, "invalid key"},
+		{``, 1, 1, "expected a key"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseExpression(test.input)
+		assert.NotNil(t, err, test.input)
+
+		parseErr, ok := err.(*ParseError)
+		assert.True(t, ok, test.input)
+
+		if ok {
+			assert.Equal(t, test.line, parseErr.Line, test.input)
+			assert.Equal(t, test.column, parseErr.Column, test.input)
+			assert.Contains(t, parseErr.Error(), test.message, test.input)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.True(t, compareVersions("4.12", "4.9") > 0)
+	assert.True(t, compareVersions("4.12", "4.12.0") < 0)
+	assert.True(t, compareVersions("10.0", "9.9.9") > 0)
+	assert.True(t, compareVersions("4.12", "4.12") == 0)
+	assert.True(t, compareVersions("apple", "banana") < 0)
+	assert.True(t, compareVersions("1.2-beta", "1.2") > 0)
+}
@@ -0,0 +1,49 @@
+package constraint
+
+import (
+	"github.com/juju/errors"
+)
+
+// MISSING is intended to act as an enum for what happens when the Key of a constraint is not in the Context.
+type MISSING = string
+
+const (
+	MISSING_FAIL  = "FAIL"  // The constraint is not satisfied
+	MISSING_PASS  = "PASS"  // The constraint is satisfied
+	MISSING_ERROR = "ERROR" // Resolving returns an error matching ErrKeyNotFound
+)
+
+// ValidateMissing returns an error if the policy is not one of the MISSING values. An empty policy is valid and
+// means the default of whatever resolves the constraint is used.
+func ValidateMissing(missing MISSING) error {
+	switch missing {
+	case "", MISSING_FAIL, MISSING_PASS, MISSING_ERROR:
+		return nil
+	default:
+		return newError(ErrInvalidPolicy, errors.Errorf("invalid missing key policy: %s", missing))
+	}
+}
+
+// missingResult returns the result of a constraint whose Key is not in the Context. The constraint's own policy
+// takes precedence over the fallback, and MISSING_ERROR is used when neither is set. An *Error, such as a path into a
+// value that can't be traversed, is not a missing key and is returned whatever the policy.
+func missingResult(constraint *Constraint, fallback MISSING, err error) (bool, error) {
+	if _, ok := err.(*Error); ok {
+		return false, err
+	}
+
+	missing := constraint.Missing
+
+	if missing == "" {
+		missing = fallback
+	}
+
+	switch missing {
+	case MISSING_FAIL:
+		return false, nil
+	case MISSING_PASS:
+		return true, nil
+	default:
+		return false, newError(ErrKeyNotFound, errors.Annotatef(err, "Key not found in context: %s", constraint.Key))
+	}
+}
@@ -0,0 +1,143 @@
+package constraint
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// missingTestValues has a valid constraint Value for every built in operator.
+var missingTestValues = map[OPERATOR]interface{}{
+	OPERATOR_EQ:                "ITALY",
+	OPERATOR_NOT_EQ:            "ITALY",
+	OPERATOR_LT:                80,
+	OPERATOR_LTE:               80,
+	OPERATOR_GT:                70,
+	OPERATOR_GTE:               70,
+	OPERATOR_CONTAINS:          []interface{}{"banana", "berry"},
+	OPERATOR_NOT_CONTAINS:      []interface{}{"banana", "berry"},
+	OPERATOR_IN_CIDR:           []interface{}{"10.0.0.0/8"},
+	OPERATOR_NOT_IN_CIDR:       []interface{}{"10.0.0.0/8"},
+	OPERATOR_IN:                []interface{}{"US", "CA"},
+	OPERATOR_NOT_IN:            []interface{}{12, 55},
+	OPERATOR_BETWEEN:           []interface{}{18, 65},
+	OPERATOR_BETWEEN_EXCLUSIVE: []interface{}{0, 1},
+	OPERATOR_IS_TRUE:           nil,
+	OPERATOR_IS_FALSE:          nil,
+	OPERATOR_HAS_ANY:           []interface{}{"a", "b"},
+	OPERATOR_HAS_ALL:           []interface{}{"a", "b"},
+	OPERATOR_HAS_NONE:          []interface{}{"a", "b"},
+	OPERATOR_VERSION_LT:        "4.12",
+	OPERATOR_VERSION_LTE:       "4.12",
+	OPERATOR_VERSION_GT:        "4.12",
+	OPERATOR_VERSION_GTE:       "4.12",
+}
+
+// TestMissingKeyPolicy documents what every operator resolves to when its key is not in the context: an error by
+// default, or whatever the constraint's policy or else the resolver's policy says.
+func TestMissingKeyPolicy(t *testing.T) {
+	assert.Equal(t, len(builtinOperators), len(missingTestValues))
+
+	context := NewMapContext(map[string]interface{}{"other": "value"})
+
+	tests := []struct {
+		resolverPolicy   MISSING
+		constraintPolicy MISSING
+		expected         bool
+		kind             error
+	}{
+		{"", "", false, ErrKeyNotFound},
+		{"", MISSING_FAIL, false, nil},
+		{"", MISSING_PASS, true, nil},
+		{"", MISSING_ERROR, false, ErrKeyNotFound},
+		{MISSING_FAIL, "", false, nil},
+		{MISSING_PASS, "", true, nil},
+		{MISSING_ERROR, "", false, ErrKeyNotFound},
+		{MISSING_PASS, MISSING_FAIL, false, nil},
+		{MISSING_FAIL, MISSING_PASS, true, nil},
+		{MISSING_PASS, MISSING_ERROR, false, ErrKeyNotFound},
+	}
+
+	for operator, value := range missingTestValues {
+		for _, key := range []string{"key", "device.os"} {
+			for _, test := range tests {
+				constraint := NewConstraint(key, operator, value)
+				constraint.Missing = test.constraintPolicy
+
+				resolver := NewResolverWithPolicy(test.resolverPolicy)
+				ok, err := resolver.Resolve(constraint, context)
+
+				assert.Equal(t, test.expected, ok, "%s %+v", operator, test)
+				assert.Equal(t, test.kind == nil, err == nil, "%s %+v", operator, test)
+				if test.kind != nil {
+					assert.True(t, errors.Is(err, test.kind), "%s %+v", operator, test)
+				}
+
+				evaluator, compileErr := CompileWithPolicy(constraint, test.resolverPolicy)
+				assert.Nil(t, compileErr)
+
+				ok, err = evaluator.Evaluate(context)
+
+				assert.Equal(t, test.expected, ok, "%s %+v", operator, test)
+				assert.Equal(t, test.kind == nil, err == nil, "%s %+v", operator, test)
+			}
+		}
+	}
+}
+
+func TestMissingKeyPolicyDefault(t *testing.T) {
+	context := NewMapContext(map[string]interface{}{})
+
+	// The default resolver and a zero value resolver return an error for a missing key
+	for _, resolver := range []Resolver{NewDefaultResolver(), &resolver{}} {
+		ok, err := resolver.Resolve(NewConstraint("country", OPERATOR_NOT_EQ, "ITALY"), context)
+		assert.False(t, ok)
+		assert.True(t, errors.Is(err, ErrKeyNotFound))
+	}
+
+	// A present key is resolved as usual regardless of the policy
+	resolver := NewResolverWithPolicy(MISSING_PASS)
+	ok, err := resolver.Resolve(NewConstraint("country", OPERATOR_EQ, "ITALY"), NewMapContext(map[string]interface{}{"country": "USA"}))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// A nil context is not a missing key
+	_, err = resolver.Resolve(NewConstraint("country", OPERATOR_EQ, "ITALY"), nil)
+	assert.True(t, errors.Is(err, ErrNoContext))
+}
+
+func TestMissingKeyPolicyExpression(t *testing.T) {
+	expression, err := ParseExpression(`!(country == "ITALY") && temperature > 70`)
+	assert.Nil(t, err)
+
+	context := NewMapContext(map[string]interface{}{"temperature": 75})
+
+	// A missing key fails its constraint, so the negation is satisfied
+	evaluator, err := CompileExpressionWithPolicy(expression, MISSING_FAIL)
+	assert.Nil(t, err)
+
+	ok, err := evaluator.Evaluate(context)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = expression.Resolve(NewResolverWithPolicy(MISSING_FAIL), context)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// By default it is an error, and neither the constraint nor its negation is satisfied
+	ok, err = expression.Resolve(NewDefaultResolver(), context)
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+	assert.False(t, ok)
+}
+
+func TestValidateMissing(t *testing.T) {
+	constraint := NewConstraint("country", OPERATOR_EQ, "ITALY")
+
+	for _, missing := range []MISSING{"", MISSING_FAIL, MISSING_PASS, MISSING_ERROR} {
+		constraint.Missing = missing
+		assert.Nil(t, constraint.Validate())
+	}
+
+	constraint.Missing = "IGNORE"
+	assert.True(t, errors.Is(constraint.Validate(), ErrInvalidPolicy))
+}
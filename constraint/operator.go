@@ -1,31 +1,113 @@
 package constraint
 
-import "github.com/juju/errors"
+import (
+	"github.com/juju/errors"
+	"sort"
+)
 
 // OPERATOR is intended to act as an enum for different types of comparisons.
+//
+// LT, LTE, GT and GTE order numbers by value and strings lexically, byte by byte, so "B" < "a" and "4.12" < "4.9".
+// VERSION_LT, VERSION_LTE, VERSION_GT and VERSION_GTE order strings as versions instead: strings are split on '.'
+// and segments that are both numbers compare numerically, so "4.12" > "4.9". Any other segments compare byte by byte.
 type OPERATOR = string
 
 const (
-	OPERATOR_EQ           = "EQ"
-	OPERATOR_NOT_EQ       = "NEQ"
-	OPERATOR_LT           = "LT"
-	OPERATOR_LTE          = "LTE"
-	OPERATOR_GT           = "GT"
-	OPERATOR_GTE          = "GTE"
-	OPERATOR_CONTAINS     = "CONTAINS"
-	OPERATOR_NOT_CONTAINS = "NCONTAINS"
+	OPERATOR_EQ                = "EQ"
+	OPERATOR_NOT_EQ            = "NEQ"
+	OPERATOR_LT                = "LT"
+	OPERATOR_LTE               = "LTE"
+	OPERATOR_GT                = "GT"
+	OPERATOR_GTE               = "GTE"
+	OPERATOR_CONTAINS          = "CONTAINS"
+	OPERATOR_NOT_CONTAINS      = "NCONTAINS"
+	OPERATOR_IN_CIDR           = "IN_CIDR"
+	OPERATOR_NOT_IN_CIDR       = "NOT_IN_CIDR"
+	OPERATOR_IN                = "IN"
+	OPERATOR_NOT_IN            = "NOT_IN"
+	OPERATOR_BETWEEN           = "BETWEEN"
+	OPERATOR_BETWEEN_EXCLUSIVE = "BETWEEN_EXCLUSIVE"
+	OPERATOR_IS_TRUE           = "IS_TRUE"
+	OPERATOR_IS_FALSE          = "IS_FALSE"
+	OPERATOR_HAS_ANY           = "HAS_ANY"
+	OPERATOR_HAS_ALL           = "HAS_ALL"
+	OPERATOR_HAS_NONE          = "HAS_NONE"
+	OPERATOR_VERSION_LT        = "VERSION_LT"
+	OPERATOR_VERSION_LTE       = "VERSION_LTE"
+	OPERATOR_VERSION_GT        = "VERSION_GT"
+	OPERATOR_VERSION_GTE       = "VERSION_GTE"
 )
 
+// builtinOperators are the operators the default resolver understands without registration.
+var builtinOperators = map[OPERATOR]bool{
+	OPERATOR_EQ:                true,
+	OPERATOR_NOT_EQ:            true,
+	OPERATOR_LT:                true,
+	OPERATOR_LTE:               true,
+	OPERATOR_GT:                true,
+	OPERATOR_GTE:               true,
+	OPERATOR_CONTAINS:          true,
+	OPERATOR_NOT_CONTAINS:      true,
+	OPERATOR_IN_CIDR:           true,
+	OPERATOR_NOT_IN_CIDR:       true,
+	OPERATOR_IN:                true,
+	OPERATOR_NOT_IN:            true,
+	OPERATOR_BETWEEN:           true,
+	OPERATOR_BETWEEN_EXCLUSIVE: true,
+	OPERATOR_IS_TRUE:           true,
+	OPERATOR_IS_FALSE:          true,
+	OPERATOR_HAS_ANY:           true,
+	OPERATOR_HAS_ALL:           true,
+	OPERATOR_HAS_NONE:          true,
+	OPERATOR_VERSION_LT:        true,
+	OPERATOR_VERSION_LTE:       true,
+	OPERATOR_VERSION_GT:        true,
+	OPERATOR_VERSION_GTE:       true,
+}
+
+// BuiltinOperators returns the operators understood without registration, sorted.
+func BuiltinOperators() []OPERATOR {
+	operators := make([]OPERATOR, 0, len(builtinOperators))
+
+	for operator := range builtinOperators {
+		operators = append(operators, operator)
+	}
+
+	sort.Strings(operators)
+
+	return operators
+}
+
+// ValidateOperator returns an error unless the operator is built in or has been registered with RegisterOperator.
 func ValidateOperator(operator OPERATOR) error {
-	if operator == OPERATOR_EQ ||
-		operator == OPERATOR_NOT_EQ ||
-		operator == OPERATOR_LT ||
-		operator == OPERATOR_LTE ||
-		operator == OPERATOR_GT ||
-		operator == OPERATOR_GTE ||
-		operator == OPERATOR_CONTAINS ||
-		operator == OPERATOR_NOT_CONTAINS {
+	if builtinOperators[operator] {
+		return nil
+	}
+
+	if _, ok := lookupOperator(operator); ok {
 		return nil
 	}
-	return errors.Errorf("invalid operator: %s", operator)
+
+	return newError(ErrInvalidOperator, errors.Errorf("invalid operator: %s", operator))
+}
+
+// isListOperator returns true for operators that compare a single context value against a list in the constraint.
+func isListOperator(operator OPERATOR) bool {
+	switch operator {
+	case OPERATOR_CONTAINS, OPERATOR_NOT_CONTAINS, OPERATOR_IN, OPERATOR_NOT_IN, OPERATOR_BETWEEN, OPERATOR_BETWEEN_EXCLUSIVE:
+		return true
+	default:
+		return false
+	}
+}
+
+// isIntersectionOperator returns true for operators that compare a list in the context against a list in the
+// constraint.
+func isIntersectionOperator(operator OPERATOR) bool {
+	return operator == OPERATOR_HAS_ANY || operator == OPERATOR_HAS_ALL || operator == OPERATOR_HAS_NONE
+}
+
+// isUnaryOperator returns true for operators that only inspect the context value and need no constraint Value.
+func isUnaryOperator(operator OPERATOR) bool {
+	return operator == OPERATOR_IS_TRUE || operator == OPERATOR_IS_FALSE
 }
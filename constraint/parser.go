@@ -0,0 +1,493 @@
+package constraint
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseError describes where in an expression parsing failed. Offset is in bytes, Line and Column start at 1.
+type ParseError struct {
+	Offset  int
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// ParseExpression compiles an expression such as
+//
+//	country in ["US", "CA"] && app_version VERSION_GTE "4.12" && !is_employee
+//
+// into an Expression of constraints. Keys are identifiers or paths (device.os, /device/os), or JSON strings for keys
+// that are neither, e.g. "user name". Comparisons use ==, !=, <, <=, >, >=, in and not in, and any other operator is
+// written by name, e.g. `tags HAS_ANY ["a"]` or `app_version VERSION_GTE "4.12"`. A key on its own tests IS_TRUE and
+// a negated key tests IS_FALSE. Values are JSON literals. A constraint may end with the policy for a missing key, as
+// in `country == "US" missing PASS`. && binds tighter than ||, and ! and parentheses work as usual.
+func ParseExpression(input string) (*Expression, error) {
+	p := &parser{input: input}
+	p.next()
+
+	expression, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.token.kind != tokenEOF {
+		return nil, p.errorf(p.token.offset, "unexpected %s", p.token)
+	}
+
+	// Every constraint was validated where it was parsed, see parseComparison
+	return expression, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenSymbol
+	tokenInvalid
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenInvalid:
+		return fmt.Sprintf("character %q", t.text)
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+// symbols are checked in order so longer symbols must come first.
+var symbols = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", "{", "}", ",", ":"}
+
+type parser struct {
+	input  string
+	offset int
+	token  token
+}
+
+// next advances to the next token in the input.
+func (p *parser) next() {
+	for p.offset < len(p.input) {
+		r, size := utf8.DecodeRuneInString(p.input[p.offset:])
+
+		if !unicode.IsSpace(r) {
+			break
+		}
+
+		p.offset += size
+	}
+
+	start := p.offset
+
+	if start >= len(p.input) {
+		p.token = token{kind: tokenEOF, offset: start}
+		return
+	}
+
+	rest := p.input[start:]
+	r, size := utf8.DecodeRuneInString(rest)
+
+	switch {
+	case r == '"':
+		p.offset += p.scanString(rest)
+		p.token = token{kind: tokenString, text: p.input[start:p.offset], offset: start}
+	case r == '-' || (r >= '0' && r <= '9'):
+		p.offset += scanWhile(rest, isNumberRune)
+		p.token = token{kind: tokenNumber, text: p.input[start:p.offset], offset: start}
+	case isIdentStart(r):
+		p.offset += scanWhile(rest, isIdentRune)
+		p.token = token{kind: tokenIdent, text: p.input[start:p.offset], offset: start}
+	default:
+		for _, symbol := range symbols {
+			if strings.HasPrefix(rest, symbol) {
+				p.offset += len(symbol)
+				p.token = token{kind: tokenSymbol, text: symbol, offset: start}
+				return
+			}
+		}
+
+		p.offset += size
+		p.token = token{kind: tokenInvalid, text: string(r), offset: start}
+	}
+}
+
+// scanString returns the length of the quoted string at the start of s, including both quotes. An unterminated
+// string runs to the end of the input and is reported when it is decoded.
+func (p *parser) scanString(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+
+	return len(s)
+}
+
+func scanWhile(s string, accept func(rune) bool) int {
+	for i, r := range s {
+		if !accept(r) {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '/' || unicode.IsLetter(r)
+}
+
+func isIdentRune(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '.' || r == '~' || r == '-'
+}
+
+func isNumberRune(r rune) bool {
+	return (r >= '0' && r <= '9') || r == '-' || r == '+' || r == '.' || r == 'e' || r == 'E'
+}
+
+func (p *parser) errorf(offset int, format string, args ...interface{}) *ParseError {
+	line := 1 + strings.Count(p.input[:offset], "\n")
+	column := offset + 1
+
+	if i := strings.LastIndex(p.input[:offset], "\n"); i >= 0 {
+		column = offset - i
+	}
+
+	return &ParseError{Offset: offset, Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) isSymbol(symbol string) bool {
+	return p.token.kind == tokenSymbol && p.token.text == symbol
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.isSymbol(symbol) {
+		return p.errorf(p.token.offset, "expected '%s', found %s", symbol, p.token)
+	}
+
+	p.next()
+
+	return nil
+}
+
+// parseOr parses: and ( "||" and )*
+func (p *parser) parseOr() (*Expression, error) {
+	return p.parseJoined("||", EXPRESSION_OR, p.parseAnd)
+}
+
+// parseAnd parses: unary ( "&&" unary )*
+func (p *parser) parseAnd() (*Expression, error) {
+	return p.parseJoined("&&", EXPRESSION_AND, p.parseUnary)
+}
+
+func (p *parser) parseJoined(symbol string, kind EXPRESSION, parseOperand func() (*Expression, error)) (*Expression, error) {
+	first, err := parseOperand()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isSymbol(symbol) {
+		return first, nil
+	}
+
+	expression := &Expression{Kind: kind, Children: []*Expression{first}}
+
+	for p.isSymbol(symbol) {
+		p.next()
+
+		operand, err := parseOperand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		expression.Children = append(expression.Children, operand)
+	}
+
+	return expression, nil
+}
+
+// parseUnary parses: "!" unary | "(" or ")" | comparison
+func (p *parser) parseUnary() (*Expression, error) {
+	if p.isSymbol("!") {
+		p.next()
+
+		operand, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// A negated key, with or without parentheses, is written as a constraint of its own
+		if operand.Kind == EXPRESSION_CONSTRAINT && operand.Constraint.Operator == OPERATOR_IS_TRUE {
+			operand.Constraint.Operator = OPERATOR_IS_FALSE
+			return operand, nil
+		}
+
+		return &Expression{Kind: EXPRESSION_NOT, Children: []*Expression{operand}}, nil
+	}
+
+	if p.isSymbol("(") {
+		p.next()
+
+		expression, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+
+		return expression, nil
+	}
+
+	return p.parseComparison()
+}
+
+// parseComparison parses: key [ operator value ] [ "missing" policy ]
+func (p *parser) parseComparison() (*Expression, error) {
+	keyToken := p.token
+	key, err := p.parseKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	operatorToken := p.token
+	operator, ok := p.parseOperator()
+
+	if !ok {
+		// A key on its own must be true
+		if operatorToken.kind == tokenIdent && operatorToken.text != "missing" {
+			return nil, p.errorf(operatorToken.offset, "unknown operator %s", operatorToken)
+		}
+
+		constraint := NewConstraint(key, OPERATOR_IS_TRUE, nil)
+
+		if err := constraint.Validate(); err != nil {
+			return nil, p.errorf(keyToken.offset, "%s", err)
+		}
+
+		return p.parseMissing(constraint)
+	}
+
+	valueOffset := p.token.offset
+	value, err := p.parseValue()
+
+	if err != nil {
+		return nil, err
+	}
+
+	constraint := NewConstraint(key, operator, value)
+
+	if err := constraint.Validate(); err != nil {
+		return nil, p.errorf(valueOffset, "%s", err)
+	}
+
+	return p.parseMissing(constraint)
+}
+
+// parseKey parses a key, written as an identifier or as a JSON string.
+func (p *parser) parseKey() (string, error) {
+	t := p.token
+	key := t.text
+
+	switch t.kind {
+	case tokenIdent:
+	case tokenString:
+		if err := json.Unmarshal([]byte(t.text), &key); err != nil {
+			return "", p.errorf(t.offset, "invalid key %s", t)
+		}
+	default:
+		return "", p.errorf(t.offset, "expected a key, found %s", t)
+	}
+
+	if err := ValidateKey(key); err != nil {
+		return "", p.errorf(t.offset, "%s", err)
+	}
+
+	p.next()
+
+	return key, nil
+}
+
+// parseMissing parses the optional policy for a missing key that ends a constraint.
+func (p *parser) parseMissing(constraint *Constraint) (*Expression, error) {
+	if p.token.kind != tokenIdent || p.token.text != "missing" {
+		return NewConstraintExpression(constraint), nil
+	}
+
+	p.next()
+
+	if p.token.kind != tokenIdent {
+		return nil, p.errorf(p.token.offset, "expected a missing key policy, found %s", p.token)
+	}
+
+	if err := ValidateMissing(p.token.text); err != nil {
+		return nil, p.errorf(p.token.offset, "%s", err)
+	}
+
+	constraint.Missing = p.token.text
+	p.next()
+
+	return NewConstraintExpression(constraint), nil
+}
+
+// parseOperator consumes an operator if there is one.
+func (p *parser) parseOperator() (OPERATOR, bool) {
+	switch p.token.kind {
+	case tokenSymbol:
+		for operator, symbol := range operatorSymbols {
+			if symbol == p.token.text {
+				p.next()
+				return operator, true
+			}
+		}
+	case tokenIdent:
+		switch p.token.text {
+		case "in":
+			p.next()
+			return OPERATOR_IN, true
+		case "not":
+			// "not" is only an operator when followed by "in"
+			saved := *p
+			p.next()
+
+			if p.token.kind == tokenIdent && p.token.text == "in" {
+				p.next()
+				return OPERATOR_NOT_IN, true
+			}
+
+			*p = saved
+		default:
+			if ValidateOperator(p.token.text) == nil {
+				operator := p.token.text
+				p.next()
+				return operator, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// parseValue parses a JSON literal: a string, number, true, false, null, list or object.
+func (p *parser) parseValue() (interface{}, error) {
+	t := p.token
+
+	switch {
+	case t.kind == tokenString, t.kind == tokenNumber:
+		var value interface{}
+
+		if err := json.Unmarshal([]byte(t.text), &value); err != nil {
+			return nil, p.errorf(t.offset, "invalid value %s", t)
+		}
+
+		p.next()
+
+		return value, nil
+	case t.kind == tokenIdent && (t.text == "true" || t.text == "false"):
+		p.next()
+		return t.text == "true", nil
+	case t.kind == tokenIdent && t.text == "null":
+		p.next()
+		return nil, nil
+	case p.isSymbol("["):
+		return p.parseList()
+	case p.isSymbol("{"):
+		return p.parseObject()
+	default:
+		return nil, p.errorf(t.offset, "expected a value, found %s", t)
+	}
+}
+
+func (p *parser) parseList() (interface{}, error) {
+	p.next()
+
+	list := make([]interface{}, 0)
+
+	for !p.isSymbol("]") {
+		if len(list) > 0 {
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := p.parseValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, value)
+	}
+
+	p.next()
+
+	return list, nil
+}
+
+func (p *parser) parseObject() (interface{}, error) {
+	p.next()
+
+	object := make(map[string]interface{})
+
+	for !p.isSymbol("}") {
+		if len(object) > 0 {
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.token.kind != tokenString {
+			return nil, p.errorf(p.token.offset, "expected an object key, found %s", p.token)
+		}
+
+		key, err := p.parseValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expectSymbol(":"); err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		object[key.(string)] = value
+	}
+
+	p.next()
+
+	return object, nil
+}
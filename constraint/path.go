@@ -0,0 +1,196 @@
+package constraint
+
+import (
+	"bytes"
+	"github.com/juju/errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ValidateKey checks that a constraint Key is a well formed path. A Key is either a dotted path such as
+// "device.os" or a JSON pointer such as "/device/os". Both walk nested maps, structs and slices in a Context.
+// Dotted keys with an empty segment, such as "a..b" or "version.", are not paths and are looked up as a single name.
+func ValidateKey(key string) error {
+	if key != "" && !isKeyPath(key) {
+		return nil
+	}
+
+	_, err := parseKeyPath(key)
+	return err
+}
+
+// isKeyPath returns true if the key should be treated as a path into nested values rather than a single name.
+func isKeyPath(key string) bool {
+	if strings.HasPrefix(key, "/") {
+		return true
+	}
+
+	if !strings.Contains(key, ".") {
+		return false
+	}
+
+	// Keys that can't be dotted paths keep being looked up as they are written
+	for _, segment := range strings.Split(key, ".") {
+		if segment == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseKeyPath splits a Key into the segments that are looked up one after another.
+func parseKeyPath(key string) ([]string, error) {
+	if key == "" {
+		return nil, errors.Errorf("key must not be empty")
+	}
+
+	if !strings.HasPrefix(key, "/") {
+		segments := strings.Split(key, ".")
+
+		for _, segment := range segments {
+			if segment == "" {
+				return nil, errors.Errorf("key '%s' has an empty segment", key)
+			}
+		}
+
+		return segments, nil
+	}
+
+	// JSON pointers escape '~' as "~0" and '/' as "~1"
+	segments := strings.Split(key[1:], "/")
+
+	for i, segment := range segments {
+		if segment == "" {
+			return nil, errors.Errorf("key '%s' has an empty segment", key)
+		}
+
+		for j := 0; j < len(segment); j++ {
+			if segment[j] == '~' && (j+1 == len(segment) || (segment[j+1] != '0' && segment[j+1] != '1')) {
+				return nil, errors.Errorf("key '%s' has an invalid escape in segment '%s'", key, segment)
+			}
+		}
+
+		segments[i] = strings.Replace(strings.Replace(segment, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return segments, nil
+}
+
+// walkKeyPath follows each segment of a path starting from root. A segment that is not found returns a plain error,
+// while a value that can't be traversed by the next segment returns an *Error of kind ErrTypeMismatch.
+func walkKeyPath(root interface{}, key string, segments []string) (interface{}, error) {
+	current := root
+
+	for i, segment := range segments {
+		next, found, err := lookupSegment(current, segment)
+
+		if err != nil {
+			return nil, newError(ErrTypeMismatch, errors.Annotatef(err, "could not traverse '%s' at '%s'", key, formatKeyPath(key, segments[:i])))
+		}
+
+		if !found {
+			return nil, errors.Errorf("Key '%s' does not exists in context: missing segment '%s'", key, segment)
+		}
+
+		current = next
+	}
+
+	return current, nil
+}
+
+// formatKeyPath writes segments of a key the way the key is written, as a dotted path or as a JSON pointer.
+func formatKeyPath(key string, segments []string) string {
+	if !strings.HasPrefix(key, "/") {
+		return strings.Join(segments, ".")
+	}
+
+	var buffer bytes.Buffer
+
+	for _, segment := range segments {
+		buffer.WriteString("/")
+		buffer.WriteString(strings.Replace(strings.Replace(segment, "~", "~0", -1), "/", "~1", -1))
+	}
+
+	return buffer.String()
+}
+
+// lookupSegment returns the child of value named by segment. A missing child is reported by found being false, a
+// value that can't have children returns an error.
+func lookupSegment(value interface{}, segment string) (interface{}, bool, error) {
+	// Fast path for what JSON decoding produces
+	if m, ok := value.(map[string]interface{}); ok {
+		child, found := m[segment]
+		return child, found, nil
+	}
+
+	v := reflect.ValueOf(value)
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false, errors.Errorf("map keys of %s are not strings", v.Type())
+		}
+
+		child := v.MapIndex(reflect.ValueOf(segment).Convert(v.Type().Key()))
+
+		if !child.IsValid() {
+			return nil, false, nil
+		}
+
+		return child.Interface(), true, nil
+	case reflect.Struct:
+		field, found := structField(v, segment)
+
+		if !found {
+			return nil, false, nil
+		}
+
+		return field.Interface(), true, nil
+	case reflect.Slice, reflect.Array:
+		index, err := strconv.Atoi(segment)
+
+		if err != nil || index < 0 {
+			return nil, false, errors.Errorf("'%s' is not a valid list index", segment)
+		}
+
+		if index >= v.Len() {
+			return nil, false, nil
+		}
+
+		return v.Index(index).Interface(), true, nil
+	case reflect.Invalid:
+		return nil, false, nil
+	default:
+		return nil, false, errors.Errorf("%s is not traversable", v.Type())
+	}
+}
+
+// structField finds an exported field by its json name, falling back to the Go field name.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if field.PkgPath != "" || tag == "-" {
+			continue
+		}
+
+		if tag == name || (tag == "" && field.Name == name) {
+			return v.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
@@ -0,0 +1,191 @@
+package constraint
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testDevice struct {
+	OS      string   `json:"os"`
+	Version float64  `json:"version"`
+	Tags    []string `json:"tags"`
+	Model   string
+	Secret  string `json:"-"`
+	hidden  string
+}
+
+func TestPathNestedMaps(t *testing.T) {
+	var context map[string]interface{}
+	data := `{"device": {"os": "ios", "version": "17.2"}, "geo": {"country": "US"}, "a/b": {"~c": 4}}`
+	assert.Nil(t, json.Unmarshal([]byte(data), &context))
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	// Dotted path
+	constraintOS := NewConstraint("device.os", OPERATOR_EQ, "ios")
+	assert.Nil(t, constraintOS.Validate())
+	okOS, errOS := resolver.Resolve(constraintOS, mapContext)
+	assert.Nil(t, errOS)
+	assert.True(t, okOS)
+
+	// JSON pointer
+	constraintCountry := NewConstraint("/geo/country", OPERATOR_CONTAINS, []string{"US", "CA"})
+	assert.Nil(t, constraintCountry.Validate())
+	okCountry, errCountry := resolver.Resolve(constraintCountry, mapContext)
+	assert.Nil(t, errCountry)
+	assert.True(t, okCountry)
+
+	// JSON pointer with escapes
+	constraintEscaped := NewConstraint("/a~1b/~0c", OPERATOR_EQ, 4)
+	assert.Nil(t, constraintEscaped.Validate())
+	okEscaped, errEscaped := resolver.Resolve(constraintEscaped, mapContext)
+	assert.Nil(t, errEscaped)
+	assert.True(t, okEscaped)
+
+	// Missing segment
+	constraintMissing := NewConstraint("device.model", OPERATOR_EQ, "iphone")
+	okMissing, errMissing := resolver.Resolve(constraintMissing, mapContext)
+	assert.NotNil(t, errMissing)
+	assert.Contains(t, errMissing.Error(), "missing segment 'model'")
+	assert.False(t, okMissing)
+
+	// Not traversable
+	constraintDeep := NewConstraint("device.os.name", OPERATOR_EQ, "ios")
+	okDeep, errDeep := resolver.Resolve(constraintDeep, mapContext)
+	assert.NotNil(t, errDeep)
+	assert.Contains(t, errDeep.Error(), "not traversable")
+	assert.True(t, errors.Is(errDeep, ErrTypeMismatch))
+	assert.False(t, okDeep)
+
+	// Not a missing key, so the missing key policy does not apply
+	constraintDeep.Missing = MISSING_PASS
+	okDeep, errDeep = resolver.Resolve(constraintDeep, mapContext)
+	assert.True(t, errors.Is(errDeep, ErrTypeMismatch))
+	assert.False(t, okDeep)
+
+	evaluator, err := Compile(constraintDeep)
+	assert.Nil(t, err)
+	okDeep, errDeep = evaluator.Evaluate(mapContext)
+	assert.True(t, errors.Is(errDeep, ErrTypeMismatch))
+	assert.False(t, okDeep)
+
+	// JSON pointers are reported as pointers
+	_, errPointer := resolver.Resolve(NewConstraint("/a~1b/~0c/d", OPERATOR_EQ, 4), mapContext)
+	assert.Contains(t, errPointer.Error(), "at '/a~1b/~0c'")
+}
+
+func TestPathTopLevelKeyWithDot(t *testing.T) {
+	context := make(map[string]interface{})
+	context["app.version"] = 4
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	// An exact match for the whole key wins over walking a path
+	ok, err := resolver.Resolve(NewConstraint("app.version", OPERATOR_EQ, 4), mapContext)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestPathStructsAndSlices(t *testing.T) {
+	context := make(map[string]interface{})
+	context["device"] = &testDevice{OS: "android", Version: 14, Tags: []string{"tablet", "beta"}, Model: "pixel"}
+	context["scores"] = []int{10, 20, 30}
+	context["nested"] = map[string][]map[string]int{"items": {{"id": 1}, {"id": 2}}}
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	tests := []struct {
+		constraint *Constraint
+		expected   bool
+	}{
+		{NewConstraint("device.os", OPERATOR_EQ, "android"), true},
+		{NewConstraint("device.version", OPERATOR_GTE, 14), true},
+		{NewConstraint("device.Model", OPERATOR_EQ, "pixel"), true},
+		{NewConstraint("device.tags.1", OPERATOR_EQ, "beta"), true},
+		{NewConstraint("/device/tags", OPERATOR_HAS_ANY, []string{"tablet"}), true},
+		{NewConstraint("scores.2", OPERATOR_GT, 25), true},
+		{NewConstraint("nested.items.1.id", OPERATOR_EQ, 2), true},
+	}
+
+	for _, test := range tests {
+		ok, err := resolver.Resolve(test.constraint, mapContext)
+		assert.Nil(t, err, test.constraint.Key)
+		assert.Equal(t, test.expected, ok, test.constraint.Key)
+	}
+
+	// Fields that can't be reached by a key, and indexes that do not exist
+	for _, key := range []string{"device.Secret", "device.hidden", "device.OS", "scores.3", "device.tags.-1", "scores.first"} {
+		ok, err := resolver.Resolve(NewConstraint(key, OPERATOR_EQ, "x"), mapContext)
+		assert.NotNil(t, err, key)
+		assert.False(t, ok, key)
+	}
+
+	// Indexes that are not numbers are type mismatches rather than missing keys
+	for _, key := range []string{"device.tags.-1", "scores.first"} {
+		constraint := NewConstraint(key, OPERATOR_EQ, "x")
+		constraint.Missing = MISSING_PASS
+
+		ok, err := resolver.Resolve(constraint, mapContext)
+		assert.True(t, errors.Is(err, ErrTypeMismatch), key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	assert.Nil(t, ValidateKey("country"))
+	assert.Nil(t, ValidateKey("device.os"))
+	assert.Nil(t, ValidateKey("/device/os"))
+	assert.Nil(t, ValidateKey("/a~0b~1c"))
+
+	// Not paths, looked up as a single name
+	assert.Nil(t, ValidateKey("device..os"))
+	assert.Nil(t, ValidateKey(".device"))
+	assert.Nil(t, ValidateKey("device."))
+
+	assert.NotNil(t, ValidateKey(""))
+	assert.NotNil(t, ValidateKey("/"))
+	assert.NotNil(t, ValidateKey("/device//os"))
+	assert.NotNil(t, ValidateKey("/device/~2"))
+	assert.NotNil(t, ValidateKey("/device/os~"))
+
+	assert.NotNil(t, NewConstraint("/device//os", OPERATOR_EQ, "ios").Validate())
+}
+
+func TestPathLiteralKeys(t *testing.T) {
+	context := make(map[string]interface{})
+	context["a..b"] = 1
+	context["version."] = "4.2"
+	context["a"] = map[string]interface{}{"b": 2}
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	tests := []*Constraint{
+		NewConstraint("a..b", OPERATOR_EQ, 1),
+		NewConstraint("version.", OPERATOR_EQ, "4.2"),
+	}
+
+	for _, constraint := range tests {
+		assert.Nil(t, constraint.Validate(), constraint.Key)
+
+		ok, err := resolver.Resolve(constraint, mapContext)
+		assert.Nil(t, err, constraint.Key)
+		assert.True(t, ok, constraint.Key)
+
+		evaluator, compileErr := Compile(constraint)
+		assert.Nil(t, compileErr, constraint.Key)
+
+		ok, err = evaluator.Evaluate(mapContext)
+		assert.Nil(t, err, constraint.Key)
+		assert.True(t, ok, constraint.Key)
+	}
+
+	// Never walked as a path
+	_, err := resolver.Resolve(NewConstraint(".a.b", OPERATOR_EQ, 2), mapContext)
+	assert.NotNil(t, err)
+}
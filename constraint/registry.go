@@ -0,0 +1,73 @@
+package constraint
+
+import (
+	"github.com/juju/errors"
+	"sync"
+)
+
+// ValidateFunc checks that a constraint Value is usable with a custom operator. It is called by Constraint.Validate.
+type ValidateFunc func(constraintValue interface{}) error
+
+// EvaluateFunc decides whether the value found in a Context satisfies the constraint Value.
+type EvaluateFunc func(contextValue interface{}, constraintValue interface{}) (bool, error)
+
+// customOperator is an operator registered by a caller along with the functions that implement it.
+type customOperator struct {
+	validate ValidateFunc
+	evaluate EvaluateFunc
+}
+
+var operatorRegistry = struct {
+	sync.RWMutex
+	operators map[OPERATOR]customOperator
+}{operators: make(map[OPERATOR]customOperator)}
+
+// RegisterOperator adds an operator to the default resolver. The validate function may be nil if any constraint
+// Value is acceptable. Names of built in operators and operators that are already registered can't be reused.
+func RegisterOperator(operator OPERATOR, validate ValidateFunc, evaluate EvaluateFunc) error {
+	if operator == "" {
+		return errors.New("operator name must be specified")
+	}
+
+	if evaluate == nil {
+		return errors.Errorf("operator %s needs an evaluate function", operator)
+	}
+
+	if builtinOperators[operator] {
+		return errors.Errorf("operator %s is built in and can't be registered", operator)
+	}
+
+	operatorRegistry.Lock()
+	defer operatorRegistry.Unlock()
+
+	if _, ok := operatorRegistry.operators[operator]; ok {
+		return errors.Errorf("operator %s is already registered", operator)
+	}
+
+	operatorRegistry.operators[operator] = customOperator{validate: validate, evaluate: evaluate}
+
+	return nil
+}
+
+// UnregisterOperator removes an operator added with RegisterOperator. Constraints using it will no longer validate.
+func UnregisterOperator(operator OPERATOR) error {
+	operatorRegistry.Lock()
+	defer operatorRegistry.Unlock()
+
+	if _, ok := operatorRegistry.operators[operator]; !ok {
+		return errors.Errorf("operator %s is not registered", operator)
+	}
+
+	delete(operatorRegistry.operators, operator)
+
+	return nil
+}
+
+func lookupOperator(operator OPERATOR) (customOperator, bool) {
+	operatorRegistry.RLock()
+	defer operatorRegistry.RUnlock()
+
+	custom, ok := operatorRegistry.operators[operator]
+
+	return custom, ok
+}
@@ -0,0 +1,140 @@
+package constraint
+
+import (
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+const (
+	operatorWithinKm = "WITHIN_KM"
+	operatorTierGTE  = "TIER_GTE"
+)
+
+var tierRanks = map[string]int{"free": 0, "plus": 1, "pro": 2, "enterprise": 3}
+
+func validateWithinKm(value interface{}) error {
+	store, ok := value.(map[string]interface{})
+
+	if !ok {
+		return errors.Errorf("expected a store location and distance")
+	}
+
+	for _, key := range []string{"lat", "lon", "km"} {
+		if _, ok := store[key].(float64); !ok {
+			return errors.Errorf("expected %s to be a number", key)
+		}
+	}
+
+	return nil
+}
+
+func evaluateWithinKm(contextValue interface{}, constraintValue interface{}) (bool, error) {
+	location, ok := contextValue.([]float64)
+
+	if !ok || len(location) != 2 {
+		return false, errors.Errorf("expected a latitude and longitude in context")
+	}
+
+	store := constraintValue.(map[string]interface{})
+
+	// An equirectangular approximation is plenty for short distances
+	x := (location[1] - store["lon"].(float64)) * math.Cos((location[0]+store["lat"].(float64))/2*math.Pi/180)
+	y := location[0] - store["lat"].(float64)
+	distance := math.Sqrt(x*x+y*y) * math.Pi / 180 * 6371
+
+	return distance <= store["km"].(float64), nil
+}
+
+func validateTier(value interface{}) error {
+	tier, ok := value.(string)
+
+	if _, known := tierRanks[tier]; !ok || !known {
+		return errors.Errorf("unknown tier %+v", value)
+	}
+
+	return nil
+}
+
+func evaluateTier(contextValue interface{}, constraintValue interface{}) (bool, error) {
+	tier, ok := contextValue.(string)
+
+	if _, known := tierRanks[tier]; !ok || !known {
+		return false, errors.Errorf("unknown tier %+v", contextValue)
+	}
+
+	return tierRanks[tier] >= tierRanks[constraintValue.(string)], nil
+}
+
+func TestRegisterOperator(t *testing.T) {
+	assert.Nil(t, RegisterOperator(operatorWithinKm, validateWithinKm, evaluateWithinKm))
+	defer UnregisterOperator(operatorWithinKm)
+
+	assert.Nil(t, RegisterOperator(operatorTierGTE, validateTier, evaluateTier))
+	defer UnregisterOperator(operatorTierGTE)
+
+	assert.Nil(t, ValidateOperator(operatorWithinKm))
+
+	context := make(map[string]interface{})
+	context["location"] = []float64{40.7128, -74.0060}
+	context["tier"] = "pro"
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	// Within 5km of a store in Manhattan
+	constraintNear := NewConstraint("location", operatorWithinKm, map[string]interface{}{"lat": 40.7306, "lon": -73.9866, "km": 5.0})
+	assert.Nil(t, constraintNear.Validate())
+	okNear, errNear := resolver.Resolve(constraintNear, mapContext)
+	assert.Nil(t, errNear)
+	assert.True(t, okNear)
+
+	// Not within 5km of a store in Boston
+	constraintFar := NewConstraint("location", operatorWithinKm, map[string]interface{}{"lat": 42.3601, "lon": -71.0589, "km": 5.0})
+	okFar, errFar := resolver.Resolve(constraintFar, mapContext)
+	assert.Nil(t, errFar)
+	assert.False(t, okFar)
+
+	// Tier rank
+	constraintTier := NewConstraint("tier", operatorTierGTE, "plus")
+	assert.Nil(t, constraintTier.Validate())
+	okTier, errTier := resolver.Resolve(constraintTier, mapContext)
+	assert.Nil(t, errTier)
+	assert.True(t, okTier)
+
+	// The validate function is used by Constraint.Validate
+	assert.NotNil(t, NewConstraint("tier", operatorTierGTE, "gold").Validate())
+	assert.NotNil(t, NewConstraint("location", operatorWithinKm, 5).Validate())
+
+	// Errors from the evaluate function are returned
+	context["tier"] = 2
+	okBad, errBad := resolver.Resolve(constraintTier, mapContext)
+	assert.NotNil(t, errBad)
+	assert.False(t, okBad)
+}
+
+func TestRegisterOperatorCollisions(t *testing.T) {
+	// Built in operators can't be replaced
+	assert.NotNil(t, RegisterOperator(OPERATOR_EQ, nil, evaluateTier))
+	assert.NotNil(t, RegisterOperator(OPERATOR_HAS_ANY, nil, evaluateTier))
+
+	// An evaluate function and a name are required
+	assert.NotNil(t, RegisterOperator("NO_EVALUATE", nil, nil))
+	assert.NotNil(t, RegisterOperator("", nil, evaluateTier))
+
+	// Registering twice fails until the first is removed
+	assert.Nil(t, RegisterOperator(operatorTierGTE, nil, evaluateTier))
+	assert.NotNil(t, RegisterOperator(operatorTierGTE, validateTier, evaluateTier))
+	assert.Nil(t, UnregisterOperator(operatorTierGTE))
+	assert.NotNil(t, UnregisterOperator(operatorTierGTE))
+
+	// Unregistered operators are invalid again
+	assert.NotNil(t, ValidateOperator(operatorTierGTE))
+	assert.NotNil(t, NewConstraint("tier", operatorTierGTE, "plus").Validate())
+
+	resolver := resolver{}
+	ok, err := resolver.Resolve(NewConstraint("tier", operatorTierGTE, "plus"), NewMapContext(map[string]interface{}{"tier": "pro"}))
+	assert.NotNil(t, err)
+	assert.False(t, ok)
+}
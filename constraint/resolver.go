@@ -1,32 +1,76 @@
 package constraint
 
-import "github.com/juju/errors"
+import (
+	"github.com/juju/errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
 
 // Resolver is an interface that defines methods needed to resolve whether constraints are satisfied by some Context.
 type Resolver interface {
 	Resolve(constraint *Constraint, context Context) (bool, error)
 }
 
-// NewDefaultResolver returns a basic implementation of a Resolver
+// NewDefaultResolver returns a basic implementation of a Resolver. A constraint whose Key is not in the Context
+// resolves to an error unless the constraint has a Missing policy of its own.
 func NewDefaultResolver() Resolver {
 	return &resolver{}
 }
 
+// NewResolverWithPolicy returns a Resolver that applies the missing key policy to constraints that don't set one.
+func NewResolverWithPolicy(missing MISSING) Resolver {
+	return &resolver{missing: missing}
+}
+
 // resolver is a default implementation of Resolver
 type resolver struct {
+	missing MISSING
+	cidrs   sync.Map // Parsed prefixes of the CIDR constraints resolved so far, see cidrSetOf
 }
 
-// Resolve returns true is the Constraint is satisfied via the provided Context for a given Key.
+// Resolve returns true is the Constraint is satisfied via the provided Context for a given Key. Errors can be
+// tested with errors.Is against ErrNoContext, ErrKeyNotFound, ErrTypeMismatch, ErrInvalidOperator and
+// ErrInvalidValue.
 func (r *resolver) Resolve(constraint *Constraint, context Context) (bool, error) {
+	ok, err := r.resolve(constraint, context)
+
+	if err != nil {
+		return false, withConstraint(err, constraint)
+	}
+
+	return ok, nil
+}
+
+func (r *resolver) resolve(constraint *Constraint, context Context) (bool, error) {
 	if context == nil {
-		return false, errors.Errorf("no context provided")
+		return false, newError(ErrNoContext, errors.Errorf("no context provided"))
 	}
 
 	// Attempt to retrieve the Value at the Key
 	value, contextErr := context.value(constraint.Key)
 
 	if contextErr != nil {
-		return false, errors.Annotatef(contextErr, "Key not found in context: %s", constraint.Key)
+		return missingResult(constraint, r.missing, contextErr)
+	}
+
+	// Registered operators are evaluated by the functions they were registered with
+	if !builtinOperators[constraint.Operator] {
+		if custom, ok := lookupOperator(constraint.Operator); ok {
+			return custom.evaluate(value, constraint.Value)
+		}
+	}
+
+	// Network operators compare addresses rather than plain values
+	if constraint.Operator == OPERATOR_IN_CIDR || constraint.Operator == OPERATOR_NOT_IN_CIDR {
+		return r.resolveCIDR(constraint, value)
+	}
+
+	// Intersection operators compare a list of values in the context
+	if isIntersectionOperator(constraint.Operator) {
+		return r.resolveIntersection(constraint, value)
 	}
 
 	// Inspect the type of the Value and resolve the constraint appropriately.
@@ -45,37 +89,112 @@ func (r *resolver) Resolve(constraint *Constraint, context Context) (bool, error
 		return r.resolveInt64(constraint, int64(valueType))
 	case int64:
 		return r.resolveInt64(constraint, int64(valueType))
+	case uint:
+		return r.resolveUint64(constraint, uint64(valueType))
+	case uint8:
+		return r.resolveUint64(constraint, uint64(valueType))
+	case uint16:
+		return r.resolveUint64(constraint, uint64(valueType))
+	case uint32:
+		return r.resolveUint64(constraint, uint64(valueType))
+	case uint64:
+		return r.resolveUint64(constraint, uint64(valueType))
 	case string:
 		return r.resolveString(constraint, string(valueType))
+	case bool:
+		return r.resolveBool(constraint, bool(valueType))
 	default:
-		return false, errors.New("unknown type found")
+		return false, newError(ErrTypeMismatch, errors.New("unknown type found"))
 	}
-
-	return true, nil
 }
 
 func (r *resolver) resolveFloat64(constraint *Constraint, value float64) (bool, error) {
+	// Compare against a list of numbers for set and range operators
+	if isListOperator(constraint.Operator) {
+		floatValues, forceError := r.forceFloat64s(constraint.Value)
+
+		if forceError != nil {
+			return false, newError(ErrTypeMismatch, errors.Annotatef(forceError, "could not compare %f with %+v", value, constraint.Value))
+		}
+
+		return r.arrayCompareFloat64(constraint.Operator, value, floatValues)
+	}
+
 	// Attempt to force the constraint's Value to a float64 for comparison
 	floatValue, forceError := r.forceFloat64(constraint.Value)
 
 	if forceError != nil {
-		return false, errors.Annotatef(forceError, "could not compare %f with %+v", value, constraint.Value)
+		return false, newError(ErrTypeMismatch, errors.Annotatef(forceError, "could not compare %f with %+v", value, constraint.Value))
 	}
 
 	return r.compareFloat64(constraint.Operator, value, floatValue)
 }
 
 func (r *resolver) resolveInt64(constraint *Constraint, value int64) (bool, error) {
+	// Compare against a list of numbers for set and range operators
+	if isListOperator(constraint.Operator) {
+		// Bounds and members that are not whole numbers would be truncated as ints, so compare as floats
+		if floatValues, err := r.forceFloat64s(constraint.Value); err == nil && !wholeNumbers(floatValues) {
+			return r.arrayCompareFloat64(constraint.Operator, float64(value), floatValues)
+		}
+
+		intValues, forceError := r.forceInt64s(constraint.Value)
+
+		if forceError != nil {
+			return false, newError(ErrTypeMismatch, errors.Annotatef(forceError, "could not compare %d with %+v", value, constraint.Value))
+		}
+
+		return r.arrayCompareInt64(constraint.Operator, value, intValues)
+	}
+
+	// A value with a fraction would be truncated as an int, so compare as floats
+	if floatValue, err := r.forceFloat64(constraint.Value); err == nil && floatValue != math.Trunc(floatValue) {
+		return r.compareFloat64(constraint.Operator, float64(value), floatValue)
+	}
+
 	// Attempt to force the constraint's Value to a int64 for comparison
 	intValue, forceError := r.forceInt64(constraint.Value)
 
 	if forceError != nil {
-		return false, errors.Annotatef(forceError, "could not compare %f with %+v", value, constraint.Value)
+		return false, newError(ErrTypeMismatch, errors.Annotatef(forceError, "could not compare %d with %+v", value, constraint.Value))
 	}
 
 	return r.compareInt64(constraint.Operator, value, intValue)
 }
 
+func (r *resolver) resolveUint64(constraint *Constraint, value uint64) (bool, error) {
+	// Values that do not fit in an int64 can only be compared as floats
+	if value > math.MaxInt64 {
+		return r.resolveFloat64(constraint, float64(value))
+	}
+
+	return r.resolveInt64(constraint, int64(value))
+}
+
+func (r *resolver) resolveBool(constraint *Constraint, value bool) (bool, error) {
+	switch constraint.Operator {
+	case OPERATOR_IS_TRUE:
+		return value, nil
+	case OPERATOR_IS_FALSE:
+		return !value, nil
+	}
+
+	boolValue, boolOk := constraint.Value.(bool)
+
+	if !boolOk {
+		return false, newError(ErrTypeMismatch, errors.Errorf("could not compare %t with %+v", value, constraint.Value))
+	}
+
+	switch constraint.Operator {
+	case OPERATOR_EQ:
+		return value == boolValue, nil
+	case OPERATOR_NOT_EQ:
+		return value != boolValue, nil
+	default:
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for bool comparison: %s", constraint.Operator))
+	}
+}
+
 func (r *resolver) resolveString(constraint *Constraint, value string) (bool, error) {
 	// Attempt direct string comparison first
 	stringValue, stringOk := constraint.Value.(string)
@@ -86,36 +205,102 @@ func (r *resolver) resolveString(constraint *Constraint, value string) (bool, er
 			return value == stringValue, nil
 		case OPERATOR_NOT_EQ:
 			return value != stringValue, nil
+		case OPERATOR_LT:
+			return value < stringValue, nil
+		case OPERATOR_LTE:
+			return value <= stringValue, nil
+		case OPERATOR_GT:
+			return value > stringValue, nil
+		case OPERATOR_GTE:
+			return value >= stringValue, nil
+		case OPERATOR_VERSION_LT:
+			return compareVersions(value, stringValue) < 0, nil
+		case OPERATOR_VERSION_LTE:
+			return compareVersions(value, stringValue) <= 0, nil
+		case OPERATOR_VERSION_GT:
+			return compareVersions(value, stringValue) > 0, nil
+		case OPERATOR_VERSION_GTE:
+			return compareVersions(value, stringValue) >= 0, nil
 		default:
-			return false, errors.Errorf("could not compare strings with Operator: %d", constraint.Operator)
+			return false, newError(ErrInvalidOperator, errors.Errorf("could not compare strings with Operator: %s", constraint.Operator))
 		}
 	}
 
 	// Attempt set comparison (contains, not contains)
-	strings, stringsOk := constraint.Value.([]string)
-	if stringsOk {
-		return r.arrayCompareString(constraint.Operator, value, strings)
+	stringValues, stringsErr := forceStrings(constraint.Value)
+	if stringsErr == nil {
+		return r.arrayCompareString(constraint.Operator, value, stringValues)
 	}
 
-	// Having trouble parsing an array of strings from a JSON file
-	moreStrings, moreStringsOk := constraint.Value.([]interface{})
-	if moreStringsOk {
-		strings := make([]string, 0, len(moreStrings))
+	return false, newError(ErrTypeMismatch, errors.Errorf("could not compare input %s with constraint %+v", value, constraint.Value))
+}
 
-		for _, interfaceObject := range moreStrings {
-			s, sOk := interfaceObject.(string)
+func (r *resolver) resolveCIDR(constraint *Constraint, value interface{}) (bool, error) {
+	set, setErr := r.cidrSetOf(constraint)
 
-			if !sOk {
-				return false, errors.Errorf("expected to parse an array of strings, found %+v", interfaceObject)
-			}
+	if setErr != nil {
+		return false, newError(ErrInvalidValue, setErr)
+	}
 
-			strings = append(strings, s)
-		}
+	return r.resolveCIDRSet(constraint, set, value)
+}
 
-		return r.arrayCompareString(constraint.Operator, value, strings)
+// resolveCIDRSet is resolveCIDR with the prefixes of the constraint already parsed, see Compile.
+func (r *resolver) resolveCIDRSet(constraint *Constraint, set *cidrSet, value interface{}) (bool, error) {
+	ip, ipErr := forceIP(value)
+
+	if ipErr != nil {
+		return false, newError(ErrTypeMismatch, errors.Annotatef(ipErr, "could not compare %+v with %+v", value, constraint.Value))
 	}
 
-	return false, errors.Errorf("could not compare input %s with constraint %+v", value, constraint.Value)
+	found := set.contains(ip)
+
+	switch constraint.Operator {
+	case OPERATOR_IN_CIDR:
+		return found, nil
+	case OPERATOR_NOT_IN_CIDR:
+		return !found, nil
+	default:
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for CIDR comparison: %s", constraint.Operator))
+	}
+}
+
+func (r *resolver) resolveIntersection(constraint *Constraint, value interface{}) (bool, error) {
+	values, valuesErr := r.forceKeys(value)
+
+	if valuesErr != nil {
+		return false, newError(ErrTypeMismatch, errors.Annotatef(valuesErr, "expected a list of strings or numbers in context: %s", constraint.Key))
+	}
+
+	keys, keysErr := r.forceKeys(constraint.Value)
+
+	if keysErr != nil {
+		return false, newError(ErrInvalidValue, errors.Annotatef(keysErr, "could not compare %+v with %+v", value, constraint.Value))
+	}
+
+	// Collect what the context holds, then count how many of the constraint's values are present
+	present := make(map[interface{}]bool, len(values))
+	for _, v := range values {
+		present[v] = true
+	}
+
+	found := 0
+	for _, key := range keys {
+		if present[key] {
+			found++
+		}
+	}
+
+	switch constraint.Operator {
+	case OPERATOR_HAS_ANY:
+		return found > 0, nil
+	case OPERATOR_HAS_ALL:
+		return found == len(keys), nil
+	case OPERATOR_HAS_NONE:
+		return found == 0, nil
+	default:
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for list comparison: %s", constraint.Operator))
+	}
 }
 
 func (r *resolver) compareFloat64(operator OPERATOR, left float64, right float64) (bool, error) {
@@ -133,7 +318,7 @@ func (r *resolver) compareFloat64(operator OPERATOR, left float64, right float64
 	case OPERATOR_GTE:
 		return left >= right, nil
 	default:
-		return false, errors.Errorf("Operator not available for float comparison: %d", operator)
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for float comparison: %s", operator))
 	}
 }
 
@@ -152,7 +337,7 @@ func (r *resolver) compareInt64(operator OPERATOR, left int64, right int64) (boo
 	case OPERATOR_GTE:
 		return left >= right, nil
 	default:
-		return false, errors.Errorf("Operator not available for int comparison: %d", operator)
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for int comparison: %s", operator))
 	}
 }
 
@@ -167,12 +352,78 @@ func (r *resolver) arrayCompareString(operator OPERATOR, value string, values []
 	}
 
 	switch operator {
-	case OPERATOR_CONTAINS:
+	case OPERATOR_CONTAINS, OPERATOR_IN:
 		return found, nil
-	case OPERATOR_NOT_CONTAINS:
+	case OPERATOR_NOT_CONTAINS, OPERATOR_NOT_IN:
 		return !found, nil
 	default:
-		return false, errors.Errorf("Operator not available for comparison: %d", operator)
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for comparison: %s", operator))
+	}
+}
+
+func (r *resolver) arrayCompareFloat64(operator OPERATOR, value float64, values []float64) (bool, error) {
+	switch operator {
+	case OPERATOR_BETWEEN, OPERATOR_BETWEEN_EXCLUSIVE:
+		if len(values) != 2 {
+			return false, newError(ErrInvalidValue, errors.Errorf("expected lower and upper bounds, found %+v", values))
+		}
+
+		if operator == OPERATOR_BETWEEN {
+			return values[0] <= value && value <= values[1], nil
+		}
+
+		return values[0] < value && value < values[1], nil
+	}
+
+	// Try to find the Value in the array of floats
+	found := false
+	for _, v := range values {
+		if v == value {
+			found = true
+			break
+		}
+	}
+
+	switch operator {
+	case OPERATOR_CONTAINS, OPERATOR_IN:
+		return found, nil
+	case OPERATOR_NOT_CONTAINS, OPERATOR_NOT_IN:
+		return !found, nil
+	default:
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for comparison: %s", operator))
+	}
+}
+
+func (r *resolver) arrayCompareInt64(operator OPERATOR, value int64, values []int64) (bool, error) {
+	switch operator {
+	case OPERATOR_BETWEEN, OPERATOR_BETWEEN_EXCLUSIVE:
+		if len(values) != 2 {
+			return false, newError(ErrInvalidValue, errors.Errorf("expected lower and upper bounds, found %+v", values))
+		}
+
+		if operator == OPERATOR_BETWEEN {
+			return values[0] <= value && value <= values[1], nil
+		}
+
+		return values[0] < value && value < values[1], nil
+	}
+
+	// Try to find the Value in the array of ints
+	found := false
+	for _, v := range values {
+		if v == value {
+			found = true
+			break
+		}
+	}
+
+	switch operator {
+	case OPERATOR_CONTAINS, OPERATOR_IN:
+		return found, nil
+	case OPERATOR_NOT_CONTAINS, OPERATOR_NOT_IN:
+		return !found, nil
+	default:
+		return false, newError(ErrInvalidOperator, errors.Errorf("Operator not available for comparison: %s", operator))
 	}
 }
 
@@ -192,6 +443,16 @@ func (r *resolver) forceFloat64(value interface{}) (float64, error) {
 		return float64(v), nil
 	case int64:
 		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
 	default:
 		return 0, errors.Errorf("could not force %+v to float64", value)
 	}
@@ -213,7 +474,162 @@ func (r *resolver) forceInt64(value interface{}) (int64, error) {
 		return int64(v), nil
 	case int64:
 		return v, nil
+	case uint:
+		return r.forceInt64(uint64(v))
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, errors.Errorf("could not force %d to int64 without overflow", v)
+		}
+		return int64(v), nil
 	default:
-		return 0, errors.Errorf("could not force %+v to float64", value)
+		return 0, errors.Errorf("could not force %+v to int64", value)
+	}
+}
+
+// forceFloat64s converts any slice of numbers, including a []interface{} decoded from JSON, to a []float64.
+func (r *resolver) forceFloat64s(value interface{}) ([]float64, error) {
+	list := reflect.ValueOf(value)
+
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, errors.Errorf("could not force %+v to []float64", value)
+	}
+
+	floats := make([]float64, list.Len())
+
+	for i := range floats {
+		f, err := r.forceFloat64(list.Index(i).Interface())
+
+		if err != nil {
+			return nil, err
+		}
+
+		floats[i] = f
+	}
+
+	return floats, nil
+}
+
+// forceInt64s converts any slice of numbers, including a []interface{} decoded from JSON, to a []int64.
+func (r *resolver) forceInt64s(value interface{}) ([]int64, error) {
+	list := reflect.ValueOf(value)
+
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, errors.Errorf("could not force %+v to []int64", value)
+	}
+
+	ints := make([]int64, list.Len())
+
+	for i := range ints {
+		n, err := r.forceInt64(list.Index(i).Interface())
+
+		if err != nil {
+			return nil, err
+		}
+
+		ints[i] = n
+	}
+
+	return ints, nil
+}
+
+// wholeNumbers reports whether every number fits in an int64 without losing anything.
+func wholeNumbers(values []float64) bool {
+	for _, f := range values {
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compareVersions orders strings so that versions compare naturally: strings are split on '.' and segments that
+// are both numbers are compared numerically, so "4.12" > "4.9". Other segments, and numbers that are only written
+// differently such as "01" and "1", are compared as plain strings.
+func compareVersions(left string, right string) int {
+	leftSegments := strings.Split(left, ".")
+	rightSegments := strings.Split(right, ".")
+
+	for i := 0; i < len(leftSegments) && i < len(rightSegments); i++ {
+		l, r := leftSegments[i], rightSegments[i]
+
+		if l == r {
+			continue
+		}
+
+		lNumber, lErr := strconv.ParseUint(l, 10, 64)
+		rNumber, rErr := strconv.ParseUint(r, 10, 64)
+
+		if lErr == nil && rErr == nil && lNumber != rNumber {
+			if lNumber < rNumber {
+				return -1
+			}
+			return 1
+		}
+
+		return strings.Compare(l, r)
+	}
+
+	return len(leftSegments) - len(rightSegments)
+}
+
+// forceKeys converts a list of strings or numbers to comparable map keys. Strings are kept as they are and numbers
+// of any type become float64 so that, for example, an int from Go code matches a float64 decoded from JSON.
+func (r *resolver) forceKeys(value interface{}) ([]interface{}, error) {
+	list := reflect.ValueOf(value)
+
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, errors.Errorf("could not force %+v to a list", value)
+	}
+
+	keys := make([]interface{}, list.Len())
+
+	for i := range keys {
+		element := list.Index(i).Interface()
+
+		if s, ok := element.(string); ok {
+			keys[i] = s
+			continue
+		}
+
+		f, err := r.forceFloat64(element)
+
+		if err != nil {
+			return nil, errors.Errorf("expected a string or number in list, found %+v", element)
+		}
+
+		keys[i] = f
+	}
+
+	return keys, nil
+}
+
+// forceStrings converts a list of strings, either a []string or a []interface{} decoded from JSON, to a []string.
+func forceStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		stringValues := make([]string, 0, len(v))
+
+		for _, interfaceObject := range v {
+			s, sOk := interfaceObject.(string)
+
+			if !sOk {
+				return nil, errors.Errorf("expected to parse an array of strings, found %+v", interfaceObject)
+			}
+
+			stringValues = append(stringValues, s)
+		}
+
+		return stringValues, nil
+	default:
+		return nil, errors.Errorf("could not force %+v to []string", value)
 	}
 }
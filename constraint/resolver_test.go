@@ -1,7 +1,9 @@
 package constraint
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"math"
 	"testing"
 )
 
@@ -47,6 +49,36 @@ func TestOperatorsInt64(t *testing.T) {
 	testOperators(t, NewMapContext(context))
 }
 
+func TestOperatorsUint(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint(3)
+	testOperators(t, NewMapContext(context))
+}
+
+func TestOperatorsUint8(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint8(3)
+	testOperators(t, NewMapContext(context))
+}
+
+func TestOperatorsUint16(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint16(3)
+	testOperators(t, NewMapContext(context))
+}
+
+func TestOperatorsUint32(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint32(3)
+	testOperators(t, NewMapContext(context))
+}
+
+func TestOperatorsUint64(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint64(3)
+	testOperators(t, NewMapContext(context))
+}
+
 func TestTypesFloat64(t *testing.T) {
 	context := make(map[string]interface{})
 	context["Key"] = float64(3.0)
@@ -89,6 +121,125 @@ func TestTypesInt64(t *testing.T) {
 	testTypes(t, NewMapContext(context), 3)
 }
 
+func TestTypesUint(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint(3)
+	testTypes(t, NewMapContext(context), 3)
+}
+
+func TestTypesUint8(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint8(3)
+	testTypes(t, NewMapContext(context), 3)
+}
+
+func TestTypesUint16(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint16(3)
+	testTypes(t, NewMapContext(context), 3)
+}
+
+func TestTypesUint32(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint32(3)
+	testTypes(t, NewMapContext(context), 3)
+}
+
+func TestTypesUint64(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint64(3)
+	testTypes(t, NewMapContext(context), 3)
+}
+
+func TestOperatorsUint64Large(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = uint64(math.MaxUint64)
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	// Values beyond the range of an int64 are compared as floats
+	constraintGT := NewConstraint("Key", OPERATOR_GT, int64(math.MaxInt64))
+	okGT, errGT := resolver.Resolve(constraintGT, mapContext)
+	assert.Nil(t, errGT)
+	assert.True(t, okGT)
+
+	constraintLT := NewConstraint("Key", OPERATOR_LT, 3)
+	okLT, errLT := resolver.Resolve(constraintLT, mapContext)
+	assert.Nil(t, errLT)
+	assert.False(t, okLT)
+
+	// A large unsigned constraint value can not be compared with an int
+	context["Key"] = 3
+	constraintBad := NewConstraint("Key", OPERATOR_LT, uint64(math.MaxUint64))
+	okBad, errBad := resolver.Resolve(constraintBad, mapContext)
+	assert.NotNil(t, errBad)
+	assert.False(t, okBad)
+}
+
+func TestOperatorsBool(t *testing.T) {
+	context := make(map[string]interface{})
+	context["is_premium"] = true
+	context["is_employee"] = false
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	// EQ
+	constraintEQ := NewConstraint("is_premium", OPERATOR_EQ, true)
+	okEQ, errEQ := resolver.Resolve(constraintEQ, mapContext)
+	assert.Nil(t, errEQ)
+	assert.True(t, okEQ)
+
+	// NOT EQ
+	constraintNEQ := NewConstraint("is_employee", OPERATOR_NOT_EQ, false)
+	okNEQ, errNEQ := resolver.Resolve(constraintNEQ, mapContext)
+	assert.Nil(t, errNEQ)
+	assert.False(t, okNEQ)
+
+	// IS TRUE
+	constraintTrue := NewConstraint("is_premium", OPERATOR_IS_TRUE, nil)
+	assert.Nil(t, constraintTrue.Validate())
+	okTrue, errTrue := resolver.Resolve(constraintTrue, mapContext)
+	assert.Nil(t, errTrue)
+	assert.True(t, okTrue)
+
+	// IS FALSE
+	constraintFalse := NewConstraint("is_employee", OPERATOR_IS_FALSE, nil)
+	assert.Nil(t, constraintFalse.Validate())
+	okFalse, errFalse := resolver.Resolve(constraintFalse, mapContext)
+	assert.Nil(t, errFalse)
+	assert.True(t, okFalse)
+
+	// IS FALSE on a true value
+	constraintFalse2 := NewConstraint("is_premium", OPERATOR_IS_FALSE, nil)
+	okFalse2, errFalse2 := resolver.Resolve(constraintFalse2, mapContext)
+	assert.Nil(t, errFalse2)
+	assert.False(t, okFalse2)
+
+	// WRONG CONSTRAINT TYPE
+	constraintBad := NewConstraint("is_premium", OPERATOR_EQ, "true")
+	okBad, errBad := resolver.Resolve(constraintBad, mapContext)
+	assert.NotNil(t, errBad)
+	assert.False(t, okBad)
+
+	// WRONG OPERATOR
+	constraintGT := NewConstraint("is_premium", OPERATOR_GT, false)
+	okGT, errGT := resolver.Resolve(constraintGT, mapContext)
+	assert.NotNil(t, errGT)
+	assert.False(t, okGT)
+
+	// IS TRUE on a non bool value
+	context["number"] = 1
+	constraintNumber := NewConstraint("number", OPERATOR_IS_TRUE, nil)
+	okNumber, errNumber := resolver.Resolve(constraintNumber, mapContext)
+	assert.NotNil(t, errNumber)
+	assert.False(t, okNumber)
+
+	// A value is still required for other operators
+	assert.NotNil(t, NewConstraint("is_premium", OPERATOR_EQ, nil).Validate())
+}
+
 func TestOperatorsStrings(t *testing.T) {
 	context := make(map[string]interface{})
 	context["Key"] = "cucumbers"
@@ -120,6 +271,12 @@ func TestOperatorsStrings(t *testing.T) {
 	assert.Nil(t, errNotContains)
 	assert.True(t, okNotContains)
 
+	// IN
+	constraintIn := NewConstraint("Key", OPERATOR_IN, []interface{}{"apples", "cucumbers"})
+	okIn, errIn := resolver.Resolve(constraintIn, mapContext)
+	assert.Nil(t, errIn)
+	assert.True(t, okIn)
+
 	// NOT CONTAINS ERROR
 	constraintNotContains2 := NewConstraint("Key", OPERATOR_NOT_CONTAINS, []int{1, 2, 3, 4})
 	okNotContains2, errNotContains2 := resolver.Resolve(constraintNotContains2, mapContext)
@@ -127,6 +284,178 @@ func TestOperatorsStrings(t *testing.T) {
 	assert.False(t, okNotContains2)
 }
 
+func TestOperatorsStringsOrdering(t *testing.T) {
+	resolver := resolver{}
+
+	// Each pair is in ascending order, strings are ordered lexically unless compared as versions
+	tests := []struct {
+		lt, gte, gt OPERATOR
+		pairs       [][2]string
+	}{
+		{OPERATOR_LT, OPERATOR_GTE, OPERATOR_GT, [][2]string{
+			{"apple", "banana"},
+			{"B", "a"},
+			{"", "a"},
+			{"4.12", "4.9"},
+			{"10.0", "9.0"},
+		}},
+		{OPERATOR_VERSION_LT, OPERATOR_VERSION_GTE, OPERATOR_VERSION_GT, [][2]string{
+			{"4.9", "4.12"},
+			{"4.12", "4.12.1"},
+			{"9.0", "10.0"},
+			{"9", "10"},
+			{"apple", "banana"},
+			// Segments that are not both numbers are ordered lexically
+			{"4.12a", "4.9"},
+			{"4.beta", "4.rc"},
+			{"1.01", "1.1"},
+		}},
+	}
+
+	for _, test := range tests {
+		for _, pair := range test.pairs {
+			context := NewMapContext(map[string]interface{}{"Key": pair[0]})
+
+			ok, err := resolver.Resolve(NewConstraint("Key", test.lt, pair[1]), context)
+			assert.Nil(t, err)
+			assert.True(t, ok, "%s %s %s", pair[0], test.lt, pair[1])
+
+			ok, err = resolver.Resolve(NewConstraint("Key", test.gte, pair[1]), context)
+			assert.Nil(t, err)
+			assert.False(t, ok, "%s %s %s", pair[0], test.gte, pair[1])
+
+			context = NewMapContext(map[string]interface{}{"Key": pair[1]})
+
+			ok, err = resolver.Resolve(NewConstraint("Key", test.gt, pair[0]), context)
+			assert.Nil(t, err)
+			assert.True(t, ok, "%s %s %s", pair[1], test.gt, pair[0])
+		}
+	}
+
+	// Versions are strings
+	assert.NotNil(t, NewConstraint("Key", OPERATOR_VERSION_GTE, 4.12).Validate())
+	_, err := resolver.Resolve(NewConstraint("Key", OPERATOR_VERSION_GTE, "4.12"), NewMapContext(map[string]interface{}{"Key": 5}))
+	assert.NotNil(t, err)
+}
+
+func TestValidateListValues(t *testing.T) {
+	assert.Nil(t, NewConstraint("Key", OPERATOR_IN, []int{12, 55, 910}).Validate())
+	assert.Nil(t, NewConstraint("Key", OPERATOR_IN, []interface{}{"a", "b"}).Validate())
+	assert.Nil(t, NewConstraint("Key", OPERATOR_BETWEEN, []interface{}{float64(1), float64(2)}).Validate())
+	assert.Nil(t, NewConstraint("Key", OPERATOR_BETWEEN_EXCLUSIVE, []float64{1.5, 1.5}).Validate())
+
+	assert.NotNil(t, NewConstraint("Key", OPERATOR_IN, 12).Validate())
+	assert.NotNil(t, NewConstraint("Key", OPERATOR_NOT_IN, []interface{}{"a", 1}).Validate())
+	assert.NotNil(t, NewConstraint("Key", OPERATOR_BETWEEN, []int{1, 2, 3}).Validate())
+	assert.NotNil(t, NewConstraint("Key", OPERATOR_BETWEEN, []int{3, 2}).Validate())
+	assert.NotNil(t, NewConstraint("Key", OPERATOR_BETWEEN, []string{"a", "b"}).Validate())
+}
+
+func TestIntersectionStrings(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = []string{"beta", "search", "checkout"}
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	// HAS ANY
+	constraintAny := NewConstraint("Key", OPERATOR_HAS_ANY, []string{"search", "maps"})
+	okAny, errAny := resolver.Resolve(constraintAny, mapContext)
+	assert.Nil(t, errAny)
+	assert.True(t, okAny)
+
+	// HAS ALL
+	constraintAll := NewConstraint("Key", OPERATOR_HAS_ALL, []interface{}{"search", "beta"})
+	okAll, errAll := resolver.Resolve(constraintAll, mapContext)
+	assert.Nil(t, errAll)
+	assert.True(t, okAll)
+
+	// HAS ALL MISSING ONE
+	constraintAll2 := NewConstraint("Key", OPERATOR_HAS_ALL, []string{"search", "maps"})
+	okAll2, errAll2 := resolver.Resolve(constraintAll2, mapContext)
+	assert.Nil(t, errAll2)
+	assert.False(t, okAll2)
+
+	// HAS NONE
+	constraintNone := NewConstraint("Key", OPERATOR_HAS_NONE, []string{"maps", "music"})
+	okNone, errNone := resolver.Resolve(constraintNone, mapContext)
+	assert.Nil(t, errNone)
+	assert.True(t, okNone)
+
+	// HAS NONE WITH A MATCH
+	constraintNone2 := NewConstraint("Key", OPERATOR_HAS_NONE, []string{"maps", "checkout"})
+	okNone2, errNone2 := resolver.Resolve(constraintNone2, mapContext)
+	assert.Nil(t, errNone2)
+	assert.False(t, okNone2)
+
+	// NOT A LIST
+	constraintBad := NewConstraint("Key", OPERATOR_HAS_ANY, "search")
+	okBad, errBad := resolver.Resolve(constraintBad, mapContext)
+	assert.NotNil(t, errBad)
+	assert.False(t, okBad)
+}
+
+func TestIntersectionNumbers(t *testing.T) {
+	context := make(map[string]interface{})
+	context["Key"] = []int{4, 8, 15}
+	mapContext := NewMapContext(context)
+
+	resolver := resolver{}
+
+	constraintAny := NewConstraint("Key", OPERATOR_HAS_ANY, []float64{15, 16})
+	okAny, errAny := resolver.Resolve(constraintAny, mapContext)
+	assert.Nil(t, errAny)
+	assert.True(t, okAny)
+
+	constraintAll := NewConstraint("Key", OPERATOR_HAS_ALL, []int64{4, 8})
+	okAll, errAll := resolver.Resolve(constraintAll, mapContext)
+	assert.Nil(t, errAll)
+	assert.True(t, okAll)
+
+	constraintNone := NewConstraint("Key", OPERATOR_HAS_NONE, []uint8{16, 23, 42})
+	okNone, errNone := resolver.Resolve(constraintNone, mapContext)
+	assert.Nil(t, errNone)
+	assert.True(t, okNone)
+
+	// Strings and numbers never match each other
+	constraintStrings := NewConstraint("Key", OPERATOR_HAS_ANY, []string{"4", "8"})
+	okStrings, errStrings := resolver.Resolve(constraintStrings, mapContext)
+	assert.Nil(t, errStrings)
+	assert.False(t, okStrings)
+}
+
+func TestIntersectionJSON(t *testing.T) {
+	// Both the context and the constraint come from JSON
+	var context map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"cohorts": [3, 7], "tags": ["a", "b"], "empty": []}`), &context))
+	mapContext := NewMapContext(context)
+
+	var constraint Constraint
+	assert.Nil(t, json.Unmarshal([]byte(`{"key": "cohorts", "operator": "HAS_ANY", "value": [7, 9]}`), &constraint))
+	assert.Nil(t, constraint.Validate())
+
+	resolver := resolver{}
+
+	ok, err := resolver.Resolve(&constraint, mapContext)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = resolver.Resolve(NewConstraint("tags", OPERATOR_HAS_ALL, []string{"a", "b"}), mapContext)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = resolver.Resolve(NewConstraint("empty", OPERATOR_HAS_ANY, []string{"a"}), mapContext)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = resolver.Resolve(NewConstraint("empty", OPERATOR_HAS_NONE, []string{"a"}), mapContext)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	assert.NotNil(t, NewConstraint("tags", OPERATOR_HAS_ALL, "a").Validate())
+	assert.NotNil(t, NewConstraint("tags", OPERATOR_HAS_ALL, []interface{}{true}).Validate())
+}
+
 func TestNoKey(t *testing.T) {
 	context := make(map[string]interface{})
 	context["Key"] = "cucumbers"
@@ -190,6 +519,31 @@ func testTypes(t *testing.T, context Context, constraintValue float64) {
 	ok1, err1 = resolver.Resolve(constraint, context)
 	assert.Nil(t, err1)
 	assert.True(t, ok1)
+
+	constraint = NewConstraint("Key", OPERATOR_EQ, uint(constraintValue))
+	ok1, err1 = resolver.Resolve(constraint, context)
+	assert.Nil(t, err1)
+	assert.True(t, ok1)
+
+	constraint = NewConstraint("Key", OPERATOR_EQ, uint8(constraintValue))
+	ok1, err1 = resolver.Resolve(constraint, context)
+	assert.Nil(t, err1)
+	assert.True(t, ok1)
+
+	constraint = NewConstraint("Key", OPERATOR_EQ, uint16(constraintValue))
+	ok1, err1 = resolver.Resolve(constraint, context)
+	assert.Nil(t, err1)
+	assert.True(t, ok1)
+
+	constraint = NewConstraint("Key", OPERATOR_EQ, uint32(constraintValue))
+	ok1, err1 = resolver.Resolve(constraint, context)
+	assert.Nil(t, err1)
+	assert.True(t, ok1)
+
+	constraint = NewConstraint("Key", OPERATOR_EQ, uint64(constraintValue))
+	ok1, err1 = resolver.Resolve(constraint, context)
+	assert.Nil(t, err1)
+	assert.True(t, ok1)
 }
 
 func testOperators(t *testing.T, context Context) {
@@ -254,4 +608,95 @@ func testOperators(t *testing.T, context Context) {
 	okBad, errBad := resolver.Resolve(constraintBad, context)
 	assert.NotNil(t, errBad)
 	assert.False(t, okBad)
+
+	// IN
+	constraintIn := NewConstraint("Key", OPERATOR_IN, []int{12, 3, 910})
+	okIn, errIn := resolver.Resolve(constraintIn, context)
+	assert.Nil(t, errIn)
+	assert.True(t, okIn)
+
+	// IN JSON
+	constraintInJSON := NewConstraint("Key", OPERATOR_IN, []interface{}{float64(12), float64(3)})
+	okInJSON, errInJSON := resolver.Resolve(constraintInJSON, context)
+	assert.Nil(t, errInJSON)
+	assert.True(t, okInJSON)
+
+	// CONTAINS
+	constraintContains := NewConstraint("Key", OPERATOR_CONTAINS, []float64{1.0, 3.0})
+	okContains, errContains := resolver.Resolve(constraintContains, context)
+	assert.Nil(t, errContains)
+	assert.True(t, okContains)
+
+	// NOT IN
+	constraintNotIn := NewConstraint("Key", OPERATOR_NOT_IN, []int64{12, 55, 910})
+	okNotIn, errNotIn := resolver.Resolve(constraintNotIn, context)
+	assert.Nil(t, errNotIn)
+	assert.True(t, okNotIn)
+
+	// NOT IN WRONG LIST TYPE
+	constraintNotInBad := NewConstraint("Key", OPERATOR_NOT_IN, []string{"3"})
+	okNotInBad, errNotInBad := resolver.Resolve(constraintNotInBad, context)
+	assert.NotNil(t, errNotInBad)
+	assert.False(t, okNotInBad)
+
+	// BETWEEN
+	constraintBetween := NewConstraint("Key", OPERATOR_BETWEEN, []interface{}{float64(3), float64(5)})
+	okBetween, errBetween := resolver.Resolve(constraintBetween, context)
+	assert.Nil(t, errBetween)
+	assert.True(t, okBetween)
+
+	// BETWEEN EXCLUSIVE
+	constraintBetweenExclusive := NewConstraint("Key", OPERATOR_BETWEEN_EXCLUSIVE, []int{3, 5})
+	okBetweenExclusive, errBetweenExclusive := resolver.Resolve(constraintBetweenExclusive, context)
+	assert.Nil(t, errBetweenExclusive)
+	assert.False(t, okBetweenExclusive)
+
+	// BETWEEN EXCLUSIVE 2
+	constraintBetweenExclusive2 := NewConstraint("Key", OPERATOR_BETWEEN_EXCLUSIVE, []int{2, 4})
+	okBetweenExclusive2, errBetweenExclusive2 := resolver.Resolve(constraintBetweenExclusive2, context)
+	assert.Nil(t, errBetweenExclusive2)
+	assert.True(t, okBetweenExclusive2)
+
+	// BETWEEN FRACTIONAL BOUNDS
+	fractionalContext := NewMapContext(map[string]interface{}{"Key": 17, "Other": 5, "One": int64(1)})
+
+	okFractional, errFractional := resolver.Resolve(NewConstraint("Key", OPERATOR_BETWEEN, []float64{17.5, 18}), fractionalContext)
+	assert.Nil(t, errFractional)
+	assert.False(t, okFractional)
+
+	okFractional, errFractional = resolver.Resolve(NewConstraint("Other", OPERATOR_BETWEEN_EXCLUSIVE, []interface{}{4.5, 5.5}), fractionalContext)
+	assert.Nil(t, errFractional)
+	assert.True(t, okFractional)
+
+	// IN FRACTIONAL MEMBERS
+	okFractional, errFractional = resolver.Resolve(NewConstraint("One", OPERATOR_IN, []float64{1.9}), fractionalContext)
+	assert.Nil(t, errFractional)
+	assert.False(t, okFractional)
+
+	okFractional, errFractional = resolver.Resolve(NewConstraint("One", OPERATOR_NOT_IN, []interface{}{0.5, 1.9}), fractionalContext)
+	assert.Nil(t, errFractional)
+	assert.True(t, okFractional)
+
+	// SCALAR FRACTIONAL VALUES
+	okFractional, errFractional = resolver.Resolve(NewConstraint("Other", OPERATOR_GT, 5.5), fractionalContext)
+	assert.Nil(t, errFractional)
+	assert.False(t, okFractional)
+
+	okFractional, errFractional = resolver.Resolve(NewConstraint("Other", OPERATOR_LT, 5.5), fractionalContext)
+	assert.Nil(t, errFractional)
+	assert.True(t, okFractional)
+
+	okFractional, errFractional = resolver.Resolve(NewConstraint("Other", OPERATOR_EQ, 5.9), fractionalContext)
+	assert.Nil(t, errFractional)
+	assert.False(t, okFractional)
+
+	okFractional, errFractional = resolver.Resolve(NewConstraint("Other", OPERATOR_GTE, float32(4.5)), fractionalContext)
+	assert.Nil(t, errFractional)
+	assert.True(t, okFractional)
+
+	// BETWEEN MISSING BOUND
+	constraintBetweenBad := NewConstraint("Key", OPERATOR_BETWEEN, []int{2})
+	okBetweenBad, errBetweenBad := resolver.Resolve(constraintBetweenBad, context)
+	assert.NotNil(t, errBetweenBad)
+	assert.False(t, okBetweenBad)
 }
@@ -0,0 +1,606 @@
+package experiment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment/constraint"
+	"reflect"
+	"strconv"
+)
+
+// CHANGE is intended to act as an enum for how something differs between two versions of a set of experiments.
+type CHANGE = string
+
+const (
+	CHANGE_ADDED    = "ADDED"
+	CHANGE_REMOVED  = "REMOVED"
+	CHANGE_MODIFIED = "MODIFIED"
+)
+
+// SUBJECT is intended to act as an enum for what a Change is about.
+type SUBJECT = string
+
+const (
+	SUBJECT_EXPERIMENT = "experiment"
+	SUBJECT_AUDIENCE   = "audience"
+	SUBJECT_VARIABLE   = "variable"
+	SUBJECT_CONSTRAINT = "constraint"
+	SUBJECT_SEGMENT    = "segment"
+	SUBJECT_EXPRESSION = "expression"
+	SUBJECT_VALUE      = "value"
+	SUBJECT_WEIGHT     = "weight"
+	SUBJECT_EXPOSURE   = "exposure"
+	SUBJECT_SALT       = "salt"
+	SUBJECT_ENABLED    = "enabled"
+	SUBJECT_STATUS     = "status"
+)
+
+// DefaultDiffSamples is the number of synthetic users DiffExperiments evaluates when given no sample count.
+const DefaultDiffSamples = 10000
+
+// Change is a single difference between two versions. Audience and Variable are empty for changes that are not
+// about them, and Before and After describe what changed, empty for what did not exist.
+type Change struct {
+	Kind       CHANGE
+	Subject    SUBJECT
+	Experiment string
+	Audience   string
+	Variable   string
+	Before     string
+	After      string
+}
+
+// Reassignment is the share of the users of an audience that would get a different value of a variable.
+type Reassignment struct {
+	Experiment   string
+	Audience     string
+	Variable     string
+	Fraction     float64 // Fraction of the users of the audience whose value changes
+	Exact        bool    // The fraction is computed, see DiffAllocations, rather than measured on sampled users
+	Sampled      int     // Number of sampled users of the audience the fraction was measured on
+	Rerandomized bool    // A salt changed, so every user is randomized again
+}
+
+// Diff is everything that differs between two versions of a set of experiments.
+type Diff struct {
+	Changes       []Change
+	Reassignments []Reassignment
+}
+
+// DiffExperiments compares two versions of a set of experiments, matching experiments and audiences by name. For every
+// variable of an audience found in both versions it reports how many users of the audience would get a different
+// value. The fraction is exact when the experiment or the audience is disabled in either version, or when
+// DiffAllocations computes it exactly and the values are unchanged. Otherwise it is estimated by evaluating samples
+// synthetic user IDs with both versions of the audience, as if the users matched it in both. Users that would move to
+// another audience because the constraints changed are only counted by DiffExperimentsWithContexts. Both versions must
+// be valid.
+func DiffExperiments(before []Experiment, after []Experiment, samples int) (*Diff, error) {
+	return DiffExperimentsWithContexts(before, after, samples, nil, nil)
+}
+
+// DiffExperimentsWithContexts is DiffExperiments for users with the given contexts. Every synthetic user is given the
+// contexts in turn and is evaluated with both versions in full, matching audiences by their constraints, segments and
+// expression, so that users moving between audiences are counted. Users count for the audience they matched before,
+// or after when they matched none before. The segment references of both versions are resolved with segments.
+func DiffExperimentsWithContexts(before []Experiment, after []Experiment, samples int, segments []Segment, contexts []constraint.Context) (*Diff, error) {
+	if samples <= 0 {
+		samples = DefaultDiffSamples
+	}
+
+	for _, experiments := range [][]Experiment{before, after} {
+		for i := range experiments {
+			if err := experiments[i].Validate(); err != nil {
+				return nil, fmt.Errorf("invalid experiment '%s': %w", experiments[i].Name, err)
+			}
+		}
+	}
+
+	d := &differ{diff: &Diff{}, samples: samples, contexts: contexts}
+
+	if len(contexts) > 0 {
+		if err := d.sampleContexts(before, after, segments); err != nil {
+			return nil, err
+		}
+	}
+
+	beforeMap := experimentsByName(before)
+	afterMap := experimentsByName(after)
+
+	for _, name := range unionNames(experimentNames(before), experimentNames(after)) {
+		beforeExperiment, afterExperiment := beforeMap[name], afterMap[name]
+
+		switch {
+		case beforeExperiment == nil:
+			d.add(Change{Kind: CHANGE_ADDED, Subject: SUBJECT_EXPERIMENT, Experiment: name, After: name})
+		case afterExperiment == nil:
+			d.add(Change{Kind: CHANGE_REMOVED, Subject: SUBJECT_EXPERIMENT, Experiment: name, Before: name})
+		default:
+			if err := d.experiment(beforeExperiment, afterExperiment); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return d.diff, nil
+}
+
+// Rerandomized returns the reassignments caused by a change of salt.
+func (d *Diff) Rerandomized() []Reassignment {
+	var rerandomized []Reassignment
+
+	for _, reassignment := range d.Reassignments {
+		if reassignment.Rerandomized {
+			rerandomized = append(rerandomized, reassignment)
+		}
+	}
+
+	return rerandomized
+}
+
+func (d *Diff) String() string {
+	var buffer bytes.Buffer
+
+	if len(d.Changes) == 0 {
+		buffer.WriteString("no changes\n")
+	}
+
+	for _, change := range d.Changes {
+		fmt.Fprintf(&buffer, "%s\n", change.String())
+	}
+
+	if len(d.Reassignments) > 0 {
+		buffer.WriteString("\nusers reassigned:\n")
+	}
+
+	for _, reassignment := range d.Reassignments {
+		fmt.Fprintf(&buffer, "  %s/%s %s: %.2f%%", reassignment.Experiment, reassignment.Audience, reassignment.Variable, 100*reassignment.Fraction)
+
+		if !reassignment.Exact {
+			fmt.Fprintf(&buffer, " (%d users sampled)", reassignment.Sampled)
+		}
+
+		if reassignment.Rerandomized {
+			buffer.WriteString(" (full re-randomization)")
+		}
+
+		buffer.WriteString("\n")
+	}
+
+	return buffer.String()
+}
+
+func (c Change) String() string {
+	location := c.Experiment
+
+	if c.Audience != "" {
+		location += "/" + c.Audience
+	}
+
+	if c.Variable != "" {
+		location += " " + c.Variable
+	}
+
+	switch c.Kind {
+	case CHANGE_ADDED:
+		return fmt.Sprintf("+ %s %s: %s", c.Subject, location, c.After)
+	case CHANGE_REMOVED:
+		return fmt.Sprintf("- %s %s: %s", c.Subject, location, c.Before)
+	default:
+		return fmt.Sprintf("~ %s %s: %s -> %s", c.Subject, location, c.Before, c.After)
+	}
+}
+
+type differ struct {
+	diff     *Diff
+	samples  int
+	contexts []constraint.Context
+	sampled  map[sampleKey]*sampleCount // Sampled users by the audience they count for, see sampleContexts
+}
+
+type sampleKey struct {
+	experiment string
+	audience   string
+	variable   string
+}
+
+type sampleCount struct {
+	users   int
+	changed int
+}
+
+func (d *differ) add(change Change) {
+	d.diff.Changes = append(d.diff.Changes, change)
+}
+
+func (d *differ) modified(subject SUBJECT, experiment string, audience string, variable string, before string, after string) {
+	if before != after {
+		d.add(Change{Kind: CHANGE_MODIFIED, Subject: subject, Experiment: experiment, Audience: audience, Variable: variable, Before: before, After: after})
+	}
+}
+
+// set reports the elements found in only one of two lists.
+func (d *differ) set(subject SUBJECT, experiment string, audience string, variable string, before []string, after []string) {
+	beforeSet := make(map[string]bool)
+	for _, s := range before {
+		beforeSet[s] = true
+	}
+
+	afterSet := make(map[string]bool)
+	for _, s := range after {
+		afterSet[s] = true
+	}
+
+	for _, s := range unionNames(before, after) {
+		if !afterSet[s] {
+			d.add(Change{Kind: CHANGE_REMOVED, Subject: subject, Experiment: experiment, Audience: audience, Variable: variable, Before: s})
+		} else if !beforeSet[s] {
+			d.add(Change{Kind: CHANGE_ADDED, Subject: subject, Experiment: experiment, Audience: audience, Variable: variable, After: s})
+		}
+	}
+}
+
+func (d *differ) experiment(before *Experiment, after *Experiment) error {
+	name := after.Name
+
+	d.modified(SUBJECT_SALT, name, "", "", before.Salt, after.Salt)
+	d.modified(SUBJECT_ENABLED, name, "", "", strconv.FormatBool(before.Enabled), strconv.FormatBool(after.Enabled))
+	d.modified(SUBJECT_STATUS, name, "", "", before.Status, after.Status)
+	d.set(SUBJECT_VARIABLE, name, "", "", before.VariableNames, after.VariableNames)
+
+	beforeAudiences := make([]string, len(before.Audiences))
+	for i, audience := range before.Audiences {
+		beforeAudiences[i] = audience.Name
+	}
+
+	afterAudiences := make([]string, len(after.Audiences))
+	for i, audience := range after.Audiences {
+		afterAudiences[i] = audience.Name
+	}
+
+	d.set(SUBJECT_AUDIENCE, name, "", "", beforeAudiences, afterAudiences)
+
+	// Allocation changes by audience and variable
+	allocations := make(map[string]map[string]AllocationChange)
+	for _, change := range DiffAllocations(before, after) {
+		if allocations[change.Audience] == nil {
+			allocations[change.Audience] = make(map[string]AllocationChange)
+		}
+
+		allocations[change.Audience][change.Variable] = change
+	}
+
+	for i := range after.Audiences {
+		afterAudience := &after.Audiences[i]
+		beforeAudience := findAudience(before, afterAudience.Name)
+
+		if beforeAudience == nil {
+			continue
+		}
+
+		if err := d.audience(before, beforeAudience, after, afterAudience, allocations[afterAudience.Name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *differ) audience(beforeExperiment *Experiment, before *Audience, afterExperiment *Experiment, after *Audience, allocations map[string]AllocationChange) error {
+	name, audience := afterExperiment.Name, after.Name
+
+	d.modified(SUBJECT_ENABLED, name, audience, "", strconv.FormatBool(before.Enabled), strconv.FormatBool(after.Enabled))
+	d.modified(SUBJECT_EXPOSURE, name, audience, "", formatFloat(before.Exposure), formatFloat(after.Exposure))
+	d.set(SUBJECT_CONSTRAINT, name, audience, "", describeConstraints(before.Constraints), describeConstraints(after.Constraints))
+	d.set(SUBJECT_SEGMENT, name, audience, "", before.Segments, after.Segments)
+	d.modified(SUBJECT_EXPRESSION, name, audience, "", before.Expression, after.Expression)
+
+	d.set(SUBJECT_VARIABLE, name, audience, "", valueGroupNames(before), valueGroupNames(after))
+
+	for _, variable := range valueGroupNames(after) {
+		beforeGroup, ok := before.ValueGroups[variable]
+
+		if !ok {
+			continue
+		}
+
+		afterGroup := after.ValueGroups[variable]
+
+		d.modified(SUBJECT_SALT, name, audience, variable, beforeGroup.Salt, afterGroup.Salt)
+		d.valueGroup(name, audience, beforeGroup, afterGroup)
+
+		reassignment := Reassignment{
+			Experiment:   name,
+			Audience:     audience,
+			Variable:     variable,
+			Rerandomized: beforeExperiment.Salt != afterExperiment.Salt || beforeGroup.Salt != afterGroup.Salt,
+		}
+
+		// Users get no value at all while the experiment or the audience is disabled
+		beforeServed := beforeExperiment.Enabled && before.Enabled
+		afterServed := afterExperiment.Enabled && after.Enabled
+		allocation := allocations[variable]
+
+		switch {
+		case len(d.contexts) > 0:
+			if count := d.sampled[sampleKey{experiment: name, audience: audience, variable: variable}]; count != nil && count.users > 0 {
+				reassignment.Fraction = float64(count.changed) / float64(count.users)
+				reassignment.Sampled = count.users
+			}
+		case beforeServed != afterServed:
+			reassignment.Fraction, reassignment.Exact = 1, true
+		case !beforeServed:
+			reassignment.Exact = true
+		case !allocation.Estimated && indexedValues(beforeGroup, afterGroup):
+			reassignment.Fraction, reassignment.Exact = allocation.Fraction, true
+		default:
+			fraction, err := d.sample(beforeExperiment, before, afterExperiment, after, variable)
+
+			if err != nil {
+				return err
+			}
+
+			reassignment.Fraction, reassignment.Sampled = fraction, d.samples
+		}
+
+		d.diff.Reassignments = append(d.diff.Reassignments, reassignment)
+	}
+
+	return nil
+}
+
+// sample returns the fraction of synthetic users of an audience that get a different value from both versions, both
+// of which are served.
+func (d *differ) sample(beforeExperiment *Experiment, before *Audience, afterExperiment *Experiment, after *Audience, variable string) (float64, error) {
+	s := &service{}
+	changed := 0
+
+	for i := 0; i < d.samples; i++ {
+		userID := diffUserID(i)
+
+		beforeValue, err := s.getVariable(beforeExperiment, before, variable, userID)
+
+		if err != nil {
+			return 0, errors.Annotatef(err, "could not evaluate variable '%s' of audience '%s'", variable, before.Name)
+		}
+
+		afterValue, err := s.getVariable(afterExperiment, after, variable, userID)
+
+		if err != nil {
+			return 0, errors.Annotatef(err, "could not evaluate variable '%s' of audience '%s'", variable, after.Name)
+		}
+
+		if !sameValue(beforeValue, afterValue) {
+			changed++
+		}
+	}
+
+	return float64(changed) / float64(d.samples), nil
+}
+
+// sampleContexts evaluates every variable of both versions for the synthetic users, given the contexts in turn, and
+// counts the users whose value changes by the audience they matched before, or after when they matched none before.
+func (d *differ) sampleContexts(before []Experiment, after []Experiment, segments []Segment) error {
+	var services []*service
+
+	for _, experiments := range [][]Experiment{before, after} {
+		service := NewService()
+
+		if err := service.ReloadSegments(segments); err != nil {
+			return err
+		}
+
+		if err := service.Reload(experiments); err != nil {
+			return err
+		}
+
+		services = append(services, service)
+	}
+
+	d.sampled = make(map[sampleKey]*sampleCount)
+
+	for _, variable := range unionNames(variableNames(before), variableNames(after)) {
+		for i := 0; i < d.samples; i++ {
+			userID, context := diffUserID(i), d.contexts[i%len(d.contexts)]
+
+			beforeResult, err := sampleVariable(services[0], variable, userID, context)
+
+			if err != nil {
+				return err
+			}
+
+			afterResult, err := sampleVariable(services[1], variable, userID, context)
+
+			if err != nil {
+				return err
+			}
+
+			matched := beforeResult
+			if matched == nil {
+				matched = afterResult
+			}
+
+			if matched == nil {
+				continue
+			}
+
+			key := sampleKey{experiment: matched.Experiment.Name, audience: matched.Audience.Name, variable: variable}
+			count := d.sampled[key]
+
+			if count == nil {
+				count = &sampleCount{}
+				d.sampled[key] = count
+			}
+
+			count.users++
+
+			if beforeResult == nil || afterResult == nil || !sameValue(beforeResult.Value, afterResult.Value) {
+				count.changed++
+			}
+		}
+	}
+
+	return nil
+}
+
+// sampleVariable evaluates a variable for a synthetic user, returning no result when the user gets no value.
+func sampleVariable(service *service, variable string, userID string, context constraint.Context) (*GetVariableResult, error) {
+	result, err := service.GetVariable(variable, userID, context)
+
+	if err != nil {
+		if e, ok := err.(*Error); ok && (e.Kind == ErrUnknownVariable || e.Kind == ErrNoAudienceMatched || e.Kind == constraint.ErrKeyNotFound) {
+			return nil, nil
+		}
+
+		return nil, errors.Annotatef(err, "could not evaluate variable '%s' for user '%s'", variable, userID)
+	}
+
+	return result, nil
+}
+
+func diffUserID(index int) string {
+	return "diff_user_" + strconv.Itoa(index)
+}
+
+// indexedValues tells if users get the same value from two versions of a value group exactly when they get the value
+// at the same index, so that the reassignments counted by DiffAllocations are changes of value.
+func indexedValues(before *ValueGroup, after *ValueGroup) bool {
+	if len(before.WeightedValues) != len(after.WeightedValues) || !sameValue(&before.ControlValue, &after.ControlValue) {
+		return false
+	}
+
+	values := []*Value{&before.ControlValue}
+
+	for i := range before.WeightedValues {
+		if !sameValue(&before.WeightedValues[i].Value, &after.WeightedValues[i].Value) {
+			return false
+		}
+
+		values = append(values, &before.WeightedValues[i].Value)
+	}
+
+	for i := range values {
+		for j := i + 1; j < len(values); j++ {
+			if sameValue(values[i], values[j]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// sameValue tells if users get the same value from a and b, either of which may be nil. JSON values are compared
+// once decoded, so that whitespace does not count, such as between an experiment file and its conversion to YAML.
+func sameValue(a *Value, b *Value) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.Type == VALUE_TYPE_JSON && b.Type == VALUE_TYPE_JSON {
+		var aDocument, bDocument interface{}
+
+		if json.Unmarshal(a.JSONValue, &aDocument) == nil && json.Unmarshal(b.JSONValue, &bDocument) == nil {
+			return reflect.DeepEqual(aDocument, bDocument)
+		}
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func (d *differ) valueGroup(experiment string, audience string, before *ValueGroup, after *ValueGroup) {
+	variable := after.Name
+
+	d.modified(SUBJECT_VALUE, experiment, audience, variable, "control "+describeValue(&before.ControlValue), "control "+describeValue(&after.ControlValue))
+
+	for i := 0; i < len(before.WeightedValues) || i < len(after.WeightedValues); i++ {
+		switch {
+		case i >= len(after.WeightedValues):
+			d.add(Change{Kind: CHANGE_REMOVED, Subject: SUBJECT_VALUE, Experiment: experiment, Audience: audience, Variable: variable, Before: describeWeightedValue(i, &before.WeightedValues[i])})
+		case i >= len(before.WeightedValues):
+			d.add(Change{Kind: CHANGE_ADDED, Subject: SUBJECT_VALUE, Experiment: experiment, Audience: audience, Variable: variable, After: describeWeightedValue(i, &after.WeightedValues[i])})
+		default:
+			beforeValue, afterValue := &before.WeightedValues[i], &after.WeightedValues[i]
+			d.modified(SUBJECT_VALUE, experiment, audience, variable, fmt.Sprintf("%d: %s", i, describeValue(&beforeValue.Value)), fmt.Sprintf("%d: %s", i, describeValue(&afterValue.Value)))
+			d.modified(SUBJECT_WEIGHT, experiment, audience, variable, fmt.Sprintf("%d: %d", i, beforeValue.Weight), fmt.Sprintf("%d: %d", i, afterValue.Weight))
+		}
+	}
+}
+
+func experimentsByName(experiments []Experiment) map[string]*Experiment {
+	experimentMap := make(map[string]*Experiment)
+
+	for i := range experiments {
+		experimentMap[experiments[i].Name] = &experiments[i]
+	}
+
+	return experimentMap
+}
+
+func experimentNames(experiments []Experiment) []string {
+	names := make([]string, len(experiments))
+
+	for i, experiment := range experiments {
+		names[i] = experiment.Name
+	}
+
+	return names
+}
+
+// variableNames returns the variables of the experiments, without repetition.
+func variableNames(experiments []Experiment) []string {
+	var names []string
+
+	for _, experiment := range experiments {
+		names = append(names, experiment.VariableNames...)
+	}
+
+	return unionNames(names, nil)
+}
+
+// unionNames returns the names found in either list, in the order of before followed by the new names of after.
+func unionNames(before []string, after []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, list := range [][]string{before, after} {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+func describeConstraints(constraints []constraint.Constraint) []string {
+	descriptions := make([]string, len(constraints))
+
+	for i := range constraints {
+		c := &constraints[i]
+		value, _ := json.Marshal(c.Value)
+		descriptions[i] = fmt.Sprintf("%s %s %s", c.Key, c.Operator, value)
+
+		if c.Missing != "" {
+			descriptions[i] += " (missing " + c.Missing + ")"
+		}
+	}
+
+	return descriptions
+}
+
+func describeValue(value *Value) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func describeWeightedValue(index int, value *WeightedValue) string {
+	return fmt.Sprintf("%d: %s weight %d", index, describeValue(&value.Value), value.Weight)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,217 @@
+package experiment
+
+import (
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func newDiffExperiment(t *testing.T) *Experiment {
+	builder := NewAdvancedFactorialBuilder("checkout")
+	assert.Nil(t, builder.AddStrings("button_text", "us", []uint32{50, 50}, []string{"Buy", "Purchase"}))
+	assert.Nil(t, builder.AddInts("price", "us", []uint32{1, 1, 1}, []int64{10, 20, 30}))
+	assert.Nil(t, builder.AddConstraint("us", constraint.NewConstraint("country", constraint.OPERATOR_EQ, "US")))
+
+	experiment, err := builder.Build()
+	assert.Nil(t, err)
+
+	return experiment
+}
+
+func TestDiffExperimentsUnchanged(t *testing.T) {
+	experiment := newDiffExperiment(t)
+
+	diff, err := DiffExperiments([]Experiment{*experiment}, []Experiment{*copyExperiment(t, experiment)}, 1000)
+	assert.Nil(t, err)
+	assert.Empty(t, diff.Changes)
+	assert.Len(t, diff.Reassignments, 2)
+
+	for _, reassignment := range diff.Reassignments {
+		assert.Equal(t, 0.0, reassignment.Fraction)
+		assert.False(t, reassignment.Rerandomized)
+	}
+
+	assert.True(t, strings.HasPrefix(diff.String(), "no changes\n"))
+}
+
+func TestDiffExperimentsAcrossFormats(t *testing.T) {
+	before, err := LoadExperimentFiles([]string{"testdata/experiments/typed_values_1.json"})
+	assert.Nil(t, err)
+
+	after, err := LoadExperimentFiles([]string{"testdata/experiments/typed_values_1.yaml"})
+	assert.Nil(t, err)
+
+	diff, err := DiffExperiments(before, after, 1000)
+	assert.Nil(t, err)
+	assert.Empty(t, diff.Changes)
+
+	for _, reassignment := range diff.Reassignments {
+		assert.Equal(t, 0.0, reassignment.Fraction, reassignment.Variable)
+	}
+}
+
+func TestDiffExperiments(t *testing.T) {
+	before := newDiffExperiment(t)
+	after := copyExperiment(t, before)
+
+	audience := &after.Audiences[0]
+	audience.Exposure = 0.5
+	audience.Constraints[0].Value = "CA"
+	audience.ValueGroups["button_text"].WeightedValues[0].Weight = 40
+	audience.ValueGroups["button_text"].WeightedValues[1].Weight = 60
+	audience.ValueGroups["price"].Salt = "new_salt"
+
+	added := newDiffExperiment(t)
+	added.Name = "added"
+
+	diff, err := DiffExperiments([]Experiment{*before}, []Experiment{*after, *added}, 10000)
+	assert.Nil(t, err)
+
+	changes := make(map[string]Change)
+	for _, change := range diff.Changes {
+		changes[change.Kind+" "+change.Subject+" "+change.Variable] = change
+	}
+
+	assert.Len(t, diff.Changes, 7)
+	assert.Contains(t, changes, "ADDED experiment ")
+	assert.Equal(t, "1", changes["MODIFIED exposure "].Before)
+	assert.Equal(t, "0.5", changes["MODIFIED exposure "].After)
+	assert.Equal(t, `country EQ "US"`, changes["REMOVED constraint "].Before)
+	assert.Equal(t, `country EQ "CA"`, changes["ADDED constraint "].After)
+	assert.Equal(t, "new_salt", changes["MODIFIED salt price"].After)
+	assert.Equal(t, "1: 60", changes["MODIFIED weight button_text"].After)
+
+	reassignments := make(map[string]Reassignment)
+	for _, reassignment := range diff.Reassignments {
+		reassignments[reassignment.Variable] = reassignment
+	}
+
+	// Half of the users leave for the control value, which half of them already had, and a tenth of the others change
+	// value
+	assert.False(t, reassignments["button_text"].Rerandomized)
+	assert.False(t, reassignments["button_text"].Exact)
+	assert.Equal(t, 10000, reassignments["button_text"].Sampled)
+	assert.InDelta(t, 0.3, reassignments["button_text"].Fraction, 0.02)
+
+	// Users get 10 with a chance of 1/3 before and 2/3 after, and 20 or 30 with 1/3 before and 1/6 after
+	assert.True(t, reassignments["price"].Rerandomized)
+	assert.InDelta(t, 2.0/3, reassignments["price"].Fraction, 0.02)
+
+	assert.Len(t, diff.Rerandomized(), 1)
+	assert.Contains(t, diff.String(), "checkout/us price: ")
+	assert.Contains(t, diff.String(), "(10000 users sampled)")
+	assert.Contains(t, diff.String(), "(full re-randomization)")
+}
+
+func TestDiffExperimentsExact(t *testing.T) {
+	before := newDiffExperiment(t)
+	before.Audiences[0].ValueGroups["button_text"].ControlValue = *NewStringValue("Checkout")
+	before.Audiences[0].ValueGroups["button_text"].WeightedValues[0].Weight = 5000
+	before.Audiences[0].ValueGroups["button_text"].WeightedValues[1].Weight = 5000
+	before.Audiences[0].Exposure = 0.5
+
+	// Exposure and position come from the same hash, only the exposed half of the positions has a value
+	after := copyExperiment(t, before)
+	after.Audiences[0].ValueGroups["button_text"].WeightedValues[0].Weight = 4000
+	after.Audiences[0].ValueGroups["button_text"].WeightedValues[1].Weight = 6000
+
+	diff, err := DiffExperiments([]Experiment{*before}, []Experiment{*after}, 10000)
+	assert.Nil(t, err)
+	assert.True(t, diff.Reassignments[0].Exact)
+	assert.Equal(t, 0, diff.Reassignments[0].Sampled)
+	assert.InDelta(t, 0.1, diff.Reassignments[0].Fraction, 1e-9)
+
+	// A value that changes is measured instead, users keeping their position get another value
+	after.Audiences[0].ValueGroups["button_text"].WeightedValues[0].Value = *NewStringValue("Order")
+
+	diff, err = DiffExperiments([]Experiment{*before}, []Experiment{*after}, 10000)
+	assert.Nil(t, err)
+	assert.False(t, diff.Reassignments[0].Exact)
+	assert.InDelta(t, 0.5, diff.Reassignments[0].Fraction, 0.02)
+}
+
+func TestDiffExperimentsWithContexts(t *testing.T) {
+	before := newDiffExperiment(t)
+
+	// Canadian users join the audience through a segment
+	after := copyExperiment(t, before)
+	after.Audiences[0].Constraints = nil
+	after.Audiences[0].Segments = []string{"north_america"}
+	segments := []Segment{{Name: "north_america", Constraints: []constraint.Constraint{*constraint.NewConstraint("country", constraint.OPERATOR_IN, []interface{}{"US", "CA"})}}}
+
+	contexts := []constraint.Context{
+		constraint.NewMapContext(map[string]interface{}{"country": "US"}),
+		constraint.NewMapContext(map[string]interface{}{"country": "CA"}),
+		constraint.NewMapContext(map[string]interface{}{"country": "FR"}),
+	}
+
+	// Users of the audience in both versions keep their value, those joining it get one, the others are not counted
+	diff, err := DiffExperimentsWithContexts([]Experiment{*before}, []Experiment{*after}, 900, segments, contexts)
+	assert.Nil(t, err)
+	assert.Len(t, diff.Reassignments, 2)
+
+	for _, reassignment := range diff.Reassignments {
+		assert.False(t, reassignment.Exact)
+		assert.Equal(t, 600, reassignment.Sampled, reassignment.Variable)
+		assert.Equal(t, 0.5, reassignment.Fraction, reassignment.Variable)
+	}
+
+	// Without contexts users are assumed to match the audience in both versions
+	diff, err = DiffExperiments([]Experiment{*before}, []Experiment{*after}, 900)
+	assert.Nil(t, err)
+
+	for _, reassignment := range diff.Reassignments {
+		assert.Equal(t, 0.0, reassignment.Fraction, reassignment.Variable)
+	}
+
+	// Segments must be given for the references to resolve
+	_, err = DiffExperimentsWithContexts([]Experiment{*before}, []Experiment{*after}, 900, nil, contexts)
+	assert.NotNil(t, err)
+}
+
+func TestDiffExperimentsAudiencesAndVariables(t *testing.T) {
+	before := newDiffExperiment(t)
+	after := copyExperiment(t, before)
+
+	after.Audiences[0].Name = "united_states"
+	after.Enabled = false
+
+	diff, err := DiffExperiments([]Experiment{*before}, []Experiment{*after}, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{
+		{Kind: CHANGE_MODIFIED, Subject: SUBJECT_ENABLED, Experiment: "checkout", Before: "true", After: "false"},
+		{Kind: CHANGE_REMOVED, Subject: SUBJECT_AUDIENCE, Experiment: "checkout", Before: "us"},
+		{Kind: CHANGE_ADDED, Subject: SUBJECT_AUDIENCE, Experiment: "checkout", After: "united_states"},
+	}, diff.Changes)
+	assert.Empty(t, diff.Reassignments)
+
+	// Disabling an audience takes its value from every user
+	after = copyExperiment(t, before)
+	after.Audiences[0].Enabled = false
+
+	diff, err = DiffExperiments([]Experiment{*before}, []Experiment{*after}, 100)
+	assert.Nil(t, err)
+	assert.Len(t, diff.Reassignments, 2)
+
+	for _, reassignment := range diff.Reassignments {
+		assert.Equal(t, 1.0, reassignment.Fraction, reassignment.Variable)
+	}
+
+	// Removing a variable
+	after = copyExperiment(t, before)
+	after.VariableNames = []string{"button_text"}
+	delete(after.Audiences[0].ValueGroups, "price")
+
+	diff, err = DiffExperiments([]Experiment{*before}, []Experiment{*after}, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{
+		{Kind: CHANGE_REMOVED, Subject: SUBJECT_VARIABLE, Experiment: "checkout", Before: "price"},
+		{Kind: CHANGE_REMOVED, Subject: SUBJECT_VARIABLE, Experiment: "checkout", Audience: "us", Before: "price"},
+	}, diff.Changes)
+
+	// Invalid experiments can't be compared
+	after.Salt = ""
+	_, err = DiffExperiments([]Experiment{*before}, []Experiment{*after}, 100)
+	assert.NotNil(t, err)
+}
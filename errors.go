@@ -0,0 +1,37 @@
+package experiment
+
+import (
+	"github.com/juju/errors"
+)
+
+// The reasons GetVariable and Explain may not return a value. Test for them with errors.Is.
+var (
+	// ErrUnknownVariable is returned when no experiment has the variable.
+	ErrUnknownVariable = errors.New("unknown variable")
+
+	// ErrNoAudienceMatched is returned when the variable is known but no enabled audience matched the context.
+	ErrNoAudienceMatched = errors.New("no audience matched")
+
+	// ErrTypeMismatch is returned by the typed getters when the value is not of the type asked for.
+	ErrTypeMismatch = errors.New("type mismatch")
+)
+
+// Error is an error about evaluating a variable. Kind is one of the errors above and Err holds the details.
+type Error struct {
+	Kind     error
+	Variable string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Is reports whether target is the Kind of the error.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -1,80 +1,118 @@
 package experiment
 
-import "github.com/juju/errors"
+import (
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/sneakylocke/experiment/validation"
+)
 
 type Experiment struct {
-	Name          string     `json:"name"`          // Name of the experiment
-	VariableNames []string   `json:"variableNames"` // Names of variables allowed to be randomized in audiences
-	Audiences     []Audience `json:"audiences"`     // Details of variables are captured in a single audience. Users may belong to one audience
-	Salt          string     `json:"salt"`
-	Enabled       bool       `json:"enabled"`
+	Name          string         `json:"name"`          // Name of the experiment
+	VariableNames []string       `json:"variableNames"` // Names of variables allowed to be randomized in audiences
+	Audiences     []Audience     `json:"audiences"`     // Details of variables are captured in a single audience. Users may belong to one audience
+	Salt          string         `json:"salt"`
+	Enabled       bool           `json:"enabled"`
+	Status        STATUS         `json:"status,omitempty"`  // Lifecycle of the experiment, empty for experiments that predate it
+	Winners       map[string]int `json:"winners,omitempty"` // Index of the winning weighted value of each variable once concluded
 }
 
 type WeightedValue struct {
-	Value  Value  `json:"value"`
-	Weight uint32 `json:"weight"`
+	Value   Value         `json:"value"`
+	Weight  uint32        `json:"weight"`
+	Buckets []BucketRange `json:"buckets,omitempty"` // Buckets owned by the value when its value group allocates buckets
 }
 
+// Validate returns every error with the experiment, each with the path of its field such as
+// audiences[2].valueGroups.b.salt, see validation.Errors. Warnings are left out, use Check to get them too.
 func (e *Experiment) Validate() error {
+	problems := &validation.Collector{}
+	e.validate(problems, constraint.MISSING_FAIL)
+
+	return problems.Err()
+}
+
+// Check returns every problem with the experiment, errors and warnings about what is valid but most likely a
+// mistake, such as an audience that can never be reached. Constraints without a missing key policy are checked as
+// NewService resolves them, use CheckWithPolicy for a service created with another policy.
+func (e *Experiment) Check() []*validation.Problem {
+	return e.CheckWithPolicy(constraint.MISSING_FAIL)
+}
+
+// CheckWithPolicy is Check for a service created with NewServiceWithPolicy, whose policy applies to the constraints
+// that don't set one.
+func (e *Experiment) CheckWithPolicy(missing constraint.MISSING) []*validation.Problem {
+	problems := &validation.Collector{}
+	e.validate(problems, missing)
+
+	return problems.Problems()
+}
+
+func (e *Experiment) validate(problems *validation.Collector, missing constraint.MISSING) {
 	if e.Name == "" {
-		return errors.New("no name")
+		problems.Addf("name", "no name")
 	}
 
 	if e.Salt == "" {
-		return errors.New("no salt")
+		problems.Addf("salt", "no salt")
 	}
 
-	if e.VariableNames == nil || len(e.VariableNames) == 0 {
-		return errors.New("no variable names")
+	if len(e.VariableNames) == 0 {
+		problems.Addf("variableNames", "no variable names")
 	}
 
-	if e.Audiences == nil || len(e.Audiences) == 0 {
-		return errors.New("no audiences")
+	if len(e.Audiences) == 0 {
+		problems.Addf("audiences", "no audiences")
 	}
 
-	// Validate individual audiences
-	for _, audience := range e.Audiences {
-		if err := audience.Validate(); err != nil {
-			return err
+	// Validate individual audiences. Users get the value of the first audience they match, so nobody reaches the
+	// audiences after one that everyone matches.
+	catchAll := -1
+
+	for i := range e.Audiences {
+		audience := &e.Audiences[i]
+		audience.validate(problems.At(validation.Index("audiences", i)), missing)
+
+		if catchAll >= 0 {
+			problems.Warnf(validation.Index("audiences", i), "audience '%s' can never be matched since audience '%s' before it matches everyone", audience.Name, e.Audiences[catchAll].Name)
+		} else if audience.matchesEveryone() {
+			catchAll = i
 		}
 	}
 
+	e.validateLifecycle(problems)
+
 	// Validate audience names are unique
 	audienceNames := make(map[string]bool)
-	for _, audience := range e.Audiences {
+	for i, audience := range e.Audiences {
 		if _, ok := audienceNames[audience.Name]; ok {
-			return errors.Errorf("duplicate audience name: %s", audience.Name)
+			problems.Addf(validation.Field(validation.Index("audiences", i), "name"), "duplicate audience name: %s", audience.Name)
 		}
 
 		audienceNames[audience.Name] = true
 	}
 
 	// Validate experiment names correspond to audience variable names
-	nameMap := make(map[string]bool)
-	for _, audience := range e.Audiences {
-		for _, valueGroup := range audience.ValueGroups {
-			nameMap[valueGroup.Name] = true
-		}
-	}
-
 	experimentNameMap := make(map[string]bool)
 	for _, name := range e.VariableNames {
 		experimentNameMap[name] = true
 	}
 
-	// Check experiment variable names
-	for name, _ := range nameMap {
-		if _, ok := experimentNameMap[name]; !ok {
-			return errors.Errorf("experiment variable names missing %s", name)
+	nameMap := make(map[string]bool)
+	for i, audience := range e.Audiences {
+		for _, name := range valueGroupNames(&audience) {
+			nameMap[name] = true
+
+			// Check experiment variable names
+			if !experimentNameMap[name] {
+				path := validation.Field(validation.Field(validation.Index("audiences", i), "valueGroups"), name)
+				problems.Addf(path, "experiment variable names missing %s", name)
+			}
 		}
 	}
 
 	// Check audience variable names
-	for name, _ := range experimentNameMap {
-		if _, ok := nameMap[name]; !ok {
-			return errors.Errorf("audience variable names missing %s", name)
+	for i, name := range e.VariableNames {
+		if !nameMap[name] {
+			problems.Addf(validation.Index("variableNames", i), "audience variable names missing %s", name)
 		}
 	}
-
-	return nil
 }
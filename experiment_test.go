@@ -2,6 +2,9 @@ package experiment
 
 import (
 	"encoding/json"
+	"errors"
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/sneakylocke/experiment/validation"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"testing"
@@ -27,6 +30,64 @@ func TestInvalidMissingVariableName(t *testing.T) {
 	testInvalid(t, "testdata/experiments/invalid_missing_variable_name.json")
 }
 
+func TestValidTypedValues1(t *testing.T) {
+	testValid(t, "testdata/experiments/typed_values_1.json")
+}
+
+func TestInvalidMixedValueTypes(t *testing.T) {
+	testInvalid(t, "testdata/experiments/invalid_mixed_value_types.json")
+}
+
+func TestValueGroupTypes(t *testing.T) {
+	valueGroup := NewStringValueGroup("color", []uint32{1, 1}, []string{"#ff0000", "#00ff00"})
+	valueGroup.ControlValue = *NewStringValue("#000000")
+	assert.Nil(t, valueGroup.Validate())
+
+	// The control value must be of the same type as the other values
+	valueGroup.ControlValue = *NewIntValue(0)
+	assert.NotNil(t, valueGroup.Validate())
+
+	// Values without a type are valid as long as all of them are
+	legacy := NewFloatValueGroup("legacy", []uint32{1}, []float64{1.5})
+	legacy.WeightedValues[0].Value.Type = ""
+	assert.Nil(t, legacy.Validate())
+
+	legacy.ControlValue = *NewFloatValue(1.5)
+	assert.NotNil(t, legacy.Validate())
+
+	invalid := []Value{
+		{Type: "COLOR"},
+		{Type: VALUE_TYPE_STRING, StringValue: "a", IntValue: 1},
+		{Type: VALUE_TYPE_JSON, JSONValue: json.RawMessage(`{"a":`)},
+		{Type: VALUE_TYPE_JSON},
+		{StringValue: "a"},
+	}
+
+	for _, value := range invalid {
+		assert.NotNil(t, value.Validate(), "%+v", value)
+	}
+}
+
+func TestLoadExperimentFile(t *testing.T) {
+	experiment, err := LoadExperimentFile("testdata/experiments/typed_values_1.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "typed_experiment", experiment.Name)
+
+	_, err = LoadExperimentFile("testdata/experiments/invalid_mixed_value_types.json")
+	assert.NotNil(t, err)
+
+	_, err = LoadExperimentFile("testdata/experiments/does_not_exist.json")
+	assert.NotNil(t, err)
+
+	_, err = LoadExperimentFile("testdata/experiments/invalid_unknown_field.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "weigth")
+
+	experiments, err := LoadExperimentFiles([]string{"testdata/experiments/valid_1.json", "testdata/experiments/typed_values_1.json"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(experiments))
+}
+
 func testValid(t *testing.T, file string) {
 	data, err := ioutil.ReadFile(file)
 
@@ -50,3 +111,74 @@ func testInvalid(t *testing.T, file string) {
 	assert.Nil(t, unmarshalErr)
 	assert.NotNil(t, experiment.Validate())
 }
+
+func TestValidateCollectsProblems(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/experiments/invalid_many_problems.json")
+	assert.Nil(t, err)
+
+	experiment := &Experiment{}
+	assert.Nil(t, json.Unmarshal(data, experiment))
+
+	err = experiment.Validate()
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []string{
+		"salt",
+		"audiences[1].exposure",
+		"audiences[1].valueGroups.b.salt",
+		"audiences[1].valueGroups.b.weightedValues",
+		"audiences[1].constraints[0].value",
+	}, problemPaths(err))
+
+	// The problems still read as a single error
+	assert.Contains(t, err.Error(), "audiences[1].valueGroups.b.salt: value groups should have a salt")
+
+	// The kind of constraint problems is kept
+	assert.True(t, errors.Is(err, constraint.ErrInvalidValue))
+
+	// Loading the file keeps the problems
+	_, err = LoadExperimentFile("testdata/experiments/invalid_many_problems.json")
+	assert.Contains(t, err.Error(), "invalid_many_problems.json")
+	assert.Len(t, validation.Problems(err), 5)
+	assert.True(t, errors.Is(err, constraint.ErrInvalidValue))
+
+	// So do reloading and diffing
+	err = NewService().Reload([]Experiment{*experiment})
+	assert.Contains(t, err.Error(), "could not reload experiment")
+	assert.Len(t, validation.Problems(err), 5)
+	assert.True(t, errors.Is(err, constraint.ErrInvalidValue))
+
+	_, err = DiffExperiments([]Experiment{*experiment}, nil, 1)
+	assert.Len(t, validation.Problems(err), 5)
+	assert.True(t, errors.Is(err, constraint.ErrInvalidValue))
+}
+
+func TestCheckWarnings(t *testing.T) {
+	experiment, err := LoadExperimentFile("testdata/experiments/warnings_1.json")
+	assert.Nil(t, err, "warnings don't make an experiment invalid")
+
+	problems := experiment.Check()
+	assert.Len(t, problems, 3)
+
+	for _, problem := range problems {
+		assert.Equal(t, validation.SEVERITY_WARNING, problem.Severity)
+	}
+
+	assert.Equal(t, "audiences[0].valueGroups.a.weightedValues", problems[0].Path)
+	assert.Equal(t, "audiences[0].constraints: the constraints on 'temperature' can never all be met", problems[1].Error())
+	assert.Equal(t, "audiences[2]", problems[2].Path)
+	assert.Contains(t, problems[2].Error(), "since audience 'everyone' before it matches everyone")
+
+	// Users without the key meet constraints that pass when it is missing
+	assert.Len(t, experiment.CheckWithPolicy(constraint.MISSING_PASS), 2)
+}
+
+func TestControlValueTypeMismatch(t *testing.T) {
+	valueGroup := NewIntValueGroup("a", []uint32{1, 1}, []int64{1, 2})
+	valueGroup.Salt = "a"
+	valueGroup.ControlValue = *NewStringValue("1")
+
+	problems := validation.Problems(valueGroup.Validate())
+	assert.Len(t, problems, 1)
+	assert.Equal(t, "controlValue.type: control value is of type 'STRING' but the weighted values are of type 'INT'", problems[0].Error())
+}
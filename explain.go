@@ -0,0 +1,148 @@
+package experiment
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sneakylocke/experiment/constraint"
+)
+
+// Explanation records how a variable was evaluated for a user: every audience that was considered, whether it
+// matched, and the result of each constraint along with the segment it came from.
+type Explanation struct {
+	Variable  string
+	UserID    string
+	Audiences []AudienceExplanation
+	Result    *GetVariableResult
+	Err       error
+}
+
+type AudienceExplanation struct {
+	Experiment  string
+	Audience    string
+	Skipped     string // Why the audience was not evaluated, empty if it was
+	Matched     bool
+	Constraints []ConstraintExplanation
+	Expression  *ExpressionExplanation // Set when the audience has an expression
+}
+
+type ExpressionExplanation struct {
+	Expression string
+	Satisfied  bool
+	Err        error
+}
+
+type ConstraintExplanation struct {
+	Segment    string // Reference of the segment the constraint came from, empty for the audience's own constraints
+	Constraint constraint.Constraint
+	Satisfied  bool
+	Err        error
+}
+
+// MatchedSegments returns the segments of the audience that was selected, if any.
+func (e *Explanation) MatchedSegments() []string {
+	if e.Result == nil {
+		return nil
+	}
+
+	return e.Result.Segments
+}
+
+func (e *Explanation) String() string {
+	var buffer bytes.Buffer
+
+	fmt.Fprintf(&buffer, "variable '%s' for user '%s'\n", e.Variable, e.UserID)
+
+	for _, audience := range e.Audiences {
+		fmt.Fprintf(&buffer, "  %s/%s: ", audience.Experiment, audience.Audience)
+
+		switch {
+		case audience.Skipped != "":
+			fmt.Fprintf(&buffer, "skipped (%s)\n", audience.Skipped)
+			continue
+		case audience.Matched:
+			buffer.WriteString("matched\n")
+		default:
+			buffer.WriteString("not matched\n")
+		}
+
+		for _, c := range audience.Constraints {
+			source := "audience"
+			if c.Segment != "" {
+				source = "segment " + c.Segment
+			}
+
+			fmt.Fprintf(&buffer, "    [%s] %s %s %v: %t", source, c.Constraint.Key, c.Constraint.Operator, c.Constraint.Value, c.Satisfied)
+
+			if c.Err != nil {
+				fmt.Fprintf(&buffer, " (%s)", c.Err)
+			}
+
+			buffer.WriteString("\n")
+		}
+
+		if audience.Expression != nil {
+			fmt.Fprintf(&buffer, "    [expression] %s: %t", audience.Expression.Expression, audience.Expression.Satisfied)
+
+			if audience.Expression.Err != nil {
+				fmt.Fprintf(&buffer, " (%s)", audience.Expression.Err)
+			}
+
+			buffer.WriteString("\n")
+		}
+	}
+
+	if e.Err != nil {
+		fmt.Fprintf(&buffer, "  error: %s\n", e.Err)
+	}
+
+	return buffer.String()
+}
+
+// The helpers below do nothing on a nil receiver so evaluation does not need to check whether it is explaining.
+
+func (e *Explanation) skip(experiment *Experiment, audience *Audience, reason string) {
+	if e == nil {
+		return
+	}
+
+	audienceName := ""
+	if audience != nil {
+		audienceName = audience.Name
+	}
+
+	e.Audiences = append(e.Audiences, AudienceExplanation{Experiment: experiment.Name, Audience: audienceName, Skipped: reason})
+}
+
+func (e *Explanation) audience(experiment *Experiment, audience *Audience) *AudienceExplanation {
+	if e == nil {
+		return nil
+	}
+
+	e.Audiences = append(e.Audiences, AudienceExplanation{Experiment: experiment.Name, Audience: audience.Name})
+
+	return &e.Audiences[len(e.Audiences)-1]
+}
+
+func (a *AudienceExplanation) constraint(c *segmentConstraint, satisfied bool, err error) {
+	if a == nil {
+		return
+	}
+
+	a.Constraints = append(a.Constraints, ConstraintExplanation{Segment: c.segment, Constraint: c.constraint, Satisfied: satisfied, Err: err})
+}
+
+func (a *AudienceExplanation) expression(expression *constraint.Expression, satisfied bool, err error) {
+	if a == nil {
+		return
+	}
+
+	a.Expression = &ExpressionExplanation{Expression: expression.String(), Satisfied: satisfied, Err: err}
+}
+
+func (a *AudienceExplanation) matched(matched bool) {
+	if a == nil {
+		return
+	}
+
+	a.Matched = matched
+}
@@ -0,0 +1,439 @@
+package experiment
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/BurntSushi/toml"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v3"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FORMAT is intended to act as an enum for the formats experiment files can be written in. Every format uses the
+// field names of JSON.
+type FORMAT = string
+
+const (
+	FORMAT_JSON = "JSON"
+	FORMAT_YAML = "YAML"
+	FORMAT_TOML = "TOML" // Can be read but not written
+)
+
+// FormatOf returns the format of an experiment file from its extension: .json, .yaml or .yml, or .toml.
+func FormatOf(path string) (FORMAT, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FORMAT_JSON, nil
+	case ".yaml", ".yml":
+		return FORMAT_YAML, nil
+	case ".toml":
+		return FORMAT_TOML, nil
+	default:
+		return "", errors.Errorf("unknown experiment file format of '%s', expected .json, .yaml, .yml or .toml", path)
+	}
+}
+
+// DecodeExperiment decodes an experiment written in format without validating it. Fields that are not part of an
+// experiment are an error.
+func DecodeExperiment(data []byte, format FORMAT) (*Experiment, error) {
+	if format != FORMAT_JSON {
+		var err error
+
+		if data, err = ConvertExperiment(data, format, FORMAT_JSON); err != nil {
+			return nil, err
+		}
+
+		// Compact so that JSON values are kept as they would be written inline
+		compact := &bytes.Buffer{}
+
+		if err := json.Compact(compact, data); err != nil {
+			return nil, errors.Annotate(err, "could not decode experiment")
+		}
+
+		data = compact.Bytes()
+	}
+
+	experiment := &Experiment{}
+
+	// Unknown fields are most likely misspelled, so they are rejected rather than ignored
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(experiment); err != nil {
+		return nil, errors.Annotate(err, "could not decode experiment")
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("could not decode experiment: unexpected data after the experiment")
+	}
+
+	return experiment, nil
+}
+
+// ConvertExperiment converts an experiment file from one format to another. The document is converted as is rather
+// than through Experiment, so the order of fields and the way numbers are written are kept: converting JSON to YAML
+// and back gives the same JSON, up to whitespace. Comments of YAML files are dropped.
+func ConvertExperiment(data []byte, from FORMAT, to FORMAT) ([]byte, error) {
+	var node *yaml.Node
+	var err error
+
+	switch from {
+	case FORMAT_JSON:
+		node, err = jsonToNode(data)
+	case FORMAT_YAML:
+		node, err = yamlToNode(data)
+	case FORMAT_TOML:
+		node, err = tomlToNode(data)
+	default:
+		err = errors.Errorf("unknown format: %s", from)
+	}
+
+	if err != nil {
+		return nil, errors.Annotatef(err, "could not read %s", from)
+	}
+
+	switch to {
+	case FORMAT_JSON:
+		buffer := &bytes.Buffer{}
+
+		if err := writeJSON(buffer, node); err != nil {
+			return nil, errors.Annotate(err, "could not write JSON")
+		}
+
+		indented := &bytes.Buffer{}
+
+		if err := json.Indent(indented, buffer.Bytes(), "", "  "); err != nil {
+			return nil, errors.Annotate(err, "could not write JSON")
+		}
+
+		return append(indented.Bytes(), '\n'), nil
+	case FORMAT_YAML:
+		buffer := &bytes.Buffer{}
+		encoder := yaml.NewEncoder(buffer)
+		encoder.SetIndent(2)
+
+		if err := encoder.Encode(node); err != nil {
+			return nil, errors.Annotate(err, "could not write YAML")
+		}
+
+		if err := encoder.Close(); err != nil {
+			return nil, errors.Annotate(err, "could not write YAML")
+		}
+
+		return buffer.Bytes(), nil
+	case FORMAT_TOML:
+		// TOML has no null, and maps decoded from it don't keep the order of their keys
+		return nil, errors.New("experiments can't be converted to TOML")
+	default:
+		return nil, errors.Errorf("unknown format: %s", to)
+	}
+}
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// jsonToNode reads a JSON document into a YAML node, keeping the order of object keys.
+func jsonToNode(data []byte) (*yaml.Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	node, err := readJSONNode(decoder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the document")
+	}
+
+	return node, nil
+}
+
+func readJSONNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+
+		if t == '{' {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := decoder.Token()
+
+				if err != nil {
+					return nil, err
+				}
+
+				node.Content = append(node.Content, scalarNode("!!str", key.(string)))
+			}
+
+			child, err := readJSONNode(decoder)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.Content = append(node.Content, child)
+		}
+
+		// Closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	case json.Number:
+		if strings.ContainsAny(string(t), ".eE") {
+			return scalarNode("!!float", string(t)), nil
+		}
+
+		return scalarNode("!!int", string(t)), nil
+	case string:
+		return scalarNode("!!str", t), nil
+	case bool:
+		return scalarNode("!!bool", strconv.FormatBool(t)), nil
+	default:
+		return scalarNode("!!null", "null"), nil
+	}
+}
+
+func yamlToNode(data []byte) (*yaml.Node, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	document := &yaml.Node{}
+
+	if err := decoder.Decode(document); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("empty document")
+		}
+
+		return nil, err
+	}
+
+	if err := decoder.Decode(&yaml.Node{}); err != io.EOF {
+		return nil, errors.New("expected a single document")
+	}
+
+	return document.Content[0], nil
+}
+
+// tomlToNode reads a TOML document into a YAML node. Keys are sorted since the order of tables is not kept.
+func tomlToNode(data []byte) (*yaml.Node, error) {
+	document := make(map[string]interface{})
+
+	if _, err := toml.Decode(string(data), &document); err != nil {
+		return nil, err
+	}
+
+	return tomlValueToNode(document)
+}
+
+func tomlValueToNode(value interface{}) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		keys := make([]string, 0, len(v))
+
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child, err := tomlValueToNode(v[key])
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.Content = append(node.Content, scalarNode("!!str", key), child)
+		}
+
+		return node, nil
+	case []map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+
+		for _, table := range v {
+			child, err := tomlValueToNode(table)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.Content = append(node.Content, child)
+		}
+
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+
+		for _, item := range v {
+			child, err := tomlValueToNode(item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.Content = append(node.Content, child)
+		}
+
+		return node, nil
+	case string:
+		return scalarNode("!!str", v), nil
+	case int64:
+		return scalarNode("!!int", strconv.FormatInt(v, 10)), nil
+	case float64:
+		return scalarNode("!!float", formatFloatLiteral(v)), nil
+	case bool:
+		return scalarNode("!!bool", strconv.FormatBool(v)), nil
+	case time.Time:
+		return scalarNode("!!str", v.Format(time.RFC3339Nano)), nil
+	default:
+		return nil, errors.Errorf("unsupported TOML value %v", value)
+	}
+}
+
+func scalarNode(tag string, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// writeJSON writes a YAML node as compact JSON. Numbers that are already valid JSON are written as they are.
+func writeJSON(buffer *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return writeJSON(buffer, node.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(buffer, node.Alias)
+	case yaml.MappingNode:
+		buffer.WriteByte('{')
+
+		for i := 0; i < len(node.Content); i += 2 {
+			key := node.Content[i]
+
+			if key.Kind != yaml.ScalarNode || key.ShortTag() == "!!merge" {
+				return errors.Errorf("line %d: only plain keys are supported", key.Line)
+			}
+
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+
+			writeJSONString(buffer, key.Value)
+			buffer.WriteByte(':')
+
+			if err := writeJSON(buffer, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+
+		buffer.WriteByte('}')
+		return nil
+	case yaml.SequenceNode:
+		buffer.WriteByte('[')
+
+		for i, child := range node.Content {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+
+			if err := writeJSON(buffer, child); err != nil {
+				return err
+			}
+		}
+
+		buffer.WriteByte(']')
+		return nil
+	}
+
+	switch node.ShortTag() {
+	case "!!str", "!!timestamp":
+		// Dates are left as written rather than read as times
+		writeJSONString(buffer, node.Value)
+	case "!!null":
+		buffer.WriteString("null")
+	case "!!bool":
+		var b bool
+
+		if err := node.Decode(&b); err != nil {
+			return err
+		}
+
+		buffer.WriteString(strconv.FormatBool(b))
+	case "!!int":
+		if isJSONNumber(node.Value) {
+			buffer.WriteString(node.Value)
+			return nil
+		}
+
+		// Such as 0x10 or 0o17
+		var i int64
+
+		if err := node.Decode(&i); err != nil {
+			return err
+		}
+
+		buffer.WriteString(strconv.FormatInt(i, 10))
+	case "!!float":
+		if isJSONNumber(node.Value) {
+			buffer.WriteString(node.Value)
+			return nil
+		}
+
+		var f float64
+
+		if err := node.Decode(&f); err != nil {
+			return err
+		}
+
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return errors.Errorf("line %d: %s can't be written as JSON", node.Line, node.Value)
+		}
+
+		buffer.WriteString(formatFloatLiteral(f))
+	default:
+		return errors.Errorf("line %d: unsupported value of type %s", node.Line, node.ShortTag())
+	}
+
+	return nil
+}
+
+func writeJSONString(buffer *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+
+	// Can't fail for a string
+	encoder.Encode(s)
+
+	// Encode ends with a newline
+	buffer.Truncate(buffer.Len() - 1)
+}
+
+func isJSONNumber(s string) bool {
+	return jsonNumber.MatchString(s)
+}
+
+// formatFloatLiteral writes a float so that it is read back as a float rather than an integer.
+func formatFloatLiteral(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+
+	return s
+}
@@ -0,0 +1,108 @@
+package experiment
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("testdata/experiments/*.json")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+
+		yamlData, err := ConvertExperiment(data, FORMAT_JSON, FORMAT_YAML)
+		assert.Nil(t, err, file)
+
+		jsonData, err := ConvertExperiment(yamlData, FORMAT_YAML, FORMAT_JSON)
+		assert.Nil(t, err, file)
+		assert.Equal(t, compactJSON(t, data), compactJSON(t, jsonData), file)
+
+		again, err := ConvertExperiment(jsonData, FORMAT_JSON, FORMAT_YAML)
+		assert.Nil(t, err, file)
+		assert.Equal(t, string(yamlData), string(again), file)
+	}
+}
+
+func TestLoadExperimentFileFormats(t *testing.T) {
+	expected, err := LoadExperimentFile("testdata/experiments/typed_values_1.json")
+	assert.Nil(t, err)
+
+	expectedData, err := json.Marshal(expected)
+	assert.Nil(t, err)
+
+	// JSON values are only equal once decoded since whitespace and the order of TOML keys are not kept
+	for _, file := range []string{"testdata/experiments/typed_values_1.yaml", "testdata/experiments/typed_values_1.toml"} {
+		experiment, err := LoadExperimentFile(file)
+		assert.Nil(t, err, file)
+
+		data, err := json.Marshal(experiment)
+		assert.Nil(t, err)
+		assert.JSONEq(t, string(expectedData), string(data), file)
+	}
+
+	_, err = LoadExperimentFile("testdata/experiments/typed_values_1.txt")
+	assert.NotNil(t, err)
+}
+
+func TestDecodeExperimentRejectsUnknownFields(t *testing.T) {
+	_, err := DecodeExperiment([]byte("name: a\nsalt: b\nvariableNames: [a]\naudiences: []\nenabeld: true\n"), FORMAT_YAML)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "enabeld")
+
+	_, err = DecodeExperiment([]byte("name = \"a\"\nenabeld = true\n"), FORMAT_TOML)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "enabeld")
+}
+
+func TestConvertScalars(t *testing.T) {
+	tests := []struct {
+		yaml     string
+		expected string
+	}{
+		{`{a: "1"}`, `{"a":"1"}`},
+		{`{a: 1}`, `{"a":1}`},
+		{`{a: 1.0}`, `{"a":1.0}`},
+		{`{a: 0x10}`, `{"a":16}`},
+		{`{a: 1e3}`, `{"a":1e3}`},
+		{`{a: .5}`, `{"a":0.5}`},
+		{`{a: yes}`, `{"a":"yes"}`},
+		{`{a: ~, b: null}`, `{"a":null,"b":null}`},
+		{`{a: 2020-01-02}`, `{"a":"2020-01-02"}`},
+		{`{a: "<&>"}`, `{"a":"<&>"}`},
+		{"a: &x [1, 2]\nb: *x\n", `{"a":[1,2],"b":[1,2]}`},
+		{`{b: 1, a: 2}`, `{"b":1,"a":2}`},
+	}
+
+	for _, test := range tests {
+		data, err := ConvertExperiment([]byte(test.yaml), FORMAT_YAML, FORMAT_JSON)
+		assert.Nil(t, err, test.yaml)
+		assert.Equal(t, test.expected, compactJSON(t, data), test.yaml)
+	}
+
+	for _, invalid := range []string{`{a: .inf}`, `{a: .nan}`, "a: 1\n---\nb: 2\n", "", `{[a]: 1}`} {
+		_, err := ConvertExperiment([]byte(invalid), FORMAT_YAML, FORMAT_JSON)
+		assert.NotNil(t, err, invalid)
+	}
+
+	// Strings that look like other types stay strings
+	data, err := ConvertExperiment([]byte(`{"a": "1", "b": "true", "c": "null", "d": 1.50}`), FORMAT_JSON, FORMAT_YAML)
+	assert.Nil(t, err)
+	assert.Equal(t, "a: \"1\"\nb: \"true\"\nc: \"null\"\nd: 1.50\n", string(data))
+
+	_, err = ConvertExperiment([]byte(`{"a": 1}`), FORMAT_JSON, FORMAT_TOML)
+	assert.NotNil(t, err)
+}
+
+func compactJSON(t *testing.T, data []byte) string {
+	buffer := &bytes.Buffer{}
+	assert.Nil(t, json.Compact(buffer, data))
+	return buffer.String()
+}
@@ -0,0 +1,41 @@
+package experiment
+
+import (
+	"github.com/sneakylocke/experiment/constraint"
+)
+
+// Get evaluates a variable and returns its value as a T. An int64, float64, bool or string is read from a value of
+// the matching type and any other T is decoded from a JSON value. The default is returned along with the error when
+// the variable is unknown, no audience matches or the value is not a T; test the error with errors.Is against
+// ErrUnknownVariable, ErrNoAudienceMatched and ErrTypeMismatch.
+func Get[T any](service Service, variableName string, userID string, context constraint.Context, defaultValue T) (T, error) {
+	result, err := service.GetVariable(variableName, userID, context)
+
+	if err != nil {
+		return defaultValue, err
+	}
+
+	var value T
+
+	if err := result.Value.decode(&value); err != nil {
+		return defaultValue, &Error{Kind: ErrTypeMismatch, Variable: variableName, Err: err}
+	}
+
+	return value, nil
+}
+
+func (service *service) GetInt(variableName string, userID string, context constraint.Context, defaultValue int64) (int64, error) {
+	return Get(service, variableName, userID, context, defaultValue)
+}
+
+func (service *service) GetFloat(variableName string, userID string, context constraint.Context, defaultValue float64) (float64, error) {
+	return Get(service, variableName, userID, context, defaultValue)
+}
+
+func (service *service) GetBool(variableName string, userID string, context constraint.Context, defaultValue bool) (bool, error) {
+	return Get(service, variableName, userID, context, defaultValue)
+}
+
+func (service *service) GetString(variableName string, userID string, context constraint.Context, defaultValue string) (string, error) {
+	return Get(service, variableName, userID, context, defaultValue)
+}
@@ -0,0 +1,146 @@
+package experiment
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTypedGetters(t *testing.T) {
+	builder := NewSimpleBuilder("experiment_1")
+	assert.Nil(t, builder.AddInts("int", []uint32{1}, []int64{7}))
+	experiment1, err := builder.Build()
+	assert.Nil(t, err)
+
+	builder = NewFactorialBuilder("experiment_2")
+	assert.Nil(t, builder.AddFloats("float", []uint32{1}, []float64{1.5}))
+	assert.Nil(t, builder.AddBools("bool", []uint32{1}, []bool{true}))
+	assert.Nil(t, builder.AddStrings("string", []uint32{1}, []string{"Buy now"}))
+	experiment2, err := builder.Build()
+	assert.Nil(t, err)
+
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment1, *experiment2}))
+
+	i, err := service.GetInt("int", "userID", nil, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), i)
+
+	f, err := service.GetFloat("float", "userID", nil, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, f)
+
+	b, err := service.GetBool("bool", "userID", nil, false)
+	assert.Nil(t, err)
+	assert.True(t, b)
+
+	s, err := service.GetString("string", "userID", nil, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "Buy now", s)
+
+	// A value of another type returns the default rather than a zero value
+	f, err = service.GetFloat("int", "userID", nil, -1)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	assert.Equal(t, -1.0, f)
+
+	i, err = service.GetInt("string", "userID", nil, -1)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	assert.Equal(t, int64(-1), i)
+
+	s, err = service.GetString("unknown", "userID", nil, "default")
+	assert.True(t, errors.Is(err, ErrUnknownVariable))
+	assert.Equal(t, "default", s)
+}
+
+func TestTypedGettersNoAudience(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/constraints_test_1.json")
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	// Values without a type can be read as any of the original types
+	i, err := service.GetInt("a", "userID", constraint.NewMapContext(map[string]interface{}{"country": "CA", "food": "cheese"}), -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), i)
+
+	_, err = service.GetString("a", "userID", constraint.NewMapContext(map[string]interface{}{"country": "CA", "food": "cheese"}), "")
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+
+	i, err = service.GetInt("a", "userID", constraint.NewMapContext(map[string]interface{}{"country": "ITALY", "food": "cheese"}), -1)
+	assert.True(t, errors.Is(err, ErrNoAudienceMatched))
+	assert.Equal(t, int64(-1), i)
+}
+
+func TestTypedGettersUntyped(t *testing.T) {
+	builder := NewFactorialBuilder("experiment")
+	assert.Nil(t, builder.AddFloats("float", []uint32{1}, []float64{1.5}))
+	assert.Nil(t, builder.AddInts("int", []uint32{1}, []int64{7}))
+	assert.Nil(t, builder.AddBools("bool", []uint32{1}, []bool{true}))
+	experiment, err := builder.Build()
+	assert.Nil(t, err)
+
+	// As written before values had a type
+	for _, valueGroup := range experiment.Audiences[0].ValueGroups {
+		valueGroup.ControlValue.Type = ""
+		valueGroup.WeightedValues[0].Value.Type = ""
+	}
+
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	f, err := service.GetFloat("float", "userID", nil, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, f)
+
+	// A legacy float is not read as an int
+	i, err := service.GetInt("float", "userID", nil, -1)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	assert.Equal(t, int64(-1), i)
+
+	i, err = service.GetInt("int", "userID", nil, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), i)
+
+	_, err = service.GetBool("int", "userID", nil, false)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+
+	b, err := service.GetBool("bool", "userID", nil, false)
+	assert.Nil(t, err)
+	assert.True(t, b)
+
+	_, err = service.GetFloat("bool", "userID", nil, -1)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+}
+
+func TestGetJSON(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/typed_values_1.json")
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	type checkoutConfig struct {
+		Steps   int  `json:"steps"`
+		Express bool `json:"express"`
+	}
+
+	config, err := Get(service, "checkout_config", "userID", nil, checkoutConfig{Steps: 5})
+	assert.Nil(t, err)
+	assert.True(t, config.Steps == 3 || (config.Steps == 1 && config.Express), "%+v", config)
+
+	raw, err := Get(service, "checkout_config", "userID", nil, json.RawMessage(nil))
+	assert.Nil(t, err)
+	assert.True(t, json.Valid(raw))
+
+	// A JSON value that does not decode into the type is a mismatch
+	steps, err := Get(service, "checkout_config", "userID", nil, []int{1})
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	assert.Equal(t, []int{1}, steps)
+
+	// Other values can only be read as their own type
+	_, err = Get(service, "button_text", "userID", nil, checkoutConfig{})
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+
+	text, err := Get(service, "button_text", "userID", nil, "")
+	assert.Nil(t, err)
+	assert.Contains(t, []string{"Buy now", "Add to cart"}, text)
+}
@@ -0,0 +1,166 @@
+package experiment
+
+import (
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment/validation"
+	"sort"
+)
+
+// STATUS is intended to act as an enum for the lifecycle of an Experiment.
+type STATUS = string
+
+const (
+	STATUS_DRAFT     = "DRAFT"     // Not started yet, nothing is served
+	STATUS_RUNNING   = "RUNNING"   // Users are randomized into values
+	STATUS_PAUSED    = "PAUSED"    // Temporarily not served
+	STATUS_CONCLUDED = "CONCLUDED" // The winning values are served to every user of the experiment
+)
+
+// transitions lists the statuses an experiment may move to from each status.
+var transitions = map[STATUS][]STATUS{
+	STATUS_DRAFT:     {STATUS_RUNNING},
+	STATUS_RUNNING:   {STATUS_PAUSED, STATUS_CONCLUDED},
+	STATUS_PAUSED:    {STATUS_RUNNING, STATUS_CONCLUDED},
+	STATUS_CONCLUDED: {},
+}
+
+// ValidateTransition returns an error if an experiment can't move from one status to another. Staying in the same
+// status is always allowed. Experiments without a status predate the lifecycle, so they may move to any status, but
+// an experiment can't go back to having no status.
+func ValidateTransition(from STATUS, to STATUS) error {
+	if from == to || from == "" {
+		return nil
+	}
+
+	allowed, ok := transitions[from]
+
+	if !ok {
+		return errors.Errorf("invalid status: %s", from)
+	}
+
+	if to == "" {
+		return errors.Errorf("experiment can't move from %s to no status", from)
+	}
+
+	for _, status := range allowed {
+		if status == to {
+			return nil
+		}
+	}
+
+	return errors.Errorf("experiment can't move from %s to %s", from, to)
+}
+
+// Transition moves the experiment to a status and enables it only if the status is served. Use Conclude to move to
+// STATUS_CONCLUDED since winners must be declared.
+func (e *Experiment) Transition(status STATUS) error {
+	if status == STATUS_CONCLUDED && len(e.Winners) == 0 {
+		return errors.New("use Conclude to declare winners when concluding an experiment")
+	}
+
+	if err := ValidateTransition(e.Status, status); err != nil {
+		return err
+	}
+
+	if _, ok := transitions[status]; !ok {
+		return errors.Errorf("invalid status: %s", status)
+	}
+
+	e.Status = status
+	e.Enabled = status == STATUS_RUNNING || status == STATUS_CONCLUDED
+
+	return nil
+}
+
+// Conclude declares the winning value of every variable, as an index into the weighted values of its value groups,
+// and moves the experiment to STATUS_CONCLUDED. The experiment is left unchanged if the winners are not valid.
+func (e *Experiment) Conclude(winners map[string]int) error {
+	if err := ValidateTransition(e.Status, STATUS_CONCLUDED); err != nil {
+		return err
+	}
+
+	concluded := *e
+	concluded.Winners = winners
+	concluded.Status = STATUS_CONCLUDED
+	concluded.Enabled = true
+
+	problems := &validation.Collector{}
+	concluded.validateLifecycle(problems)
+
+	if err := problems.Err(); err != nil {
+		return errors.Annotate(err, "could not conclude experiment")
+	}
+
+	*e = concluded
+
+	return nil
+}
+
+// validateLifecycle checks that the status is known, that Enabled matches it, and that winners are declared for
+// every variable of a concluded experiment and only then.
+func (e *Experiment) validateLifecycle(problems *validation.Collector) {
+	if e.Status == "" {
+		if len(e.Winners) > 0 {
+			problems.Addf("winners", "only concluded experiments can declare winners")
+		}
+
+		return
+	}
+
+	if _, ok := transitions[e.Status]; !ok {
+		problems.Addf("status", "invalid status: %s", e.Status)
+		return
+	}
+
+	served := e.Status == STATUS_RUNNING || e.Status == STATUS_CONCLUDED
+	if e.Enabled != served {
+		problems.Addf("enabled", "experiments with status %s must have enabled set to %t", e.Status, served)
+	}
+
+	if e.Status != STATUS_CONCLUDED {
+		if len(e.Winners) > 0 {
+			problems.Addf("winners", "only concluded experiments can declare winners")
+		}
+
+		return
+	}
+
+	variableNames := make(map[string]bool)
+	for _, name := range e.VariableNames {
+		variableNames[name] = true
+
+		if _, ok := e.Winners[name]; !ok {
+			problems.Addf("winners", "concluded experiment has no winner for variable '%s'", name)
+		}
+	}
+
+	names := make([]string, 0, len(e.Winners))
+	for name := range e.Winners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := validation.Field("winners", name)
+
+		if !variableNames[name] {
+			problems.Addf(path, "winner declared for unknown variable '%s'", name)
+			continue
+		}
+
+		winner := e.Winners[name]
+
+		// The winner must exist in every audience serving the variable
+		for _, audience := range e.Audiences {
+			valueGroup, ok := audience.ValueGroups[name]
+
+			if !ok {
+				continue
+			}
+
+			if winner < 0 || winner >= len(valueGroup.WeightedValues) {
+				problems.Addf(path, "winner %d of variable '%s' is out of range in audience '%s'", winner, name, audience.Name)
+			}
+		}
+	}
+}
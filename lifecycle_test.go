@@ -0,0 +1,159 @@
+package experiment
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateTransition(t *testing.T) {
+	allowed := [][2]STATUS{
+		{STATUS_DRAFT, STATUS_RUNNING},
+		{STATUS_RUNNING, STATUS_PAUSED},
+		{STATUS_PAUSED, STATUS_RUNNING},
+		{STATUS_RUNNING, STATUS_CONCLUDED},
+		{STATUS_PAUSED, STATUS_CONCLUDED},
+		{STATUS_RUNNING, STATUS_RUNNING},
+		{"", STATUS_CONCLUDED},
+		{"", ""},
+	}
+
+	for _, transition := range allowed {
+		assert.Nil(t, ValidateTransition(transition[0], transition[1]), "%v", transition)
+	}
+
+	denied := [][2]STATUS{
+		{STATUS_DRAFT, STATUS_PAUSED},
+		{STATUS_DRAFT, STATUS_CONCLUDED},
+		{STATUS_RUNNING, STATUS_DRAFT},
+		{STATUS_CONCLUDED, STATUS_RUNNING},
+		{STATUS_CONCLUDED, STATUS_PAUSED},
+		{"ARCHIVED", STATUS_RUNNING},
+		{STATUS_RUNNING, ""},
+		{STATUS_CONCLUDED, ""},
+	}
+
+	for _, transition := range denied {
+		assert.NotNil(t, ValidateTransition(transition[0], transition[1]), "%v", transition)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	builder := NewSimpleBuilder("checkout")
+	assert.Nil(t, builder.AddStrings("button_text", []uint32{1, 1}, []string{"Buy now", "Add to cart"}))
+	experiment, err := builder.Build()
+	assert.Nil(t, err)
+
+	experiment.Enabled = false
+	experiment.Status = STATUS_DRAFT
+	assert.Nil(t, experiment.Validate())
+
+	// Concluding requires winners and a running experiment
+	assert.NotNil(t, experiment.Transition(STATUS_CONCLUDED))
+	assert.NotNil(t, experiment.Conclude(map[string]int{"button_text": 1}))
+	assert.NotNil(t, experiment.Transition(STATUS_PAUSED))
+
+	assert.Nil(t, experiment.Transition(STATUS_RUNNING))
+	assert.True(t, experiment.Enabled)
+	assert.Nil(t, experiment.Validate())
+
+	assert.Nil(t, experiment.Transition(STATUS_PAUSED))
+	assert.False(t, experiment.Enabled)
+	assert.Nil(t, experiment.Validate())
+
+	// Invalid winners leave the experiment as it was
+	assert.NotNil(t, experiment.Conclude(map[string]int{"button_text": 2}))
+	assert.NotNil(t, experiment.Conclude(map[string]int{"button_text": 1, "other": 0}))
+	assert.NotNil(t, experiment.Conclude(map[string]int{}))
+	assert.Equal(t, STATUS_PAUSED, experiment.Status)
+	assert.Nil(t, experiment.Winners)
+
+	assert.Nil(t, experiment.Conclude(map[string]int{"button_text": 1}))
+	assert.Equal(t, STATUS_CONCLUDED, experiment.Status)
+	assert.True(t, experiment.Enabled)
+	assert.Nil(t, experiment.Validate())
+
+	assert.NotNil(t, experiment.Transition(STATUS_RUNNING))
+}
+
+func TestValidateLifecycle(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/typed_values_1.json")
+
+	experiment.Status = STATUS_PAUSED
+	assert.NotNil(t, experiment.Validate(), "paused experiments must be disabled")
+
+	experiment.Status = STATUS_RUNNING
+	assert.Nil(t, experiment.Validate())
+
+	experiment.Winners = map[string]int{"button_text": 0, "checkout_config": 1}
+	assert.NotNil(t, experiment.Validate(), "winners need a concluded experiment")
+
+	experiment.Status = STATUS_CONCLUDED
+	assert.Nil(t, experiment.Validate())
+
+	delete(experiment.Winners, "checkout_config")
+	assert.NotNil(t, experiment.Validate(), "every variable needs a winner")
+
+	experiment.Status = "ARCHIVED"
+	assert.NotNil(t, experiment.Validate())
+}
+
+func TestConcludedServesWinner(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/typed_values_1.json")
+	experiment.Status = STATUS_RUNNING
+
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	// The winner is served to everyone, even users outside of the exposure
+	experiment.Audiences[0].Exposure = 0
+	assert.Nil(t, experiment.Conclude(map[string]int{"button_text": 1, "checkout_config": 0}))
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	for i := 0; i < maxIterations; i++ {
+		text, err := service.GetString("button_text", makeUserID(i), nil, "")
+		assert.Nil(t, err)
+		assert.Equal(t, "Add to cart", text)
+	}
+
+	// A concluded experiment can't go back to running
+	experiment.Status = STATUS_RUNNING
+	experiment.Winners = nil
+	assert.NotNil(t, service.Reload([]Experiment{*experiment}))
+
+	text, err := service.GetString("button_text", "userID", nil, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "Add to cart", text)
+
+	// Nor lose its status
+	experiment.Status = ""
+	assert.NotNil(t, service.Reload([]Experiment{*experiment}))
+}
+
+func TestReloadValidatesLifecycle(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/typed_values_1.json")
+	experiment.Status = STATUS_PAUSED
+
+	// A paused experiment that is still enabled would keep being served
+	service := NewService()
+	assert.NotNil(t, service.Reload([]Experiment{*experiment}))
+
+	experiment.Status = STATUS_RUNNING
+	experiment.Winners = map[string]int{"button_text": 0}
+	assert.NotNil(t, service.Reload([]Experiment{*experiment}))
+
+	experiment.Winners = nil
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+}
+
+func TestPausedExperimentExplain(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/typed_values_1.json")
+	experiment.Status = STATUS_PAUSED
+	experiment.Enabled = false
+
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	explanation, err := service.Explain("button_text", "userID", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "experiment PAUSED", explanation.Audiences[0].Skipped)
+}
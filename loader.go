@@ -0,0 +1,53 @@
+package experiment
+
+import (
+	"fmt"
+	"github.com/juju/errors"
+	"io/ioutil"
+)
+
+// LoadExperimentFile reads an experiment from a JSON, YAML or TOML file, told apart by extension, and validates it.
+// Fields that are not part of an experiment are an error, see the schema package for a JSON Schema of the file.
+func LoadExperimentFile(path string) (*Experiment, error) {
+	format, err := FormatOf(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, errors.Annotatef(err, "could not read experiment file '%s'", path)
+	}
+
+	experiment, err := DecodeExperiment(data, format)
+
+	if err != nil {
+		return nil, errors.Annotatef(err, "could not decode experiment file '%s'", path)
+	}
+
+	if err := experiment.Validate(); err != nil {
+		// Wrapped with %w so that validation.Problems finds the problems of the experiment
+		return nil, fmt.Errorf("invalid experiment in file '%s': %w", path, err)
+	}
+
+	return experiment, nil
+}
+
+// LoadExperimentFiles loads every file with LoadExperimentFile, in order.
+func LoadExperimentFiles(paths []string) ([]Experiment, error) {
+	experiments := make([]Experiment, 0, len(paths))
+
+	for _, path := range paths {
+		experiment, err := LoadExperimentFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		experiments = append(experiments, *experiment)
+	}
+
+	return experiments, nil
+}
@@ -0,0 +1,344 @@
+package experiment
+
+// AllocationChange is how many users of an audience would get a different value of a variable between two versions
+// of an experiment. Values are told apart by their index in WeightedValues, and the control value counts as a value.
+type AllocationChange struct {
+	Audience  string
+	Variable  string
+	Fraction  float64 // Fraction of the users of the audience that would change value
+	Estimated bool    // True when users are hashed differently by the two versions, so assignment is assumed random
+}
+
+// allocationSegment is a run of positions, up to but not including end, that map to the weighted value at index
+// owner, or to the control value when owner is -1.
+type allocationSegment struct {
+	end   uint64
+	owner int
+}
+
+// DiffAllocations returns the fraction of users that would change value for every variable of every audience found
+// in both versions of an experiment, in the order of the audiences and variables of after. When the salts, the
+// allocation and, for weighted allocations, the sum of the weights are unchanged, users keep their position and the
+// fraction is exact, counting that weighted allocations take the exposure and the position of users from the same
+// hash. Otherwise users are reassigned as if at random and the fraction is the expected one. Concluded
+// experiments serve their winner to every user, which is exact too.
+func DiffAllocations(before *Experiment, after *Experiment) []AllocationChange {
+	var changes []AllocationChange
+
+	for _, afterAudience := range after.Audiences {
+		beforeAudience := findAudience(before, afterAudience.Name)
+
+		if beforeAudience == nil {
+			continue
+		}
+
+		for _, name := range after.VariableNames {
+			afterGroup, ok := afterAudience.ValueGroups[name]
+			if !ok {
+				continue
+			}
+
+			beforeGroup, ok := beforeAudience.ValueGroups[name]
+			if !ok {
+				continue
+			}
+
+			fraction, estimated := reassignedFraction(before.Salt+beforeGroup.Salt, beforeAudience.Exposure, beforeGroup, after.Salt+afterGroup.Salt, afterAudience.Exposure, afterGroup)
+
+			// Users of a concluded experiment all get the same value, whatever their hash
+			if before.Status == STATUS_CONCLUDED || after.Status == STATUS_CONCLUDED {
+				beforeShares := servedShares(before, beforeAudience, beforeGroup, name)
+				afterShares := servedShares(after, &afterAudience, afterGroup, name)
+				fraction, estimated = 1-matchingShare(beforeShares, afterShares), false
+			}
+
+			changes = append(changes, AllocationChange{
+				Audience:  afterAudience.Name,
+				Variable:  name,
+				Fraction:  fraction,
+				Estimated: estimated,
+			})
+		}
+	}
+
+	return changes
+}
+
+func findAudience(experiment *Experiment, name string) *Audience {
+	for i := range experiment.Audiences {
+		if experiment.Audiences[i].Name == name {
+			return &experiment.Audiences[i]
+		}
+	}
+
+	return nil
+}
+
+func reassignedFraction(beforeSalt string, beforeExposure float64, before *ValueGroup, afterSalt string, afterExposure float64, after *ValueGroup) (float64, bool) {
+	beforeSegments, beforeSpace := before.allocationSegments()
+	afterSegments, afterSpace := after.allocationSegments()
+
+	if beforeSalt != afterSalt || beforeSpace != afterSpace || before.allocation() != after.allocation() {
+		return 1 - matchingShare(exposedShares(beforeExposure, before), exposedShares(afterExposure, after)), true
+	}
+
+	classes := before.hashClasses(beforeSpace)
+	exposures, positions := float64(denominator/classes), float64(beforeSpace/classes)
+	beforeExposed, afterExposed := exposedPositions(beforeExposure), exposedPositions(afterExposure)
+	exposedInBoth := beforeExposed
+	if afterExposed < exposedInBoth {
+		exposedInBoth = afterExposed
+	}
+
+	var fraction float64
+
+	for class := uint64(0); class < classes; class++ {
+		// Users exposed in only one version move between the control value and the value of their position there
+		fraction += float64(residues(exposedInBoth, afterExposed, class, classes)) / exposures * float64(servedPositions(afterSegments, class, classes)) / positions
+		fraction += float64(residues(exposedInBoth, beforeExposed, class, classes)) / exposures * float64(servedPositions(beforeSegments, class, classes)) / positions
+		fraction += float64(residues(0, exposedInBoth, class, classes)) / exposures * float64(movedPositions(beforeSegments, afterSegments, class, classes)) / positions
+	}
+
+	return fraction / float64(classes), false
+}
+
+func (valueGroup *ValueGroup) allocation() ALLOCATION {
+	if valueGroup.Allocation == "" {
+		return ALLOCATION_WEIGHTED
+	}
+
+	return valueGroup.Allocation
+}
+
+// allocationSegments returns the positions users are hashed into along with the value each position maps to.
+func (valueGroup *ValueGroup) allocationSegments() ([]allocationSegment, uint64) {
+	var segments []allocationSegment
+
+	if valueGroup.Allocation == ALLOCATION_BUCKETS {
+		for bucket, owner := range valueGroup.bucketOwners() {
+			if n := len(segments); n > 0 && segments[n-1].owner == owner {
+				segments[n-1].end++
+			} else {
+				segments = append(segments, allocationSegment{end: uint64(bucket) + 1, owner: owner})
+			}
+		}
+
+		return segments, BucketCount
+	}
+
+	var sum uint64
+	for i, value := range valueGroup.WeightedValues {
+		if value.Weight > 0 {
+			sum += uint64(value.Weight)
+			segments = append(segments, allocationSegment{end: sum, owner: i})
+		}
+	}
+
+	// Without weights everyone gets the control value
+	if sum == 0 {
+		return []allocationSegment{{end: 1, owner: -1}}, 1
+	}
+
+	return segments, sum
+}
+
+// hashClasses returns how many classes users are split into by the residue of their hash, such that within a class
+// their exposure and their position are independent. Weighted allocations take both from the same hash, modulo
+// denominator and modulo the space, so the classes are the residues modulo the greatest common divisor of the two.
+// Buckets are hashed apart from the exposure, so there is a single class.
+func (valueGroup *ValueGroup) hashClasses(space uint64) uint64 {
+	if valueGroup.Allocation == ALLOCATION_BUCKETS {
+		return 1
+	}
+
+	a, b := uint64(denominator), space
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+// residues returns how many positions in [start, end) are in class of classes.
+func residues(start uint64, end uint64, class uint64, classes uint64) uint64 {
+	count := func(end uint64) uint64 {
+		if end <= class {
+			return 0
+		}
+
+		return (end-class-1)/classes + 1
+	}
+
+	if end <= start {
+		return 0
+	}
+
+	return count(end) - count(start)
+}
+
+// servedPositions returns how many positions in class map to a weighted value rather than to the control value.
+func servedPositions(segments []allocationSegment, class uint64, classes uint64) uint64 {
+	var served, start uint64
+
+	for _, segment := range segments {
+		if segment.owner >= 0 {
+			served += residues(start, segment.end, class, classes)
+		}
+
+		start = segment.end
+	}
+
+	return served
+}
+
+// exposedShares returns the share of the users of an audience that get the control value, at index 0, and every
+// weighted value of a value group.
+func exposedShares(exposure float64, valueGroup *ValueGroup) []float64 {
+	segments, space := valueGroup.allocationSegments()
+	classes := valueGroup.hashClasses(space)
+	exposures, positions := float64(denominator/classes), float64(space/classes)
+	exposed := exposedPositions(exposure)
+	shares := make([]float64, len(valueGroup.WeightedValues)+1)
+
+	for class := uint64(0); class < classes; class++ {
+		exposedShare := float64(residues(0, exposed, class, classes)) / exposures / float64(classes)
+		shares[0] += 1/float64(classes) - exposedShare
+
+		var start uint64
+		for _, segment := range segments {
+			shares[segment.owner+1] += exposedShare * float64(residues(start, segment.end, class, classes)) / positions
+			start = segment.end
+		}
+	}
+
+	return shares
+}
+
+// servedShares returns the share of the users of an audience that get the control value, at index 0, and every
+// weighted value of a variable.
+func servedShares(experiment *Experiment, audience *Audience, valueGroup *ValueGroup, variable string) []float64 {
+	if experiment.Status == STATUS_CONCLUDED {
+		shares := make([]float64, len(valueGroup.WeightedValues)+1)
+
+		if winner, ok := experiment.Winners[variable]; ok && winner >= 0 && winner < len(valueGroup.WeightedValues) {
+			shares[winner+1] = 1
+		}
+
+		return shares
+	}
+
+	return exposedShares(audience.Exposure, valueGroup)
+}
+
+// matchingShare is the chance that two independent draws from the shares give the same value.
+func matchingShare(before []float64, after []float64) float64 {
+	var share float64
+
+	for i := 0; i < len(before) && i < len(after); i++ {
+		share += before[i] * after[i]
+	}
+
+	return share
+}
+
+// movedPositions returns how many positions in class map to a different value in both lists of segments.
+func movedPositions(before []allocationSegment, after []allocationSegment, class uint64, classes uint64) uint64 {
+	var moved, start uint64
+	i, j := 0, 0
+
+	for i < len(before) && j < len(after) {
+		end := before[i].end
+		if after[j].end < end {
+			end = after[j].end
+		}
+
+		if before[i].owner != after[j].owner {
+			moved += residues(start, end, class, classes)
+		}
+
+		start = end
+
+		if before[i].end == end {
+			i++
+		}
+
+		if after[j].end == end {
+			j++
+		}
+	}
+
+	return moved
+}
+
+// exposedPositions returns how many of the denominator positions the service hashes users into for the exposure get
+// a weighted value rather than the control value, those with position/denominator <= exposure.
+func exposedPositions(exposure float64) uint64 {
+	if exposure < 0 {
+		return 0
+	}
+
+	if !(exposure < 1) {
+		return denominator
+	}
+
+	// Positions up to the truncated product, corrected for the rounding of the product and of the division
+	positions := uint64(exposure*denominator) + 1
+
+	if float64(positions-1)/denominator > exposure {
+		positions--
+	} else if positions < denominator && float64(positions)/denominator <= exposure {
+		positions++
+	}
+
+	return positions
+}
+
+// stableAllocation tells if users only move out of values that shrink and into values that grow between two versions
+// of a value group with the same salt. Users moving to or from the control value count as moving between values.
+func stableAllocation(before *ValueGroup, after *ValueGroup) bool {
+	beforeSegments, beforeSpace := before.allocationSegments()
+	afterSegments, afterSpace := after.allocationSegments()
+
+	if beforeSpace != afterSpace || before.allocation() != after.allocation() {
+		return false
+	}
+
+	// Unowned buckets are not a value, so values that grow may take them
+	left := func(index int) bool {
+		return index < 0 || index >= len(after.WeightedValues) || after.WeightedValues[index].Weight < before.WeightedValues[index].Weight
+	}
+
+	grew := func(index int) bool {
+		return index >= 0 && (index >= len(before.WeightedValues) || after.WeightedValues[index].Weight > before.WeightedValues[index].Weight)
+	}
+
+	i, j := 0, 0
+
+	for i < len(beforeSegments) && j < len(afterSegments) {
+		beforeOwner, afterOwner := beforeSegments[i].owner, afterSegments[j].owner
+
+		if beforeOwner != afterOwner && !(left(beforeOwner) && grew(afterOwner)) {
+			return false
+		}
+
+		end := beforeSegments[i].end
+		if afterSegments[j].end < end {
+			end = afterSegments[j].end
+		}
+
+		if beforeSegments[i].end == end {
+			i++
+		}
+
+		if afterSegments[j].end == end {
+			j++
+		}
+	}
+
+	return true
+}
+
+// exposedShare returns the share of users getting a weighted value rather than the control value for an exposure.
+func exposedShare(exposure float64) float64 {
+	return float64(exposedPositions(exposure)) / denominator
+}
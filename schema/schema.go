@@ -0,0 +1,173 @@
+// Package schema generates the JSON Schema of experiment files from the Go structs they are decoded into, so that
+// editors can point out unknown fields and invalid operators as they are typed.
+package schema
+
+//go:generate go run ../cmd/experimentctl schema -out experiment.schema.json
+
+import (
+	"encoding/json"
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment"
+	"github.com/sneakylocke/experiment/constraint"
+	"reflect"
+	"strings"
+)
+
+// Draft is the JSON Schema dialect of the generated schema.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// required lists the fields every file must set, by type. Fields are otherwise optional since their zero value is
+// meaningful, and Experiment.Validate reports what is missing in more detail.
+var required = map[reflect.Type][]string{
+	reflect.TypeOf(experiment.Experiment{}):    {"name", "salt", "variableNames", "audiences"},
+	reflect.TypeOf(experiment.Audience{}):      {"name", "valueGroups"},
+	reflect.TypeOf(experiment.ValueGroup{}):    {"name", "salt", "weightedValues"},
+	reflect.TypeOf(experiment.WeightedValue{}): {"value", "weight"},
+	reflect.TypeOf(experiment.BucketRange{}):   {"start", "end"},
+	reflect.TypeOf(constraint.Constraint{}):    {"key", "operator"},
+}
+
+// keywords holds what can't be told from the Go type of a field, by type and JSON name. The enum types are aliases of
+// string so they look like any other string to reflection.
+var keywords = map[reflect.Type]map[string]map[string]interface{}{
+	reflect.TypeOf(experiment.Experiment{}): {
+		"status": {"enum": []string{experiment.STATUS_DRAFT, experiment.STATUS_RUNNING, experiment.STATUS_PAUSED, experiment.STATUS_CONCLUDED}},
+	},
+	reflect.TypeOf(experiment.Audience{}): {
+		"exposure": {"minimum": 0, "maximum": 1},
+	},
+	reflect.TypeOf(experiment.ValueGroup{}): {
+		"allocation": {"enum": []string{experiment.ALLOCATION_WEIGHTED, experiment.ALLOCATION_BUCKETS}},
+	},
+	reflect.TypeOf(experiment.BucketRange{}): {
+		"start": {"maximum": experiment.BucketCount - 1},
+		"end":   {"minimum": 1, "maximum": experiment.BucketCount},
+	},
+	reflect.TypeOf(experiment.Value{}): {
+		"type": {"enum": []string{experiment.VALUE_TYPE_FLOAT, experiment.VALUE_TYPE_INT, experiment.VALUE_TYPE_BOOL, experiment.VALUE_TYPE_STRING, experiment.VALUE_TYPE_JSON}},
+	},
+	reflect.TypeOf(constraint.Constraint{}): {
+		"key":      {"minLength": 1},
+		"operator": {"enum": constraint.BuiltinOperators()},
+		"missing":  {"enum": []string{constraint.MISSING_FAIL, constraint.MISSING_PASS, constraint.MISSING_ERROR}},
+	},
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// Generate returns the schema of an experiment file, indented. Every object rejects properties it does not define,
+// like LoadExperimentFile does. Operators registered with constraint.RegisterOperator are not part of the schema.
+func Generate() ([]byte, error) {
+	g := &generator{definitions: make(map[string]interface{})}
+
+	root := map[string]interface{}{
+		"$schema": Draft,
+		"title":   "Experiment",
+		"$ref":    g.reference(reflect.TypeOf(experiment.Experiment{})),
+		"$defs":   g.definitions,
+	}
+
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	data, err := json.MarshalIndent(root, "", "  ")
+
+	if err != nil {
+		return nil, errors.Annotate(err, "could not encode schema")
+	}
+
+	return append(data, '\n'), nil
+}
+
+type generator struct {
+	definitions map[string]interface{}
+	err         error
+}
+
+// reference returns a reference to the definition of a struct, defining it the first time.
+func (g *generator) reference(t reflect.Type) string {
+	if _, ok := g.definitions[t.Name()]; !ok {
+		// Defined before its fields so recursive types terminate
+		g.definitions[t.Name()] = nil
+		g.definitions[t.Name()] = g.object(t)
+	}
+
+	return "#/$defs/" + t.Name()
+}
+
+func (g *generator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schema(field.Type)
+
+		for keyword, value := range keywords[t][name] {
+			property[keyword] = value
+		}
+
+		properties[name] = property
+	}
+
+	object := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+
+	if fields := required[t]; len(fields) > 0 {
+		object["required"] = fields
+	}
+
+	return object
+}
+
+func (g *generator) schema(t reflect.Type) map[string]interface{} {
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Struct:
+		return map[string]interface{}{"$ref": g.reference(t)}
+	case reflect.Slice, reflect.Array:
+		// Nil slices and maps are encoded as null
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Interface:
+		// Any JSON value, such as the Value of a constraint
+		return map[string]interface{}{}
+	default:
+		g.err = errors.Errorf("no schema for fields of type %s", t)
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,206 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchemaUpToDate(t *testing.T) {
+	generated, err := Generate()
+	assert.Nil(t, err)
+
+	shipped, err := ioutil.ReadFile("experiment.schema.json")
+	assert.Nil(t, err)
+
+	assert.Equal(t, string(shipped), string(generated), "experiment.schema.json is out of date, run go generate ./schema")
+}
+
+func TestExperimentFilesMatchSchema(t *testing.T) {
+	schema := loadSchema(t)
+	files, err := filepath.Glob("../testdata/experiments/*.json")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+
+		var document interface{}
+		assert.Nil(t, json.Unmarshal(data, &document), file)
+		problems := check(schema, schema, document, "")
+
+		switch name := filepath.Base(file); {
+		case name == "invalid_unknown_field.json":
+			assert.NotEmpty(t, problems, file)
+		case !strings.HasPrefix(name, "invalid_"):
+			assert.Empty(t, problems, file)
+		}
+	}
+}
+
+func TestSchemaCatchesMistakes(t *testing.T) {
+	schema := loadSchema(t)
+	data, err := ioutil.ReadFile("../testdata/experiments/constraints_valid_1.json")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		old, new string
+		problem  string
+	}{
+		{`"weight"`, `"weigth"`, "unknown property 'weigth'"},
+		{`"operator":"NEQ"`, `"operator":"NEQ "`, "is not one of"},
+		{`"exposure":1`, `"exposure":1.5`, "is more than"},
+		{`"salt"`, `"pepper"`, "unknown property 'pepper'"},
+	}
+
+	for _, test := range tests {
+		mistake := strings.Replace(string(data), test.old, test.new, 1)
+		assert.NotEqual(t, string(data), mistake, test.old)
+
+		var document interface{}
+		assert.Nil(t, json.Unmarshal([]byte(mistake), &document))
+
+		problems := check(schema, schema, document, "")
+		assert.NotEmpty(t, problems, test.new)
+		assert.Contains(t, strings.Join(problems, "\n"), test.problem)
+	}
+}
+
+func loadSchema(t *testing.T) map[string]interface{} {
+	data, err := Generate()
+	assert.Nil(t, err)
+
+	var schema map[string]interface{}
+	assert.Nil(t, json.Unmarshal(data, &schema))
+
+	return schema
+}
+
+// check validates a document against the subset of JSON Schema that Generate uses.
+func check(root map[string]interface{}, schema map[string]interface{}, document interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		definition := root["$defs"].(map[string]interface{})[strings.TrimPrefix(ref, "#/$defs/")]
+		return check(root, definition.(map[string]interface{}), document, path)
+	}
+
+	var problems []string
+
+	if types, ok := schema["type"]; ok && !matchesType(types, document) {
+		return append(problems, fmt.Sprintf("%s: %v is not of type %v", path, document, types))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+
+		for _, value := range enum {
+			found = found || value == document
+		}
+
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %q is not one of %v", path, document, enum))
+		}
+	}
+
+	if n, ok := document.(float64); ok {
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			problems = append(problems, fmt.Sprintf("%s: %v is less than %v", path, n, minimum))
+		}
+
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			problems = append(problems, fmt.Sprintf("%s: %v is more than %v", path, n, maximum))
+		}
+	}
+
+	if s, ok := document.(string); ok {
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len(s)) < minLength {
+			problems = append(problems, fmt.Sprintf("%s: %q is too short", path, s))
+		}
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		list, _ := document.([]interface{})
+
+		for i, item := range list {
+			problems = append(problems, check(root, items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	if object, ok := document.(map[string]interface{}); ok {
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		for _, name := range stringsOf(schema["required"]) {
+			if _, ok := object[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing property '%s'", path, name))
+			}
+		}
+
+		for name, value := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, check(root, property, value, path+"."+name)...)
+				continue
+			}
+
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					problems = append(problems, fmt.Sprintf("%s: unknown property '%s'", path, name))
+				}
+			case map[string]interface{}:
+				problems = append(problems, check(root, additional, value, path+"."+name)...)
+			}
+		}
+	}
+
+	return problems
+}
+
+func matchesType(types interface{}, document interface{}) bool {
+	for _, name := range append(stringsOf(types), fmt.Sprint(types)) {
+		switch v := document.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == float64(int64(v))) {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func stringsOf(value interface{}) []string {
+	list, _ := value.([]interface{})
+	names := make([]string, 0, len(list))
+
+	for _, item := range list {
+		if name, ok := item.(string); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,238 @@
+package experiment
+
+import (
+	"fmt"
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment/constraint"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentVersionSeparator = "@"
+)
+
+// Segment is a named, versioned group of constraints. Audiences reference segments by name instead of repeating the
+// same constraints in every experiment. A segment may also reference other segments, all of which must match.
+type Segment struct {
+	Name        string                  `json:"name"`
+	Version     int                     `json:"version"`
+	Constraints []constraint.Constraint `json:"constraints"`
+	Segments    []string                `json:"segments,omitempty"`
+}
+
+// segmentConstraint is a constraint along with the reference of the segment it was defined in.
+type segmentConstraint struct {
+	segment    string
+	constraint constraint.Constraint
+}
+
+func (s *Segment) Validate() error {
+	if s.Name == "" {
+		return errors.New("segments should have a name")
+	}
+
+	if strings.Contains(s.Name, segmentVersionSeparator) {
+		return errors.Errorf("segment name '%s' must not contain '%s'", s.Name, segmentVersionSeparator)
+	}
+
+	if s.Version < 0 {
+		return errors.Errorf("segment '%s' has a negative version", s.Name)
+	}
+
+	if len(s.Constraints) == 0 && len(s.Segments) == 0 {
+		return errors.Errorf("segment '%s' should have constraints or segments", s.Name)
+	}
+
+	for i := range s.Constraints {
+		if err := s.Constraints[i].Validate(); err != nil {
+			return errors.Annotatef(err, "invalid constraint in segment '%s'", s.Name)
+		}
+	}
+
+	for _, reference := range s.Segments {
+		if _, _, err := parseSegmentReference(reference); err != nil {
+			return errors.Annotatef(err, "invalid reference in segment '%s'", s.Name)
+		}
+	}
+
+	return nil
+}
+
+// reference returns the fully qualified name of the segment, e.g. "us_ios_premium@2".
+func (s *Segment) reference() string {
+	return fmt.Sprintf("%s%s%d", s.Name, segmentVersionSeparator, s.Version)
+}
+
+// SegmentRegistry holds every known version of every segment.
+type SegmentRegistry struct {
+	segments map[string][]*Segment
+}
+
+func NewSegmentRegistry() *SegmentRegistry {
+	registry := &SegmentRegistry{}
+	registry.segments = make(map[string][]*Segment)
+
+	return registry
+}
+
+// Register adds a segment. A name may be registered several times as long as each version is different.
+func (r *SegmentRegistry) Register(segment Segment) error {
+	if err := segment.Validate(); err != nil {
+		return err
+	}
+
+	for _, existing := range r.segments[segment.Name] {
+		if existing.Version == segment.Version {
+			return errors.Errorf("segment '%s' is already registered", segment.reference())
+		}
+	}
+
+	versions := append(r.segments[segment.Name], &segment)
+
+	// Keep versions sorted so the latest is always last
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	r.segments[segment.Name] = versions
+
+	return nil
+}
+
+// Get finds a segment by reference. A reference is either a name, which returns the latest version, or a name and
+// version such as "us_ios_premium@2".
+func (r *SegmentRegistry) Get(reference string) (*Segment, error) {
+	name, version, err := parseSegmentReference(reference)
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions, ok := r.segments[name]
+
+	if !ok {
+		return nil, errors.Errorf("unknown segment '%s'", reference)
+	}
+
+	if version < 0 {
+		return versions[len(versions)-1], nil
+	}
+
+	for _, segment := range versions {
+		if segment.Version == version {
+			return segment, nil
+		}
+	}
+
+	return nil, errors.Errorf("unknown segment version '%s'", reference)
+}
+
+// Validate checks that every segment only references segments that exist and that no segment references itself,
+// directly or through others.
+func (r *SegmentRegistry) Validate() error {
+	for _, versions := range r.segments {
+		for _, segment := range versions {
+			if _, err := r.resolve(segment.reference()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateExperiment checks that every segment referenced by the experiment's audiences can be resolved.
+func (r *SegmentRegistry) ValidateExperiment(experiment *Experiment) error {
+	for _, audience := range experiment.Audiences {
+		if _, err := r.resolveAudience(&audience); err != nil {
+			return errors.Annotatef(err, "experiment '%s'", experiment.Name)
+		}
+	}
+
+	return nil
+}
+
+// resolveAudience returns the audience's own constraints followed by the constraints of every segment it references.
+func (r *SegmentRegistry) resolveAudience(audience *Audience) ([]segmentConstraint, error) {
+	constraints := make([]segmentConstraint, 0, len(audience.Constraints))
+
+	for _, c := range audience.Constraints {
+		constraints = append(constraints, segmentConstraint{constraint: c})
+	}
+
+	for _, reference := range audience.Segments {
+		segmentConstraints, err := r.resolve(reference)
+
+		if err != nil {
+			return nil, errors.Annotatef(err, "audience '%s'", audience.Name)
+		}
+
+		constraints = append(constraints, segmentConstraints...)
+	}
+
+	return constraints, nil
+}
+
+// resolve flattens a segment and the segments it references into a single list of constraints.
+func (r *SegmentRegistry) resolve(reference string) ([]segmentConstraint, error) {
+	return r.resolveVisiting(reference, make(map[string]bool), nil)
+}
+
+func (r *SegmentRegistry) resolveVisiting(reference string, visiting map[string]bool, path []string) ([]segmentConstraint, error) {
+	segment, err := r.Get(reference)
+
+	if err != nil {
+		return nil, err
+	}
+
+	qualified := segment.reference()
+	path = append(path, qualified)
+
+	if visiting[qualified] {
+		return nil, errors.Errorf("cyclic segment reference: %s", strings.Join(path, " -> "))
+	}
+
+	visiting[qualified] = true
+	defer delete(visiting, qualified)
+
+	constraints := make([]segmentConstraint, 0, len(segment.Constraints))
+
+	for _, c := range segment.Constraints {
+		constraints = append(constraints, segmentConstraint{segment: qualified, constraint: c})
+	}
+
+	for _, nested := range segment.Segments {
+		nestedConstraints, err := r.resolveVisiting(nested, visiting, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		constraints = append(constraints, nestedConstraints...)
+	}
+
+	return constraints, nil
+}
+
+// parseSegmentReference splits "name@version" into its parts. The version is -1 when the reference has none.
+func parseSegmentReference(reference string) (string, int, error) {
+	parts := strings.Split(reference, segmentVersionSeparator)
+
+	if parts[0] == "" || len(parts) > 2 {
+		return "", 0, errors.Errorf("invalid segment reference '%s'", reference)
+	}
+
+	if len(parts) == 1 {
+		return parts[0], -1, nil
+	}
+
+	version, err := strconv.Atoi(parts[1])
+
+	if err != nil || version < 0 {
+		return "", 0, errors.Errorf("invalid segment version in reference '%s'", reference)
+	}
+
+	return parts[0], version, nil
+}
@@ -0,0 +1,161 @@
+package experiment
+
+import (
+	"encoding/json"
+	"github.com/sneakylocke/experiment/constraint"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSegmentRegistryVersions(t *testing.T) {
+	registry := loadSegmentRegistry(t, "testdata/segments/segments_1.json")
+
+	latest, err := registry.Get("us_ios_premium")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, latest.Version)
+
+	first, err := registry.Get("us_ios_premium@1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first.Version)
+
+	_, err = registry.Get("us_ios_premium@3")
+	assert.NotNil(t, err)
+
+	_, err = registry.Get("unknown")
+	assert.NotNil(t, err)
+
+	// The same version can't be registered twice
+	assert.NotNil(t, registry.Register(*first))
+
+	assert.Nil(t, registry.Validate())
+}
+
+func TestSegmentRegistryInvalid(t *testing.T) {
+	registry := NewSegmentRegistry()
+
+	assert.NotNil(t, registry.Register(Segment{Name: "", Constraints: []constraint.Constraint{*constraint.NewConstraint("a", constraint.OPERATOR_EQ, 1)}}))
+	assert.NotNil(t, registry.Register(Segment{Name: "a@1", Constraints: []constraint.Constraint{*constraint.NewConstraint("a", constraint.OPERATOR_EQ, 1)}}))
+	assert.NotNil(t, registry.Register(Segment{Name: "empty"}))
+	assert.NotNil(t, registry.Register(Segment{Name: "bad_constraint", Constraints: []constraint.Constraint{*constraint.NewConstraint("a", "BAD", 1)}}))
+	assert.NotNil(t, registry.Register(Segment{Name: "bad_reference", Segments: []string{"a@b"}}))
+}
+
+func TestSegmentRegistryCycles(t *testing.T) {
+	registry := NewSegmentRegistry()
+
+	assert.Nil(t, registry.Register(Segment{Name: "a", Segments: []string{"b"}}))
+	assert.Nil(t, registry.Register(Segment{Name: "b", Segments: []string{"c"}}))
+	assert.Nil(t, registry.Register(Segment{Name: "c", Segments: []string{"a"}}))
+
+	err := registry.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cyclic segment reference")
+
+	// A segment that references one that does not exist
+	registry = NewSegmentRegistry()
+	assert.Nil(t, registry.Register(Segment{Name: "a", Segments: []string{"missing"}}))
+	assert.NotNil(t, registry.Validate())
+
+	// Referencing the same segment twice is not a cycle
+	registry = NewSegmentRegistry()
+	assert.Nil(t, registry.Register(Segment{Name: "leaf", Constraints: []constraint.Constraint{*constraint.NewConstraint("a", constraint.OPERATOR_EQ, 1)}}))
+	assert.Nil(t, registry.Register(Segment{Name: "left", Segments: []string{"leaf"}}))
+	assert.Nil(t, registry.Register(Segment{Name: "right", Segments: []string{"leaf"}}))
+	assert.Nil(t, registry.Register(Segment{Name: "both", Segments: []string{"left", "right"}}))
+	assert.Nil(t, registry.Validate())
+}
+
+func TestSegmentAudiences(t *testing.T) {
+	service := loadSegmentService(t)
+
+	// Matches the latest version of the segment
+	context := constraint.NewMapContext(map[string]interface{}{"country": "US", "os": "ios", "is_premium": true})
+	result, err := service.GetVariable("a", "userID", context)
+	assert.Nil(t, err)
+	assert.Equal(t, "premium", result.Audience.Name)
+	assert.Equal(t, []string{"us_ios_premium"}, result.Segments)
+
+	// Only the pinned first version matches without premium
+	context = constraint.NewMapContext(map[string]interface{}{"country": "US", "os": "ios", "is_premium": false})
+	result, err = service.GetVariable("a", "userID", context)
+	assert.Nil(t, err)
+	assert.Equal(t, "ios_v1", result.Audience.Name)
+
+	// Falls through to the audience without segments
+	context = constraint.NewMapContext(map[string]interface{}{"country": "CA", "os": "ios", "is_premium": true})
+	result, err = service.GetVariable("a", "userID", context)
+	assert.Nil(t, err)
+	assert.Equal(t, "everyone", result.Audience.Name)
+}
+
+func TestSegmentExplain(t *testing.T) {
+	service := loadSegmentService(t)
+
+	context := constraint.NewMapContext(map[string]interface{}{"country": "US", "os": "ios", "is_premium": false})
+	explanation, err := service.Explain("a", "userID", context)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"us_ios_premium@1"}, explanation.MatchedSegments())
+
+	// Every constraint of the first audience is reported along with its segment
+	assert.Equal(t, 2, len(explanation.Audiences))
+	assert.False(t, explanation.Audiences[0].Matched)
+	assert.Equal(t, 3, len(explanation.Audiences[0].Constraints))
+	assert.Equal(t, "us_ios_premium@2", explanation.Audiences[0].Constraints[1].Segment)
+	assert.False(t, explanation.Audiences[0].Constraints[1].Satisfied)
+	assert.Equal(t, "us@1", explanation.Audiences[0].Constraints[2].Segment)
+	assert.True(t, explanation.Audiences[1].Matched)
+
+	assert.Contains(t, explanation.String(), "[segment us@1] country EQ US: true")
+}
+
+func TestSegmentReloadUnknown(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/segments_test_1.json")
+
+	// Without segments the references can't be resolved
+	service := NewService()
+	assert.NotNil(t, service.Reload([]Experiment{*experiment}))
+
+	// Segments that contain a cycle are rejected and the previous segments are kept
+	service = loadSegmentService(t)
+	err := service.ReloadSegments([]Segment{{Name: "a", Segments: []string{"a"}}})
+	assert.NotNil(t, err)
+
+	// Removing a segment that is still referenced fails as well
+	err = service.ReloadSegments([]Segment{{Name: "us", Constraints: []constraint.Constraint{*constraint.NewConstraint("country", constraint.OPERATOR_EQ, "US")}}})
+	assert.NotNil(t, err)
+
+	_, err = service.GetVariable("a", "userID", constraint.NewMapContext(map[string]interface{}{"country": "US", "os": "ios", "is_premium": true}))
+	assert.Nil(t, err)
+}
+
+func loadSegmentService(t *testing.T) *service {
+	data, err := ioutil.ReadFile("testdata/segments/segments_1.json")
+	assert.Nil(t, err)
+
+	var segments []Segment
+	assert.Nil(t, json.Unmarshal(data, &segments))
+
+	service := NewService()
+	assert.Nil(t, service.ReloadSegments(segments))
+
+	experiment := loadExperiment(t, "testdata/experiments/segments_test_1.json")
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	return service
+}
+
+func loadSegmentRegistry(t *testing.T, file string) *SegmentRegistry {
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+
+	var segments []Segment
+	assert.Nil(t, json.Unmarshal(data, &segments))
+
+	registry := NewSegmentRegistry()
+	for _, segment := range segments {
+		assert.Nil(t, registry.Register(segment))
+	}
+
+	return registry
+}
@@ -1,68 +1,218 @@
 package experiment
 
 import (
+	"fmt"
 	"github.com/juju/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/sneakylocke/experiment/constraint"
 	"hash/fnv"
 )
 
-const (
-	denominator = 10000
-)
+const denominator = 10000
 
 type GetVariableResult struct {
 	Experiment *Experiment
 	Audience   *Audience
 	Value      *Value
+	Segments   []string // References of the segments the audience matched through
 }
 
 type Service interface {
 	Reload(experiments []Experiment) error
+	ReloadSegments(segments []Segment) error
 	GetVariable(name string, userID string, context constraint.Context) (*GetVariableResult, error)
+	GetInt(name string, userID string, context constraint.Context, defaultValue int64) (int64, error)
+	GetFloat(name string, userID string, context constraint.Context, defaultValue float64) (float64, error)
+	GetBool(name string, userID string, context constraint.Context, defaultValue bool) (bool, error)
+	GetString(name string, userID string, context constraint.Context, defaultValue string) (string, error)
+	Explain(name string, userID string, context constraint.Context) (*Explanation, error)
 }
 
 type service struct {
-	resolver    constraint.Resolver
+	segments    *SegmentRegistry
 	experiments []Experiment
-	variableMap map[string][]Experiment
+	variableMap map[string][]*loadedExperiment
+
+	// missing is the policy for constraints whose key is not in the context and that don't set a policy of their own
+	missing constraint.MISSING
+}
+
+// loadedExperiment is an experiment along with its audiences' segment references resolved to constraints, and every
+// constraint and expression compiled so evaluating them does as little work as possible.
+type loadedExperiment struct {
+	experiment *Experiment
+	audiences  []loadedAudience
 }
 
+type loadedAudience struct {
+	audience    *Audience
+	constraints []segmentConstraint
+	evaluators  []constraint.Evaluator // One for each of constraints
+	segments    []string
+	expression  *constraint.Expression
+	evaluator   constraint.Evaluator // Compiled expression, nil when there is no expression
+}
+
+// NewService returns a Service where a constraint whose key is not in the context is not met, unless the constraint
+// sets a missing key policy of its own.
 func NewService() *service {
+	return NewServiceWithPolicy(constraint.MISSING_FAIL)
+}
+
+// NewServiceWithPolicy returns a Service that applies the missing key policy to constraints that don't set one, see
+// constraint.MISSING.
+func NewServiceWithPolicy(missing constraint.MISSING) *service {
 	service := &service{}
-	service.resolver = constraint.NewDefaultResolver()
+	service.segments = NewSegmentRegistry()
 	service.experiments = make([]Experiment, 0)
-	service.variableMap = make(map[string][]Experiment)
+	service.variableMap = make(map[string][]*loadedExperiment)
+	service.missing = missing
 
 	return service
 }
 
 func (service *service) Reload(experiments []Experiment) error {
-	service.experiments = experiments
-	service.variableMap = make(map[string][]Experiment)
+	variableMap := make(map[string][]*loadedExperiment)
+
+	// Experiments that are already loaded can only move along their lifecycle
+	previous := make(map[string]STATUS)
+	for _, experiment := range service.experiments {
+		previous[experiment.Name] = experiment.Status
+	}
+
+	for i := range experiments {
+		if err := experiments[i].Validate(); err != nil {
+			// Wrapped with %w so that validation.Problems finds the problems of the experiment
+			return fmt.Errorf("could not reload experiment '%s': %w", experiments[i].Name, err)
+		}
 
-	for _, experiment := range experiments {
-		for _, variableName := range experiment.VariableNames {
-			if service.variableMap[variableName] == nil {
-				service.variableMap[variableName] = make([]Experiment, 0, 1)
+		if status, ok := previous[experiments[i].Name]; ok {
+			if err := ValidateTransition(status, experiments[i].Status); err != nil {
+				return fmt.Errorf("could not reload experiment '%s': %w", experiments[i].Name, err)
 			}
+		}
+
+		loaded, err := service.load(&experiments[i])
+
+		if err != nil {
+			return fmt.Errorf("could not reload experiments: %w", err)
+		}
+
+		for _, variableName := range loaded.experiment.VariableNames {
+			variableMap[variableName] = append(variableMap[variableName], loaded)
+		}
+	}
+
+	service.experiments = experiments
+	service.variableMap = variableMap
+
+	return nil
+}
+
+// ReloadSegments replaces every known segment and re-resolves the references of the loaded experiments.
+func (service *service) ReloadSegments(segments []Segment) error {
+	registry := NewSegmentRegistry()
 
-			service.variableMap[variableName] = append(service.variableMap[variableName], experiment)
+	for _, segment := range segments {
+		if err := registry.Register(segment); err != nil {
+			return fmt.Errorf("could not reload segments: %w", err)
 		}
 	}
 
+	if err := registry.Validate(); err != nil {
+		return fmt.Errorf("could not reload segments: %w", err)
+	}
+
+	previous := service.segments
+	service.segments = registry
+
+	if err := service.Reload(service.experiments); err != nil {
+		service.segments = previous
+		return err
+	}
+
 	return nil
 }
 
+func (service *service) load(experiment *Experiment) (*loadedExperiment, error) {
+	loaded := &loadedExperiment{experiment: experiment}
+	loaded.audiences = make([]loadedAudience, len(experiment.Audiences))
+
+	for i := range experiment.Audiences {
+		audience := &experiment.Audiences[i]
+		constraints, err := service.segments.resolveAudience(audience)
+
+		if err != nil {
+			return nil, errors.Annotatef(err, "experiment '%s'", experiment.Name)
+		}
+
+		loaded.audiences[i] = loadedAudience{audience: audience, constraints: constraints, segments: audience.Segments}
+		loadedAudience := &loaded.audiences[i]
+		loadedAudience.evaluators = make([]constraint.Evaluator, len(constraints))
+
+		for j := range constraints {
+			evaluator, err := constraint.CompileWithPolicy(&constraints[j].constraint, service.missing)
+
+			if err != nil {
+				return nil, errors.Annotatef(err, "experiment '%s' audience '%s'", experiment.Name, audience.Name)
+			}
+
+			loadedAudience.evaluators[j] = evaluator
+		}
+
+		if audience.Expression != "" {
+			expression, err := constraint.ParseExpression(audience.Expression)
+
+			if err != nil {
+				return nil, errors.Annotatef(err, "experiment '%s' audience '%s'", experiment.Name, audience.Name)
+			}
+
+			evaluator, err := constraint.CompileExpressionWithPolicy(expression, service.missing)
+
+			if err != nil {
+				return nil, errors.Annotatef(err, "experiment '%s' audience '%s'", experiment.Name, audience.Name)
+			}
+
+			loadedAudience.expression = expression
+			loadedAudience.evaluator = evaluator
+		}
+	}
+
+	return loaded, nil
+}
+
 func (service *service) GetVariable(variableName string, userID string, context constraint.Context) (*GetVariableResult, error) {
+	return service.evaluate(variableName, userID, context, nil)
+}
+
+// Explain evaluates a variable like GetVariable but also records how each audience and constraint was resolved.
+func (service *service) Explain(variableName string, userID string, context constraint.Context) (*Explanation, error) {
+	explanation := &Explanation{Variable: variableName, UserID: userID}
+
+	result, err := service.evaluate(variableName, userID, context, explanation)
+	explanation.Result = result
+	explanation.Err = err
+
+	return explanation, err
+}
+
+func (service *service) evaluate(variableName string, userID string, context constraint.Context, explanation *Explanation) (*GetVariableResult, error) {
 	experiments, experimentsOk := service.variableMap[variableName]
 
 	if !experimentsOk {
-		return nil, errors.Errorf("no experiment matching variable '%s'", variableName)
+		return nil, &Error{Kind: ErrUnknownVariable, Variable: variableName, Err: errors.Errorf("no experiment matching variable '%s'", variableName)}
 	}
 
-	for _, experiment := range experiments {
+	for _, loaded := range experiments {
+		experiment := loaded.experiment
+
 		if !experiment.Enabled {
+			reason := "experiment disabled"
+			if experiment.Status != "" {
+				reason = "experiment " + experiment.Status
+			}
+
+			explanation.skip(experiment, nil, reason)
 			continue
 		}
 
@@ -70,36 +220,28 @@ func (service *service) GetVariable(variableName string, userID string, context
 			continue
 		}
 
-		for _, audience := range experiment.Audiences {
+		for i := range loaded.audiences {
+			loadedAudience := &loaded.audiences[i]
+			audience := loadedAudience.audience
+
 			if !audience.Enabled {
+				explanation.skip(experiment, audience, "audience disabled")
 				continue
 			}
 
-			// By default the constraints are met
-			constraintsMet := true
-
-			// If we actually have constraints for this experiment, check them
-			if audience.Constraints != nil {
-
-				// All constraints must be passed
-				for _, constraint := range audience.Constraints {
-					resolveOk, _ := service.resolver.Resolve(&constraint, context)
-
-					// TODO: Log the error. We don't want to stop evaluating so we continue
+			matched, err := service.matches(experiment, loadedAudience, context, explanation)
 
-					if !resolveOk {
-						constraintsMet = false
-						break
-					}
-				}
+			// A constraint that requires its key stops the evaluation when the key is missing
+			if err != nil {
+				return nil, &Error{Kind: constraint.ErrKeyNotFound, Variable: variableName, Err: err}
 			}
 
 			// If constraints are met extract the value
-			if constraintsMet {
-				value, err := service.getVariable(&experiment, &audience, variableName, userID)
+			if matched {
+				value, err := service.getVariable(experiment, audience, variableName, userID)
 
 				if err == nil {
-					return &GetVariableResult{Experiment: &experiment, Audience: &audience, Value: value}, nil
+					return &GetVariableResult{Experiment: experiment, Audience: audience, Value: value, Segments: loadedAudience.segments}, nil
 				} else {
 					return nil, errors.Annotatef(err, "error getting variable")
 				}
@@ -107,7 +249,61 @@ func (service *service) GetVariable(variableName string, userID string, context
 		}
 	}
 
-	return nil, errors.New("failed to find variable or could not meet constraints with given context")
+	return nil, &Error{Kind: ErrNoAudienceMatched, Variable: variableName, Err: errors.New("failed to find variable or could not meet constraints with given context")}
+}
+
+// matches returns true if every constraint of the audience, including those from segments, is met. When explaining,
+// every constraint is resolved so the explanation is complete. An error is returned if a key is missing from the
+// context for a constraint whose policy is MISSING_ERROR, unless an earlier constraint was not met, so explaining
+// gives the same result as not explaining.
+func (service *service) matches(experiment *Experiment, loaded *loadedAudience, context constraint.Context, explanation *Explanation) (bool, error) {
+	audienceExplanation := explanation.audience(experiment, loaded.audience)
+
+	// By default the constraints are met
+	constraintsMet := true
+
+	// All constraints must be passed
+	for i := range loaded.constraints {
+		segmentConstraint := &loaded.constraints[i]
+		resolveOk, resolveErr := loaded.evaluators[i].Evaluate(context)
+
+		// TODO: Log the error. We don't want to stop evaluating so we continue
+
+		audienceExplanation.constraint(segmentConstraint, resolveOk, resolveErr)
+
+		if constraintsMet && isMissingKey(resolveErr) {
+			audienceExplanation.matched(false)
+			return false, resolveErr
+		}
+
+		if !resolveOk {
+			constraintsMet = false
+
+			if audienceExplanation == nil {
+				break
+			}
+		}
+	}
+
+	// The expression must be met as well
+	if loaded.evaluator != nil && (constraintsMet || audienceExplanation != nil) {
+		resolveOk, resolveErr := loaded.evaluator.Evaluate(context)
+
+		audienceExplanation.expression(loaded.expression, resolveOk, resolveErr)
+
+		if constraintsMet && isMissingKey(resolveErr) {
+			audienceExplanation.matched(false)
+			return false, resolveErr
+		}
+
+		if !resolveOk {
+			constraintsMet = false
+		}
+	}
+
+	audienceExplanation.matched(constraintsMet)
+
+	return constraintsMet, nil
 }
 
 func (service *service) getVariable(experiment *Experiment, audience *Audience, variableName string, userID string) (*Value, error) {
@@ -117,6 +313,17 @@ func (service *service) getVariable(experiment *Experiment, audience *Audience,
 		return nil, errors.New("failed to find value group for variable name")
 	}
 
+	// Concluded experiments serve the winner to everyone
+	if experiment.Status == STATUS_CONCLUDED {
+		winner, ok := experiment.Winners[variableName]
+
+		if !ok || winner < 0 || winner >= len(valueGroup.WeightedValues) {
+			return nil, errors.Errorf("no valid winner declared for variable '%s'", variableName)
+		}
+
+		return &valueGroup.WeightedValues[winner].Value, nil
+	}
+
 	// Create a hash string from salts + userID
 	hashString := experiment.Salt + valueGroup.Salt + userID
 	hashNumber := getHash(hashString)
@@ -129,6 +336,21 @@ func (service *service) getVariable(experiment *Experiment, audience *Audience,
 		return &valueGroup.ControlValue, nil
 	}
 
+	// Buckets are owned explicitly, users of buckets that are not owned get the control value
+	if valueGroup.Allocation == ALLOCATION_BUCKETS {
+		bucket := getBucket(hashString)
+
+		for i := range valueGroup.WeightedValues {
+			for _, bucketRange := range valueGroup.WeightedValues[i].Buckets {
+				if bucket >= bucketRange.Start && bucket < bucketRange.End {
+					return &valueGroup.WeightedValues[i].Value, nil
+				}
+			}
+		}
+
+		return &valueGroup.ControlValue, nil
+	}
+
 	// Build a distribution in order to randomize which value is returned
 	var weightSum uint32 = 0
 	weights := make([]uint32, len(valueGroup.WeightedValues))
@@ -162,3 +384,9 @@ func getHash(s string) uint32 {
 	hash.Write([]byte(s))
 	return hash.Sum32()
 }
+
+// isMissingKey returns true if the error is about a key that is not in the context.
+func isMissingKey(err error) bool {
+	constraintErr, ok := err.(*constraint.Error)
+	return ok && constraintErr.Kind == constraint.ErrKeyNotFound
+}
@@ -2,6 +2,7 @@ package experiment
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/sneakylocke/experiment/constraint"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
@@ -35,6 +36,153 @@ func TestAudience3(t *testing.T) {
 	testAudience(t, "audience_3", "testdata/experiments/constraints_test_1.json", "a", mapContext)
 }
 
+func TestExpressionAudience(t *testing.T) {
+	context := make(map[string]interface{})
+	context["country"] = "CA"
+	context["app_version"] = "4.12.3"
+	context["is_employee"] = false
+	mapContext := constraint.NewMapContext(context)
+
+	testAudience(t, "north_america", "testdata/experiments/expression_test_1.json", "a", mapContext)
+
+	// Both the constraints and the expression must match
+	context["country"] = "ITALY"
+	context["temperature"] = 75
+	testAudience(t, "italy", "testdata/experiments/expression_test_1.json", "a", mapContext)
+
+	context["temperature"] = 65
+	testAudience(t, "everyone", "testdata/experiments/expression_test_1.json", "a", mapContext)
+}
+
+func TestExpressionAudienceExplain(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/expression_test_1.json")
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	context := constraint.NewMapContext(map[string]interface{}{"country": "US", "app_version": "4.9", "is_employee": false})
+	explanation, err := service.Explain("a", "userID", context)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "everyone", explanation.Result.Audience.Name)
+	assert.False(t, explanation.Audiences[0].Expression.Satisfied)
+	assert.Contains(t, explanation.String(), `[expression] country in ["US", "CA"] && app_version VERSION_GTE "4.12" && !is_employee: false`)
+}
+
+func TestExpressionAudienceInvalid(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/expression_test_1.json")
+	experiment.Audiences[0].Expression = `country in ["US", "CA"] &&`
+
+	assert.NotNil(t, experiment.Validate())
+	assert.NotNil(t, NewService().Reload([]Experiment{*experiment}))
+}
+
+func TestReloadInvalidConstraint(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/constraints_test_1.json")
+	experiment.Audiences[1].Constraints[1].Operator = constraint.OPERATOR_IN
+	experiment.Audiences[1].Constraints[1].Value = "banana"
+
+	// Constraints are compiled on reload so an invalid one is reported then rather than never matching
+	service := NewService()
+	assert.NotNil(t, service.Reload([]Experiment{*experiment}))
+
+	_, err := service.GetVariable("a", "userID", constraint.NewMapContext(map[string]interface{}{"country": "USA"}))
+	assert.NotNil(t, err)
+}
+
+func TestGetVariableErrors(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/constraints_test_1.json")
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	_, err := service.GetVariable("unknown", "userID", constraint.NewMapContext(map[string]interface{}{}))
+	assert.True(t, errors.Is(err, ErrUnknownVariable))
+	assert.False(t, errors.Is(err, ErrNoAudienceMatched))
+
+	_, err = service.GetVariable("a", "userID", constraint.NewMapContext(map[string]interface{}{"country": "ITALY", "food": "cheese"}))
+	assert.True(t, errors.Is(err, ErrNoAudienceMatched))
+
+	var variableErr *Error
+	assert.True(t, errors.As(err, &variableErr))
+	assert.Equal(t, "a", variableErr.Variable)
+}
+
+func TestMissingKeyPolicy(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/constraints_test_1.json")
+	context := constraint.NewMapContext(map[string]interface{}{"food": "cheese"})
+
+	// Without a country no audience matches by default
+	service := NewService()
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	_, err := service.GetVariable("a", "userID", context)
+	assert.True(t, errors.Is(err, ErrNoAudienceMatched))
+
+	// A user without a country is not from ITALY
+	experiment.Audiences[2].Constraints[0].Missing = constraint.MISSING_PASS
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	result, err := service.GetVariable("a", "userID", context)
+	assert.Nil(t, err)
+	assert.Equal(t, "audience_3", result.Audience.Name)
+
+	// A key that is required stops the evaluation
+	experiment.Audiences[0].Constraints[0].Missing = constraint.MISSING_ERROR
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	_, err = service.GetVariable("a", "userID", context)
+	assert.True(t, errors.Is(err, constraint.ErrKeyNotFound))
+
+	var constraintErr *constraint.Error
+	assert.True(t, errors.As(err, &constraintErr))
+	assert.Equal(t, "country", constraintErr.Key)
+
+	explanation, err := service.Explain("a", "userID", context)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(explanation.Audiences))
+
+	// A required key after a constraint that is not met is never looked at, explaining or not
+	experiment = loadExperiment(t, "testdata/experiments/constraints_test_1.json")
+	experiment.Audiences[0].Constraints[1].Missing = constraint.MISSING_ERROR
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	italy := constraint.NewMapContext(map[string]interface{}{"country": "ITALY", "food": "cheese"})
+
+	_, err = service.GetVariable("a", "userID", italy)
+	assert.True(t, errors.Is(err, ErrNoAudienceMatched))
+
+	explanation, err = service.Explain("a", "userID", italy)
+	assert.True(t, errors.Is(err, ErrNoAudienceMatched))
+	assert.Equal(t, 3, len(explanation.Audiences))
+}
+
+func TestServiceMissingKeyPolicy(t *testing.T) {
+	experiment := loadExperiment(t, "testdata/experiments/constraints_test_1.json")
+	context := constraint.NewMapContext(map[string]interface{}{"food": "cheese"})
+
+	// Without a country or a temperature every constraint of the first audience passes
+	service := NewServiceWithPolicy(constraint.MISSING_PASS)
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	result, err := service.GetVariable("a", "userID", context)
+	assert.Nil(t, err)
+	assert.Equal(t, "audience_1", result.Audience.Name)
+
+	// A policy of the constraint itself takes precedence
+	experiment.Audiences[0].Constraints[0].Missing = constraint.MISSING_FAIL
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	result, err = service.GetVariable("a", "userID", context)
+	assert.Nil(t, err)
+	assert.Equal(t, "audience_3", result.Audience.Name)
+
+	// Every missing key is an error
+	service = NewServiceWithPolicy(constraint.MISSING_ERROR)
+	assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+	_, err = service.GetVariable("a", "userID", context)
+	assert.True(t, errors.Is(err, constraint.ErrKeyNotFound))
+}
+
 func testAudience(t *testing.T, expectedAudienceName string, fileName string, variableName string, context constraint.Context) {
 	experiment := loadExperiment(t, fileName)
 	service := NewService()
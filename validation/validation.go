@@ -0,0 +1,180 @@
+// Package validation collects every problem found while validating a value, along with the path of the field it was
+// found at, so that a large experiment file can be fixed in one pass instead of one error at a time.
+//
+// Paths look like JSON paths relative to the value being validated: fields are separated by dots, elements of lists
+// are indexed and map keys are written as fields, as in audiences[2].valueGroups.b.weightedValues.
+package validation
+
+import (
+	stderrors "errors"
+	"github.com/juju/errors"
+	"strconv"
+	"strings"
+)
+
+// SEVERITY is intended to act as an enum for how serious a Problem is.
+type SEVERITY = string
+
+const (
+	SEVERITY_ERROR   = "ERROR"   // The value can't be used
+	SEVERITY_WARNING = "WARNING" // The value can be used but is most likely a mistake
+)
+
+// Problem is a single problem found at Path. An empty Path is the value being validated itself.
+type Problem struct {
+	Path     string
+	Severity SEVERITY
+	Err      error
+}
+
+func (p *Problem) Error() string {
+	if p.Path == "" {
+		return p.Err.Error()
+	}
+
+	return p.Path + ": " + p.Err.Error()
+}
+
+func (p *Problem) Unwrap() error {
+	return p.Err
+}
+
+// Errors is every Problem found, in the order they were found. It is an error so it can be returned wherever a single
+// error is expected, and errors.Is and errors.As look through each of its problems.
+type Errors []*Problem
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+
+	for i, problem := range e {
+		messages[i] = problem.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+
+	for i, problem := range e {
+		errs[i] = problem
+	}
+
+	return errs
+}
+
+// Problems returns the problems of an error returned by a Validate method, looking through errors wrapping it with
+// %w. An error that does not wrap Errors or a *Problem is a single error without a path.
+func Problems(err error) []*Problem {
+	if err == nil {
+		return nil
+	}
+
+	var problems Errors
+	if stderrors.As(err, &problems) {
+		return problems
+	}
+
+	var problem *Problem
+	if stderrors.As(err, &problem) {
+		return []*Problem{problem}
+	}
+
+	return []*Problem{{Severity: SEVERITY_ERROR, Err: err}}
+}
+
+// Collector gathers problems while validating. The zero value is ready to use.
+type Collector struct {
+	problems Errors
+	parent   *Collector // Set for collectors returned by At
+	path     string
+}
+
+// At returns a Collector that records into c, with paths relative to path. It lets nested values be validated
+// without losing their warnings, which the error of a Validate method does not carry.
+func (c *Collector) At(path string) *Collector {
+	return &Collector{parent: c, path: path}
+}
+
+// Add records err as found at path. When err holds problems of its own, as returned by a nested Validate, their paths
+// are made relative to path. Nil errors are ignored, so the result of a Validate method can be passed directly.
+func (c *Collector) Add(path string, err error) {
+	for _, problem := range Problems(err) {
+		severity := problem.Severity
+		if severity == "" {
+			severity = SEVERITY_ERROR
+		}
+
+		c.add(&Problem{Path: join(path, problem.Path), Severity: severity, Err: problem.Err})
+	}
+}
+
+// Addf records a new error found at path.
+func (c *Collector) Addf(path string, format string, args ...interface{}) {
+	c.Add(path, errors.Errorf(format, args...))
+}
+
+// Warnf records a warning found at path.
+func (c *Collector) Warnf(path string, format string, args ...interface{}) {
+	c.add(&Problem{Path: path, Severity: SEVERITY_WARNING, Err: errors.Errorf(format, args...)})
+}
+
+func (c *Collector) add(problem *Problem) {
+	if c.parent != nil {
+		problem.Path = join(c.path, problem.Path)
+		c.parent.add(problem)
+		return
+	}
+
+	c.problems = append(c.problems, problem)
+}
+
+// Problems returns every problem found so far, errors and warnings.
+func (c *Collector) Problems() []*Problem {
+	if c.parent != nil {
+		return c.parent.Problems()
+	}
+
+	return c.problems
+}
+
+// Err returns nil if no error was found, or Errors holding the problems of SEVERITY_ERROR. Warnings are left out.
+func (c *Collector) Err() error {
+	var errs Errors
+
+	for _, problem := range c.Problems() {
+		if problem.Severity == SEVERITY_ERROR {
+			errs = append(errs, problem)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// join appends a path to another.
+func join(path string, child string) string {
+	switch {
+	case path == "":
+		return child
+	case child == "":
+		return path
+	case strings.HasPrefix(child, "["):
+		return path + child
+	default:
+		return path + "." + child
+	}
+}
+
+// Field returns the path of a field, or of a map key, of the value at path.
+func Field(path string, name string) string {
+	return join(path, name)
+}
+
+// Index returns the path of an element of the list at path.
+func Index(path string, index int) string {
+	return path + "[" + strconv.Itoa(index) + "]"
+}
@@ -0,0 +1,66 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var errKind = errors.New("kind")
+
+func TestCollector(t *testing.T) {
+	nested := &Collector{}
+	nested.Addf("name", "no name")
+	nested.Add(Index("values", 1), errKind)
+	nested.Add("ignored", nil)
+
+	problems := &Collector{}
+	assert.Nil(t, problems.Err())
+
+	problems.Addf("", "top")
+	problems.Add(Field(Index("audiences", 2), "valueGroups"), nested.Err())
+	problems.Add(Index("list", 0), Errors{{Path: "[1]", Err: errKind}})
+
+	err := problems.Err()
+	assert.NotNil(t, err)
+
+	paths := make([]string, 0)
+	for _, problem := range Problems(err) {
+		paths = append(paths, problem.Path)
+	}
+
+	assert.Equal(t, []string{"", "audiences[2].valueGroups.name", "audiences[2].valueGroups.values[1]", "list[0][1]"}, paths)
+	assert.Equal(t, "top; audiences[2].valueGroups.name: no name; audiences[2].valueGroups.values[1]: kind; list[0][1]: kind", err.Error())
+	assert.True(t, errors.Is(err, errKind))
+
+	var problem *Problem
+	assert.True(t, errors.As(err, &problem))
+	assert.Equal(t, "", problem.Path)
+}
+
+func TestProblems(t *testing.T) {
+	assert.Nil(t, Problems(nil))
+	assert.Equal(t, []*Problem{{Severity: SEVERITY_ERROR, Err: errKind}}, Problems(errKind))
+	assert.Equal(t, []*Problem{{Path: "a", Err: errKind}}, Problems(&Problem{Path: "a", Err: errKind}))
+
+	// Wrapped problems are found too
+	wrapped := fmt.Errorf("context: %w", Errors{{Path: "a", Err: errKind}, {Path: "b", Err: errKind}})
+	assert.Equal(t, []*Problem{{Path: "a", Err: errKind}, {Path: "b", Err: errKind}}, Problems(wrapped))
+	assert.Equal(t, []*Problem{{Path: "a", Err: errKind}}, Problems(fmt.Errorf("context: %w", &Problem{Path: "a", Err: errKind})))
+}
+
+func TestCollectorWarnings(t *testing.T) {
+	problems := &Collector{}
+	nested := problems.At(Index("audiences", 1))
+	nested.Warnf("constraints", "unreachable")
+
+	// Warnings are not errors
+	assert.Nil(t, problems.Err())
+	assert.Nil(t, nested.Err())
+	assert.Equal(t, []*Problem{{Path: "audiences[1].constraints", Severity: SEVERITY_WARNING, Err: problems.Problems()[0].Err}}, problems.Problems())
+
+	nested.At("valueGroups").Addf("a", "no salt")
+	assert.Len(t, problems.Problems(), 2)
+	assert.Equal(t, "audiences[1].valueGroups.a: no salt", problems.Err().Error())
+}
@@ -1,25 +1,170 @@
 package experiment
 
+import (
+	"encoding/json"
+	"github.com/juju/errors"
+)
+
+// VALUE_TYPE is intended to act as an enum for which field of a Value holds its payload.
+type VALUE_TYPE = string
+
+const (
+	VALUE_TYPE_FLOAT  = "FLOAT"
+	VALUE_TYPE_INT    = "INT"
+	VALUE_TYPE_BOOL   = "BOOL"
+	VALUE_TYPE_STRING = "STRING"
+	VALUE_TYPE_JSON   = "JSON"
+)
+
+// Value is a tagged union: Type says which of the other fields is meaningful. Values written before Type existed
+// have an empty Type and are read as the type of whichever of FloatValue, IntValue and BoolValue is set. One with
+// none of them set is a zero that may be read as any of the three.
 type Value struct {
-	FloatValue float64 `json:"float"`
-	IntValue   int64   `json:"int"`
-	BoolValue  bool    `json:"bool"`
+	Type        VALUE_TYPE      `json:"type,omitempty"`
+	FloatValue  float64         `json:"float"`
+	IntValue    int64           `json:"int"`
+	BoolValue   bool            `json:"bool"`
+	StringValue string          `json:"string,omitempty"`
+	JSONValue   json.RawMessage `json:"json,omitempty"`
 }
 
 func NewFloatValue(v float64) *Value {
 	value := &Value{}
+	value.Type = VALUE_TYPE_FLOAT
 	value.FloatValue = v
 	return value
 }
 
 func NewIntValue(v int64) *Value {
 	value := &Value{}
+	value.Type = VALUE_TYPE_INT
 	value.IntValue = v
 	return value
 }
 
 func NewBoolValue(v bool) *Value {
 	value := &Value{}
+	value.Type = VALUE_TYPE_BOOL
 	value.BoolValue = v
 	return value
 }
+
+func NewStringValue(v string) *Value {
+	value := &Value{}
+	value.Type = VALUE_TYPE_STRING
+	value.StringValue = v
+	return value
+}
+
+// NewJSONValue returns a Value holding a raw JSON document, such as a config blob, that is decoded by the caller.
+func NewJSONValue(v json.RawMessage) *Value {
+	value := &Value{}
+	value.Type = VALUE_TYPE_JSON
+	value.JSONValue = v
+	return value
+}
+
+// decode stores the payload in target, which must point to an int64, float64, bool or string matching the Type, or
+// to anything a JSON value can be decoded into. Values without a type are read as the type of their payload.
+func (v *Value) decode(target interface{}) error {
+	var ok bool
+
+	switch t := target.(type) {
+	case *int64:
+		if ok = v.CanReadAs(VALUE_TYPE_INT); ok {
+			*t = v.IntValue
+		}
+	case *float64:
+		if ok = v.CanReadAs(VALUE_TYPE_FLOAT); ok {
+			*t = v.FloatValue
+		}
+	case *bool:
+		if ok = v.CanReadAs(VALUE_TYPE_BOOL); ok {
+			*t = v.BoolValue
+		}
+	case *string:
+		if ok = v.CanReadAs(VALUE_TYPE_STRING); ok {
+			*t = v.StringValue
+		}
+	default:
+		if v.Type != VALUE_TYPE_JSON {
+			break
+		}
+
+		if err := json.Unmarshal(v.JSONValue, target); err != nil {
+			return errors.Annotatef(err, "could not decode JSON value into %T", target)
+		}
+
+		ok = true
+	}
+
+	if !ok {
+		valueType := v.Type
+		if valueType == "" {
+			valueType = "untyped"
+		}
+
+		return errors.Errorf("value of type %s can't be read as %T", valueType, target)
+	}
+
+	return nil
+}
+
+// CanReadAs tells if the typed getter for valueType can read the value: it is of that type, or it has no type and
+// its payload is of that type or empty.
+func (v *Value) CanReadAs(valueType VALUE_TYPE) bool {
+	return v.Type == valueType && valueType != "" || v.untypedHolds(valueType)
+}
+
+// untypedHolds tells if a value without a type can be read as valueType: its payload is of that type, or it has
+// no payload at all.
+func (v *Value) untypedHolds(valueType VALUE_TYPE) bool {
+	if v.Type != "" {
+		return false
+	}
+
+	floatSet, intSet, boolSet := v.FloatValue != 0, v.IntValue != 0, v.BoolValue
+
+	switch valueType {
+	case VALUE_TYPE_FLOAT:
+		return !intSet && !boolSet || floatSet
+	case VALUE_TYPE_INT:
+		return !floatSet && !boolSet || intSet
+	case VALUE_TYPE_BOOL:
+		return !floatSet && !intSet || boolSet
+	default:
+		return false
+	}
+}
+
+// Validate checks that the Type is known and that only the field for that Type is set.
+func (v *Value) Validate() error {
+	switch v.Type {
+	case "":
+		if v.StringValue != "" || v.JSONValue != nil {
+			return errors.New("values without a type can only hold a float, int or bool")
+		}
+
+		return nil
+	case VALUE_TYPE_FLOAT, VALUE_TYPE_INT, VALUE_TYPE_BOOL, VALUE_TYPE_STRING:
+	case VALUE_TYPE_JSON:
+		if !json.Valid(v.JSONValue) {
+			return errors.Errorf("invalid JSON value: %s", v.JSONValue)
+		}
+	default:
+		return errors.Errorf("invalid value type: %s", v.Type)
+	}
+
+	// A tagged value must not carry a payload for another type
+	other := (v.Type != VALUE_TYPE_FLOAT && v.FloatValue != 0) ||
+		(v.Type != VALUE_TYPE_INT && v.IntValue != 0) ||
+		(v.Type != VALUE_TYPE_BOOL && v.BoolValue) ||
+		(v.Type != VALUE_TYPE_STRING && v.StringValue != "") ||
+		(v.Type != VALUE_TYPE_JSON && v.JSONValue != nil)
+
+	if other {
+		return errors.Errorf("value of type %s holds a payload for another type", v.Type)
+	}
+
+	return nil
+}
@@ -1,12 +1,17 @@
 package experiment
 
-import "github.com/juju/errors"
+import (
+	"encoding/json"
+	"github.com/juju/errors"
+	"github.com/sneakylocke/experiment/validation"
+)
 
 type ValueGroup struct {
 	Name           string          `json:"name"`
 	Salt           string          `json:"salt"`
 	ControlValue   Value           `json:"controlValue"`
 	WeightedValues []WeightedValue `json:"weightedValues"`
+	Allocation     ALLOCATION      `json:"allocation,omitempty"` // How users are split between weighted values, ALLOCATION_WEIGHTED when empty
 }
 
 func NewFloatValueGroup(name string, weights []uint32, values []float64) *ValueGroup {
@@ -39,22 +44,177 @@ func NewBoolValueGroup(name string, weights []uint32, values []bool) *ValueGroup
 	return valueGroup
 }
 
+func NewStringValueGroup(name string, weights []uint32, values []string) *ValueGroup {
+	valueGroup := newValueGroup(name, weights)
+
+	for i := range valueGroup.WeightedValues {
+		valueGroup.WeightedValues[i].Value = *NewStringValue(values[i])
+	}
+
+	return valueGroup
+}
+
+func NewJSONValueGroup(name string, weights []uint32, values []json.RawMessage) *ValueGroup {
+	valueGroup := newValueGroup(name, weights)
+
+	for i := range valueGroup.WeightedValues {
+		valueGroup.WeightedValues[i].Value = *NewJSONValue(values[i])
+	}
+
+	return valueGroup
+}
+
+// Validate returns every error with the value group, each with the path of its field, see validation.Errors.
 func (valueGroup *ValueGroup) Validate() error {
+	problems := &validation.Collector{}
+	valueGroup.validate(problems)
+
+	return problems.Err()
+}
+
+func (valueGroup *ValueGroup) validate(problems *validation.Collector) {
 	if valueGroup.Name == "" {
-		return errors.Errorf("value groups should have a name")
+		problems.Addf("name", "value groups should have a name")
 	}
 
 	if valueGroup.Salt == "" {
-		return errors.Errorf("value groups should have a salt")
+		problems.Addf("salt", "value groups should have a salt")
 	}
 
 	if len(valueGroup.WeightedValues) == 0 {
-		return errors.Errorf("value groups should have an array of weights")
+		problems.Addf("weightedValues", "value groups should have an array of weights")
+	}
+
+	problems.Add("controlValue", valueGroup.ControlValue.Validate())
+
+	// Every value, including the control value, must be of the same type. When the weighted values agree with each
+	// other it is the control value that is wrong.
+	valueType := valueGroup.ControlValue.Type
+	agree := len(valueGroup.WeightedValues) > 0
+
+	for _, value := range valueGroup.WeightedValues {
+		agree = agree && value.Value.Type == valueGroup.WeightedValues[0].Value.Type
+	}
+
+	if agree && valueGroup.WeightedValues[0].Value.Type != valueType {
+		problems.Addf("controlValue.type", "control value is of type '%s' but the weighted values are of type '%s'", valueType, valueGroup.WeightedValues[0].Value.Type)
+	}
+
+	var weightSum uint64
+
+	for i := range valueGroup.WeightedValues {
+		value := &valueGroup.WeightedValues[i].Value
+		path := validation.Field(validation.Index("weightedValues", i), "value")
+		weightSum += uint64(valueGroup.WeightedValues[i].Weight)
+
+		if err := value.Validate(); err != nil {
+			problems.Add(path, err)
+			continue
+		}
+
+		if !agree && value.Type != valueType {
+			problems.Addf(validation.Field(path, "type"), "value is of type '%s', expected '%s' like the control value", value.Type, valueType)
+		}
+	}
+
+	// Nobody gets a weighted value, which is allowed but rarely meant
+	if len(valueGroup.WeightedValues) > 0 && weightSum == 0 {
+		problems.Warnf("weightedValues", "every weight is 0 so only the control value is served")
+	}
+
+	valueGroup.validateBuckets(problems)
+}
+
+// SetControl sets the value users get when they are outside of the exposure of the audience, or when the value group
+// can't be evaluated. It need not be one of the weighted values, such as the value currently in production, but must
+// be of the same type as them.
+func (valueGroup *ValueGroup) SetControl(value *Value) error {
+	if value == nil {
+		return errors.Errorf("control value of '%s' can't be nil", valueGroup.Name)
+	}
+
+	if err := value.Validate(); err != nil {
+		return errors.Annotatef(err, "invalid control value of '%s'", valueGroup.Name)
+	}
+
+	if len(valueGroup.WeightedValues) > 0 && valueGroup.WeightedValues[0].Value.Type != value.Type {
+		return errors.Errorf("control value of '%s' is of type '%s' but the weighted values are of type '%s'", valueGroup.Name, value.Type, valueGroup.WeightedValues[0].Value.Type)
+	}
+
+	valueGroup.ControlValue = *value
+
+	return nil
+}
+
+// PromoteValue grows the weight of the value at index to weight while keeping the sum of the weights the same. A
+// user's position in [0, sum) depends only on the sum, and the value's range of positions only grows into those of
+// its neighbours, nearest first and those after it before those before it. So everyone who already gets the value
+// keeps getting it, and everyone else either keeps their value or moves to it. Since weight can't exceed the sum, a
+// larger sum allows finer rollouts. Value groups that allocate buckets are rebalanced, which moves the same users.
+func (valueGroup *ValueGroup) PromoteValue(index int, weight uint32) error {
+	weights, err := promoteWeights(valueGroup.WeightedValues, index, weight)
+
+	if err != nil {
+		return errors.Annotatef(err, "could not promote value %d in value group '%s'", index, valueGroup.Name)
+	}
+
+	if valueGroup.Allocation == ALLOCATION_BUCKETS {
+		return valueGroup.Rebalance(weights)
+	}
+
+	for i := range valueGroup.WeightedValues {
+		valueGroup.WeightedValues[i].Weight = weights[i]
 	}
 
 	return nil
 }
 
+// promoteWeights returns the weights after promoting the value at index, see PromoteValue.
+func promoteWeights(values []WeightedValue, index int, weight uint32) ([]uint32, error) {
+	if index < 0 || index >= len(values) {
+		return nil, errors.Errorf("no value at index %d", index)
+	}
+
+	weights := make([]uint32, len(values))
+	var sum uint32
+
+	for i, value := range values {
+		weights[i] = value.Weight
+		sum += value.Weight
+	}
+
+	if weight < weights[index] {
+		return nil, errors.Errorf("weight %d is lower than the current weight %d", weight, weights[index])
+	}
+
+	if weight > sum {
+		return nil, errors.Errorf("weight %d is higher than the sum of the weights %d", weight, sum)
+	}
+
+	grow := weight - weights[index]
+
+	take := func(i int) {
+		taken := weights[i]
+		if taken > grow {
+			taken = grow
+		}
+
+		weights[i] -= taken
+		weights[index] += taken
+		grow -= taken
+	}
+
+	for i := index + 1; i < len(weights) && grow > 0; i++ {
+		take(i)
+	}
+
+	for i := index - 1; i >= 0 && grow > 0; i-- {
+		take(i)
+	}
+
+	return weights, nil
+}
+
 func newValueGroup(name string, weights []uint32) *ValueGroup {
 	valueGroup := &ValueGroup{}
 	valueGroup.Name = name
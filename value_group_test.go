@@ -0,0 +1,114 @@
+package experiment
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestPromoteWeights(t *testing.T) {
+	valueGroup := NewIntValueGroup("variable", []uint32{10, 20, 30, 40}, []int64{0, 1, 2, 3})
+
+	// Weight is taken from the values after the promoted one first, nearest first
+	assert.Nil(t, valueGroup.PromoteValue(1, 50))
+	assert.Equal(t, []uint32{10, 50, 0, 40}, weightsOf(valueGroup))
+
+	assert.Nil(t, valueGroup.PromoteValue(1, 70))
+	assert.Equal(t, []uint32{10, 70, 0, 20}, weightsOf(valueGroup))
+
+	assert.Nil(t, valueGroup.PromoteValue(1, 100))
+	assert.Equal(t, []uint32{0, 100, 0, 0}, weightsOf(valueGroup))
+
+	// Promoting to the current weight changes nothing
+	assert.Nil(t, valueGroup.PromoteValue(1, 100))
+	assert.Equal(t, []uint32{0, 100, 0, 0}, weightsOf(valueGroup))
+
+	assert.NotNil(t, valueGroup.PromoteValue(1, 90), "a promoted value can't shrink")
+	assert.NotNil(t, valueGroup.PromoteValue(1, 101), "the sum of the weights can't change")
+	assert.NotNil(t, valueGroup.PromoteValue(4, 100))
+	assert.NotNil(t, valueGroup.PromoteValue(-1, 100))
+}
+
+func TestAudiencePromoteValue(t *testing.T) {
+	builder := NewAlignedBuilder("experiment")
+	assert.Nil(t, builder.AddInts("a", []uint32{1, 1, 1}, []int64{1, 2, 3}))
+	assert.Nil(t, builder.AddStrings("b", []uint32{1, 1, 1}, []string{"1", "2", "3"}))
+	experiment, err := builder.Build()
+	assert.Nil(t, err)
+
+	audience := &experiment.Audiences[0]
+
+	// Nothing changes unless every value group can be promoted
+	audience.ValueGroups["b"].WeightedValues[2].Weight = 0
+	assert.NotNil(t, audience.PromoteValue(1, 3))
+	assert.Equal(t, []uint32{1, 1, 1}, weightsOf(audience.ValueGroups["a"]))
+
+	audience.ValueGroups["b"].WeightedValues[2].Weight = 1
+	assert.Nil(t, audience.PromoteValue(1, 2))
+	assert.Equal(t, []uint32{1, 2, 0}, weightsOf(audience.ValueGroups["a"]))
+	assert.Equal(t, []uint32{1, 2, 0}, weightsOf(audience.ValueGroups["b"]))
+}
+
+// TestPromoteValueSimulation rolls a winner out in stages and checks that no user who saw the winner is moved away
+// from it, and that users who are not moved to it keep their value.
+func TestPromoteValueSimulation(t *testing.T) {
+	for _, allocation := range []ALLOCATION{ALLOCATION_WEIGHTED, ALLOCATION_BUCKETS} {
+		testPromoteValueSimulation(t, allocation)
+	}
+}
+
+func testPromoteValueSimulation(t *testing.T, allocation ALLOCATION) {
+	const users = 20000
+
+	builder := NewSimpleBuilder("checkout")
+	assert.Nil(t, builder.AddStrings("button_text", []uint32{2500, 2500, 2500, 2500}, []string{"A", "B", "C", "D"}))
+	experiment, err := builder.Build()
+	assert.Nil(t, err)
+
+	if allocation == ALLOCATION_BUCKETS {
+		assert.Nil(t, experiment.Audiences[0].ValueGroups["button_text"].AllocateBuckets())
+	}
+
+	assign := func() map[string]string {
+		service := NewService()
+		assert.Nil(t, service.Reload([]Experiment{*experiment}))
+
+		assignments := make(map[string]string, users)
+
+		for i := 0; i < users; i++ {
+			userID := makeUserID(i)
+			text, err := service.GetString("button_text", userID, nil, "")
+			assert.Nil(t, err)
+			assignments[userID] = text
+		}
+
+		return assignments
+	}
+
+	previous := assign()
+
+	for _, weight := range []uint32{2500, 5000, 9000, 9999, 10000} {
+		assert.Nil(t, experiment.Audiences[0].PromoteValue(2, weight))
+
+		current := assign()
+		winners := 0
+
+		for userID, text := range current {
+			if previous[userID] == "C" {
+				assert.Equal(t, "C", text, "user %s was moved away from the winner", userID)
+			}
+
+			if text != "C" {
+				assert.Equal(t, previous[userID], text, "user %s was moved between other values", userID)
+			} else {
+				winners++
+			}
+		}
+
+		// The winner's share follows its weight
+		share := float64(winners) / users
+		assert.True(t, math.Abs(share-float64(weight)/10000) < 0.02, "%s: weight %d gave a share of %f", allocation, weight, share)
+
+		previous = current
+	}
+}